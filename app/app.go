@@ -2,6 +2,7 @@ package app
 
 import (
 	"context"
+	"log"
 	"os"
 	"os/signal"
 	"sync"
@@ -11,6 +12,8 @@ import (
 	"github.com/ann-96/todo-go-backend/app/db"
 )
 
+const defaultJobInterval = time.Hour
+
 type App struct {
 	TodoController controllers.Settings
 	UserController controllers.Settings
@@ -18,20 +21,32 @@ type App struct {
 
 func (app *App) Run() {
 
-	const serviceNum = 2
+	const serviceNum = 4
 	var wg sync.WaitGroup
 
 	quit := make(chan os.Signal, serviceNum)
 	signal.Notify(quit, os.Interrupt)
 
+	// the services share one store and with it one connection pool
+	store, err := openStore(&app.TodoController)
+	if err != nil {
+		panic(err)
+	}
+	defer store.Close()
+	if err := prepareSchema(store, app.TodoController.AutoMigrate); err != nil {
+		panic(err)
+	}
+
 	wg.Add(serviceNum)
 
 	notifyQuit := make([]chan struct{}, serviceNum)
 	for i := range notifyQuit {
 		notifyQuit[i] = make(chan struct{}, serviceNum)
 	}
-	go app.runTodoRest(&wg, notifyQuit[0])
-	go app.runUserRest(&wg, notifyQuit[1])
+	go app.runTodoRest(&wg, notifyQuit[0], store)
+	go app.runUserRest(&wg, notifyQuit[1], store)
+	go app.runTrashPurger(&wg, notifyQuit[2], store)
+	go app.runTokenPruner(&wg, notifyQuit[3], store)
 
 	<-quit
 	for i := range notifyQuit {
@@ -41,13 +56,8 @@ func (app *App) Run() {
 	wg.Wait()
 }
 
-func (app *App) runTodoRest(wg *sync.WaitGroup, quit chan struct{}) {
-	db, err := getDBConnectionsFromSettings(&app.TodoController)
-	if err != nil {
-		panic(err)
-	}
-
-	c, err := controllers.NewTodoController(app.TodoController, db)
+func (app *App) runTodoRest(wg *sync.WaitGroup, quit chan struct{}, store db.Store) {
+	c, err := controllers.NewTodoController(app.TodoController, store, store)
 	if err != nil {
 		panic(err)
 	}
@@ -75,13 +85,8 @@ func (app *App) runTodoRest(wg *sync.WaitGroup, quit chan struct{}) {
 	wg.Done()
 }
 
-func (app *App) runUserRest(wg *sync.WaitGroup, quit chan struct{}) {
-	db, err := getDBConnectionsFromSettings(&app.UserController)
-	if err != nil {
-		panic(err)
-	}
-
-	c, err := controllers.NewUserController(app.UserController, db)
+func (app *App) runUserRest(wg *sync.WaitGroup, quit chan struct{}, store db.Store) {
+	c, err := controllers.NewUserController(app.UserController, store, store)
 	if err != nil {
 		panic(err)
 	}
@@ -109,20 +114,91 @@ func (app *App) runUserRest(wg *sync.WaitGroup, quit chan struct{}) {
 	wg.Done()
 }
 
-func getDBConnectionsFromSettings(settings *controllers.Settings) (sql db.TodoSqlDB, err error) {
-	sql, err = db.CreatePostgresDB(
+func (app *App) runTrashPurger(wg *sync.WaitGroup, quit chan struct{}, todos db.TodoStore) {
+	retention := app.TodoController.TrashRetention
+	if retention <= 0 {
+		<-quit
+		wg.Done()
+		return
+	}
+
+	runPeriodic(wg, quit, app.TodoController.TrashPurgeInterval, "trash purger", func(ctx context.Context) error {
+		purged, err := todos.PurgeTrash(ctx, time.Now().Add(-retention))
+		if err == nil && purged > 0 {
+			log.Printf("Purged %d todos from the trash", purged)
+		}
+		return err
+	})
+}
+
+func (app *App) runTokenPruner(wg *sync.WaitGroup, quit chan struct{}, users db.UserStore) {
+	runPeriodic(wg, quit, app.UserController.TokenPruneInterval, "token pruner", func(ctx context.Context) error {
+		if _, err := users.PruneRevokedTokens(ctx, time.Now()); err != nil {
+			return err
+		}
+		if _, err := users.PruneRefreshTokens(ctx, time.Now()); err != nil {
+			return err
+		}
+		_, err := users.PruneAttempts(ctx, time.Now().Add(-controllers.AttemptsRetention))
+		return err
+	})
+}
+
+// runPeriodic runs the job right away and then every interval until quit,
+// a failed run is logged and retried on the next tick, quit cancels a running job
+func runPeriodic(wg *sync.WaitGroup, quit chan struct{}, interval time.Duration, name string, job func(ctx context.Context) error) {
+	defer wg.Done()
+
+	if interval <= 0 {
+		interval = defaultJobInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		<-quit
+		cancel()
+	}()
+
+	for {
+		if err := job(ctx); err != nil && ctx.Err() == nil {
+			log.Printf("The %s failed: %v", name, err)
+		}
+
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			log.Printf("Stopping the %s", name)
+			return
+		}
+	}
+}
+
+func openStore(settings *controllers.Settings) (db.Store, error) {
+	return db.Open(
 		db.Settings{
+			Driver:   settings.StorageDriver,
+			Path:     settings.SqlitePath,
 			IP:       settings.SqlHost,
 			Port:     settings.SqlPort,
 			User:     settings.SqlUser,
 			Password: settings.SqlPass,
 			Name:     settings.SqlName,
+			DSN:      settings.SqlDSN,
+
+			SSLMode:     settings.SqlSSLMode,
+			SSLRootCert: settings.SqlSSLRootCert,
+			SSLCert:     settings.SqlSSLCert,
+			SSLKey:      settings.SqlSSLKey,
+
+			MaxOpenConns:    settings.SqlMaxOpenConns,
+			MaxIdleConns:    settings.SqlMaxIdleConns,
+			ConnMaxLifetime: settings.SqlConnMaxLifetime,
+			ConnMaxIdleTime: settings.SqlConnMaxIdleTime,
+			ConnectRetries:  settings.SqlConnectRetries,
+			ConnectBackoff:  settings.SqlConnectBackoff,
 		},
 	)
-	if err != nil {
-		return
-	}
-
-	err = sql.Migrate()
-	return
 }
@@ -0,0 +1,70 @@
+package controllers
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/ann-96/todo-go-backend/app/models"
+	"github.com/ann-96/todo-go-backend/app/tools"
+	echo "github.com/labstack/echo/v4"
+)
+
+func (controller *userController) ListAccessTokens(c echo.Context) error {
+	userId := c.Get("userId").(int)
+	ctx := c.Request().Context()
+
+	res, err := controller.users.ListAccessTokens(ctx, userId)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, &models.ErrResponse{Msg: err.Error()})
+	}
+
+	return c.JSON(http.StatusOK, res)
+}
+
+// CreateAccessToken returns the token once, only its hash is stored. jwtAuth doesn't accept
+// personal access tokens, so a token can't be used to create more tokens
+func (controller *userController) CreateAccessToken(c echo.Context) error {
+	userId := c.Get("userId").(int)
+	ctx := c.Request().Context()
+
+	req := &models.CreateAccessTokenRequest{}
+	if err := c.Bind(req); err != nil {
+		return c.JSON(http.StatusBadRequest, &models.ErrResponse{Msg: err.Error()})
+	}
+	if err := c.Validate(req); err != nil {
+		return c.JSON(http.StatusBadRequest, &models.ErrResponse{Msg: err.Error()})
+	}
+	if req.ExpiresAt != nil && !req.ExpiresAt.After(time.Now()) {
+		return c.JSON(http.StatusBadRequest, &models.ErrResponse{Msg: "expiresAt must be in the future"})
+	}
+
+	token, err := tools.NewAccessToken()
+	if err != nil {
+		return err
+	}
+	res, err := controller.users.CreateAccessToken(ctx, req, tools.HashToken(token), userId)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, &models.ErrResponse{Msg: err.Error()})
+	}
+
+	return c.JSON(http.StatusCreated, &models.CreatedAccessToken{AccessToken: *res, Token: token})
+}
+
+func (controller *userController) RevokeAccessToken(c echo.Context) error {
+	userId := c.Get("userId").(int)
+	ctx := c.Request().Context()
+
+	req := &models.RevokeAccessTokenRequest{}
+	if err := c.Bind(req); err != nil {
+		return c.JSON(http.StatusBadRequest, &models.ErrResponse{Msg: err.Error()})
+	}
+	if err := c.Validate(req); err != nil {
+		return c.JSON(http.StatusBadRequest, &models.ErrResponse{Msg: err.Error()})
+	}
+
+	if err := controller.users.RevokeAccessToken(ctx, *req.Id, userId); err != nil {
+		return c.JSON(http.StatusNotFound, &models.ErrResponse{Msg: err.Error()})
+	}
+
+	return c.NoContent(http.StatusNoContent)
+}
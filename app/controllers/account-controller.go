@@ -0,0 +1,130 @@
+package controllers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/ann-96/todo-go-backend/app/db"
+	"github.com/ann-96/todo-go-backend/app/models"
+	echo "github.com/labstack/echo/v4"
+)
+
+// Export streams the profile and all the data of the user as a JSON archive, the todos
+// are written as they are read, so an archive cut short by an error isn't valid JSON
+func (controller *userController) Export(c echo.Context) error {
+	userId := c.Get("userId").(int)
+	ctx := c.Request().Context()
+
+	head := &models.UserExport{ExportedAt: time.Now().UTC()}
+	profile, err := controller.users.UserProfile(ctx, userId)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, &models.ErrResponse{Msg: err.Error()})
+	}
+	head.Profile = *profile
+	if head.Lists, err = controller.todos.ListLists(ctx, userId); err != nil {
+		return c.JSON(http.StatusInternalServerError, &models.ErrResponse{Msg: err.Error()})
+	}
+	if head.Tags, err = controller.todos.ListTags(ctx, userId); err != nil {
+		return c.JSON(http.StatusInternalServerError, &models.ErrResponse{Msg: err.Error()})
+	}
+	if head.AccessTokens, err = controller.users.ListAccessTokens(ctx, userId); err != nil {
+		return c.JSON(http.StatusInternalServerError, &models.ErrResponse{Msg: err.Error()})
+	}
+	headJson, err := json.Marshal(head)
+	if err != nil {
+		return err
+	}
+
+	res := c.Response()
+	res.Header().Set(echo.HeaderContentType, echo.MIMEApplicationJSONCharsetUTF8)
+	res.Header().Set(echo.HeaderContentDisposition, `attachment; filename="todolist-export.json"`)
+	res.WriteHeader(http.StatusOK)
+
+	// the todos array is spliced in before the closing brace of the head
+	if _, err := res.Write(append(headJson[:len(headJson)-1], `,"todos":[`...)); err != nil {
+		return err
+	}
+	first := true
+	err = controller.todos.ExportTodos(ctx, userId, func(todo *models.Todo) error {
+		todoJson, err := json.Marshal(todo)
+		if err != nil {
+			return err
+		}
+		if !first {
+			todoJson = append([]byte{','}, todoJson...)
+		}
+		first = false
+		_, err = res.Write(todoJson)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	_, err = res.Write([]byte("]}"))
+	return err
+}
+
+// DeleteAccount removes the user with all their data and revokes their tokens, the failed
+// attempts count towards the lockout of the login like those of Login
+func (controller *userController) DeleteAccount(c echo.Context) error {
+	userId := c.Get("userId").(int)
+	ctx := c.Request().Context()
+
+	req := &models.DeleteAccountRequest{}
+	if err := c.Bind(req); err != nil {
+		return c.JSON(http.StatusBadRequest, &models.ErrResponse{Msg: err.Error()})
+	}
+	if err := c.Validate(req); err != nil {
+		return c.JSON(http.StatusBadRequest, &models.ErrResponse{Msg: err.Error()})
+	}
+
+	loginKey, until, err := controller.accountBlockedUntil(c, userId)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, &models.ErrResponse{Msg: err.Error()})
+	} else if !until.IsZero() {
+		return tooManyAttempts(c, until)
+	}
+
+	// the password is checked first, so that a wrong one doesn't use up the code
+	if err := controller.users.VerifyPassword(ctx, userId, *req.Password); err != nil {
+		if errors.Is(err, db.ErrWrongPassword) {
+			if err := controller.failedLogin(c, loginKey); err != nil {
+				return c.JSON(http.StatusInternalServerError, &models.ErrResponse{Msg: err.Error()})
+			}
+			return c.JSON(http.StatusForbidden, &models.ErrResponse{Msg: err.Error()})
+		}
+		return c.JSON(http.StatusInternalServerError, &models.ErrResponse{Msg: err.Error()})
+	}
+
+	enabled, err := controller.users.TwoFactorEnabled(ctx, userId)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, &models.ErrResponse{Msg: err.Error()})
+	}
+	if enabled {
+		if req.Code == "" {
+			return c.JSON(http.StatusUnauthorized, &models.ErrResponse{Msg: "a two-factor code is required"})
+		}
+		if err := controller.users.VerifySecondFactor(ctx, userId, req.Code); err != nil {
+			if err := controller.failedLogin(c, loginKey); err != nil {
+				return c.JSON(http.StatusInternalServerError, &models.ErrResponse{Msg: err.Error()})
+			}
+			return secondFactorError(c, err)
+		}
+	}
+
+	// no token issued before now outlives the longest token lifetime
+	tokensExpireAt := time.Now().Add(controller.MaxTokenTTL())
+	if err := controller.users.DeleteUser(ctx, userId, *req.Password, tokensExpireAt); err != nil {
+		if errors.Is(err, db.ErrWrongPassword) {
+			if err := controller.failedLogin(c, loginKey); err != nil {
+				return c.JSON(http.StatusInternalServerError, &models.ErrResponse{Msg: err.Error()})
+			}
+			return c.JSON(http.StatusForbidden, &models.ErrResponse{Msg: err.Error()})
+		}
+		return c.JSON(http.StatusInternalServerError, &models.ErrResponse{Msg: err.Error()})
+	}
+
+	return c.NoContent(http.StatusNoContent)
+}
@@ -0,0 +1,60 @@
+package controllers
+
+import (
+	"net/http"
+
+	"github.com/ann-96/todo-go-backend/app/db"
+	"github.com/ann-96/todo-go-backend/app/models"
+	echo "github.com/labstack/echo/v4"
+)
+
+// Unlock lifts the lockout of an account or the backoff of an IP before they expire
+func (controller *userController) Unlock(c echo.Context) error {
+	ctx := c.Request().Context()
+	req := &models.UnlockRequest{}
+	if err := c.Bind(req); err != nil {
+		return c.JSON(http.StatusBadRequest, &models.ErrResponse{Msg: err.Error()})
+	}
+	if err := c.Validate(req); err != nil {
+		return c.JSON(http.StatusBadRequest, &models.ErrResponse{Msg: err.Error()})
+	}
+	if req.Login == "" && req.IP == "" {
+		return c.JSON(http.StatusBadRequest, &models.ErrResponse{Msg: "either login or ip is required"})
+	}
+
+	keys := []string{}
+	if req.Login != "" {
+		keys = append(keys, loginAttemptKey(req.Login))
+	}
+	if req.IP != "" {
+		keys = append(keys, attemptKey("ip", req.IP), attemptKey("register-ip", req.IP))
+	}
+	for _, key := range keys {
+		if err := controller.users.ResetAttempts(ctx, key); err != nil {
+			return c.JSON(http.StatusInternalServerError, &models.ErrResponse{Msg: err.Error()})
+		}
+	}
+
+	return c.NoContent(http.StatusNoContent)
+}
+
+// PoolStats reports the connection pool of the store, the memory store has none
+func (controller *userController) PoolStats(c echo.Context) error {
+	pool, ok := controller.users.(db.Pool)
+	if !ok {
+		return c.JSON(http.StatusNotFound, &models.ErrResponse{Msg: "the store has no connection pool"})
+	}
+
+	stats := pool.Stats()
+	return c.JSON(http.StatusOK, &models.PoolStats{
+		MaxOpenConnections: stats.MaxOpenConnections,
+		OpenConnections:    stats.OpenConnections,
+		InUse:              stats.InUse,
+		Idle:               stats.Idle,
+		WaitCount:          stats.WaitCount,
+		WaitDurationMs:     stats.WaitDuration.Milliseconds(),
+		MaxIdleClosed:      stats.MaxIdleClosed,
+		MaxIdleTimeClosed:  stats.MaxIdleTimeClosed,
+		MaxLifetimeClosed:  stats.MaxLifetimeClosed,
+	})
+}
@@ -0,0 +1,127 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ann-96/todo-go-backend/app/models"
+	"github.com/ann-96/todo-go-backend/app/tools"
+	echo "github.com/labstack/echo/v4"
+)
+
+const (
+	defaultLockoutThreshold = 10
+	defaultLockoutDuration  = 15 * time.Minute
+
+	// AttemptsRetention is the longest window of the attempt policies, older failures can be pruned
+	AttemptsRetention = 24 * time.Hour
+)
+
+// ipPolicy slows down an IP trying many passwords, whichever logins it tries them on
+func (controller *userController) ipPolicy() tools.AttemptPolicy {
+	return tools.AttemptPolicy{
+		FreeAttempts: 10,
+		BaseDelay:    time.Second,
+		MaxDelay:     5 * time.Minute,
+		Window:       time.Hour,
+	}
+}
+
+// loginPolicy slows down the attempts on an account and then locks it
+func (controller *userController) loginPolicy() tools.AttemptPolicy {
+	threshold, duration := controller.LoginLockoutThreshold, controller.LoginLockoutDuration
+	if threshold <= 0 {
+		threshold = defaultLockoutThreshold
+	}
+	if duration <= 0 {
+		duration = defaultLockoutDuration
+	}
+	return tools.AttemptPolicy{
+		FreeAttempts:    3,
+		BaseDelay:       time.Second,
+		MaxDelay:        duration,
+		LockoutAfter:    threshold,
+		LockoutDuration: duration,
+		Window:          time.Hour,
+	}
+}
+
+// registerPolicy slows down an IP probing for existing logins
+func (controller *userController) registerPolicy() tools.AttemptPolicy {
+	return tools.AttemptPolicy{
+		FreeAttempts: 10,
+		BaseDelay:    time.Minute,
+		MaxDelay:     time.Hour,
+		Window:       AttemptsRetention,
+	}
+}
+
+func attemptKey(kind string, value string) string {
+	return fmt.Sprintf("%s:%s", kind, value)
+}
+
+// loginAttemptKey is the key of an account, every check of its password or second factor
+// counts towards the same lockout
+func loginAttemptKey(login string) string {
+	return attemptKey("login", strings.ToLower(login))
+}
+
+// accountAttemptKey returns the loginAttemptKey of the user
+func (controller *userController) accountAttemptKey(ctx context.Context, userId int) (string, error) {
+	profile, err := controller.users.UserProfile(ctx, userId)
+	if err != nil {
+		return "", err
+	}
+	return loginAttemptKey(profile.Login), nil
+}
+
+// accountBlockedUntil returns the loginAttemptKey of the user and the end of the block of the
+// account or of the IP of the request, the zero time when neither is blocked
+func (controller *userController) accountBlockedUntil(c echo.Context, userId int) (string, time.Time, error) {
+	ctx := c.Request().Context()
+	loginKey, err := controller.accountAttemptKey(ctx, userId)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	until, err := controller.blockedUntil(ctx, attemptKey("ip", c.RealIP()), loginKey)
+	return loginKey, until, err
+}
+
+// blockedUntil returns the latest end of the blocks of the keys, the zero time when none is blocked
+func (controller *userController) blockedUntil(ctx context.Context, keys ...string) (time.Time, error) {
+	var res time.Time
+	for _, key := range keys {
+		until, err := controller.users.AttemptBlockedUntil(ctx, key)
+		if err != nil {
+			return time.Time{}, err
+		}
+		if until.After(res) {
+			res = until
+		}
+	}
+	return res, nil
+}
+
+// failedLogin counts a failed attempt of the IP of the request and of the account
+func (controller *userController) failedLogin(c echo.Context, accountKey string) error {
+	ctx := c.Request().Context()
+	if _, err := controller.users.RecordFailedAttempt(ctx, attemptKey("ip", c.RealIP()), controller.ipPolicy()); err != nil {
+		return err
+	}
+	_, err := controller.users.RecordFailedAttempt(ctx, accountKey, controller.loginPolicy())
+	return err
+}
+
+func tooManyAttempts(c echo.Context, until time.Time) error {
+	retryAfter := int(math.Ceil(time.Until(until).Seconds()))
+	if retryAfter < 1 {
+		retryAfter = 1
+	}
+	c.Response().Header().Set(echo.HeaderRetryAfter, strconv.Itoa(retryAfter))
+	return c.JSON(http.StatusTooManyRequests, &models.ErrResponse{Msg: "too many failed attempts, try again later"})
+}
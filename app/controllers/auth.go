@@ -0,0 +1,82 @@
+package controllers
+
+import (
+	"crypto/subtle"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/ann-96/todo-go-backend/app/db"
+	"github.com/ann-96/todo-go-backend/app/models"
+	"github.com/ann-96/todo-go-backend/app/tools"
+	echo "github.com/labstack/echo/v4"
+	"github.com/labstack/echo/v4/middleware"
+)
+
+// jwtAuth checks the bearer token of the request and puts its claims and user id into the context,
+// revoked tokens are rejected
+func jwtAuth(settings Settings, revocations db.TokenRevocationList) echo.MiddlewareFunc {
+	return middleware.KeyAuthWithConfig(middleware.KeyAuthConfig{
+		KeyLookup: "header:authorization",
+		Validator: func(input string, c echo.Context) (bool, error) {
+			return validateJWT(input, c, settings, revocations)
+		},
+	})
+}
+
+// todoAuth accepts personal access tokens alongside the JWTs of jwtAuth, the scope
+// of a personal access token is put into the context for checkScope
+func todoAuth(settings Settings, users db.UserStore) echo.MiddlewareFunc {
+	return middleware.KeyAuthWithConfig(middleware.KeyAuthConfig{
+		KeyLookup: "header:authorization",
+		Validator: func(input string, c echo.Context) (bool, error) {
+			if !tools.IsAccessToken(input) {
+				return validateJWT(input, c, settings, users)
+			}
+			userId, scope, err := users.UseAccessToken(c.Request().Context(), tools.HashToken(input))
+			if err != nil {
+				return false, err
+			}
+			c.Set("userId", userId)
+			c.Set("scope", scope)
+			return true, nil
+		},
+	})
+}
+
+// adminAuth lets in the requests carrying the AdminToken
+func adminAuth(settings Settings) echo.MiddlewareFunc {
+	return middleware.KeyAuthWithConfig(middleware.KeyAuthConfig{
+		KeyLookup: "header:authorization",
+		Validator: func(input string, c echo.Context) (bool, error) {
+			return subtle.ConstantTimeCompare([]byte(input), []byte(settings.AdminToken)) == 1, nil
+		},
+	})
+}
+
+// checkScope keeps read-only personal access tokens to the GET routes
+func checkScope(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		if scope, ok := c.Get("scope").(string); ok && scope == models.ScopeTodosRead && c.Request().Method != http.MethodGet {
+			return c.JSON(http.StatusForbidden, &models.ErrResponse{Msg: "the token is read-only"})
+		}
+		return next(c)
+	}
+}
+
+func validateJWT(input string, c echo.Context, settings Settings, revocations db.TokenRevocationList) (bool, error) {
+	claims, err := ParseToken(input, settings.Keys)
+	if err != nil {
+		return false, err
+	}
+	revoked, err := revocations.IsTokenRevoked(c.Request().Context(), claims.Id, claims.UserID, time.Unix(claims.IssuedAt, 0))
+	if err != nil {
+		return false, err
+	}
+	if revoked {
+		return false, errors.New("the token is revoked")
+	}
+	c.Set("userId", claims.UserID)
+	c.Set("claims", claims)
+	return true, nil
+}
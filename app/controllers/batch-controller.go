@@ -0,0 +1,102 @@
+package controllers
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/ann-96/todo-go-backend/app/models"
+	echo "github.com/labstack/echo/v4"
+)
+
+func (controller *todoController) Batch(c echo.Context) error {
+	userId := c.Get("userId").(int)
+	ctx := c.Request().Context()
+
+	req := &models.BatchRequest{}
+	if err := c.Bind(req); err != nil {
+		return c.JSON(http.StatusBadRequest, &models.ErrResponse{Msg: err.Error()})
+	}
+	if err := c.Validate(req); err != nil {
+		return c.JSON(http.StatusBadRequest, &models.ErrResponse{Msg: err.Error()})
+	}
+	if len(req.Operations) == 0 && req.Action == nil {
+		return c.JSON(http.StatusBadRequest, &models.ErrResponse{Msg: "the batch has no operations"})
+	}
+
+	batch := &models.Batch{
+		BestEffort: req.Mode == models.BatchModeBestEffort,
+	}
+	invalid := []models.BatchOperationResult{}
+	for i, op := range req.Operations {
+		if err := validateBatchOperation(c, &op); err != nil {
+			if !batch.BestEffort {
+				return c.JSON(http.StatusBadRequest, &models.ErrResponse{Msg: fmt.Sprintf("operation %d: %v", i, err)})
+			}
+			invalid = append(invalid, models.BatchOperationResult{Index: i, Error: err.Error()})
+			continue
+		}
+		batch.Operations = append(batch.Operations, op)
+		batch.Indexes = append(batch.Indexes, i)
+	}
+
+	if req.Action != nil {
+		loc, err := controller.userLocation(ctx, userId)
+		if err != nil {
+			return c.JSON(http.StatusInternalServerError, &models.ErrResponse{Msg: err.Error()})
+		}
+		filter, err := parseTodoFilter(&req.Action.Filter, time.Now(), loc)
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, &models.ErrResponse{Msg: err.Error()})
+		}
+		batch.Action, batch.Filter = req.Action.Action, filter
+	}
+
+	res, err := controller.todos.Batch(ctx, batch, userId)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, &models.ErrResponse{Msg: err.Error()})
+	}
+	res.Results = mergeBatchResults(res.Results, invalid)
+
+	if !res.Committed {
+		return c.JSON(http.StatusBadRequest, res)
+	}
+	return c.JSON(http.StatusOK, res)
+}
+
+func validateBatchOperation(c echo.Context, op *models.BatchOperation) error {
+	switch op.Op {
+	case models.BatchAdd:
+		if op.Todo == nil {
+			return fmt.Errorf("todo is required")
+		}
+		return c.Validate(&op.Todo.AddTodoRequest)
+	case models.BatchUpdate:
+		if op.Todo == nil {
+			return fmt.Errorf("todo is required")
+		}
+		return c.Validate(op.Todo)
+	case models.BatchDelete:
+		if op.Id == nil {
+			return fmt.Errorf("id is required")
+		}
+		return nil
+	}
+	return fmt.Errorf("unknown operation %q", op.Op)
+}
+
+// mergeBatchResults puts the results of the operations rejected before reaching the database
+// back in the order of the request
+func mergeBatchResults(results, invalid []models.BatchOperationResult) []models.BatchOperationResult {
+	merged := make([]models.BatchOperationResult, 0, len(results)+len(invalid))
+	for len(results) > 0 || len(invalid) > 0 {
+		if len(invalid) == 0 || len(results) > 0 && results[0].Index < invalid[0].Index {
+			merged = append(merged, results[0])
+			results = results[1:]
+		} else {
+			merged = append(merged, invalid[0])
+			invalid = invalid[1:]
+		}
+	}
+	return merged
+}
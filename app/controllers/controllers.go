@@ -1,12 +1,91 @@
 package controllers
 
+import (
+	"time"
+
+	"github.com/ann-96/todo-go-backend/app/tools"
+)
+
 type Settings struct {
-	Host    string
-	Port    string
+	Host string
+	Port string
+	// StorageDriver is postgres, sqlite or memory, see db.Open
+	StorageDriver string
+	// SqlitePath is the database file of the sqlite driver
+	SqlitePath string
+
 	SqlHost string
 	SqlPort string
 	SqlUser string
 	SqlPass string
 	SqlName string
-	JwtKey  string
+	// SqlDSN is a postgres connection string or URL used instead of the fields above
+	SqlDSN         string
+	SqlSSLMode     string
+	SqlSSLRootCert string
+	SqlSSLCert     string
+	SqlSSLKey      string
+
+	// the limits of the connection pool, zero keeps the database/sql defaults
+	SqlMaxOpenConns    int
+	SqlMaxIdleConns    int
+	SqlConnMaxLifetime time.Duration
+	SqlConnMaxIdleTime time.Duration
+	// SqlConnectRetries is how many more times the database is tried at startup, the waits
+	// double from SqlConnectBackoff
+	SqlConnectRetries int
+	SqlConnectBackoff time.Duration
+	// AutoMigrate applies the migrations at startup, without it the migrate subcommand has to
+	AutoMigrate bool
+	// JwtKey is the HS256 secret of the tokens when there are no Keys
+	JwtKey string
+	// Keys sign and verify the tokens, see tools.LoadKeyring
+	Keys *tools.Keyring
+
+	MaxPageSize int
+
+	// QueryTimeout is the deadline of the queries of a request, QueryTimeouts overrides it
+	// per route path
+	QueryTimeout  time.Duration
+	QueryTimeouts map[string]time.Duration
+
+	// TrashRetention is how long deleted todos stay in the trash, zero keeps them forever
+	TrashRetention     time.Duration
+	TrashPurgeInterval time.Duration
+	// TokenPruneInterval is how often the expired revoked tokens are forgotten
+	TokenPruneInterval time.Duration
+
+	AccessTokenTTL   time.Duration
+	RefreshTokenTTL  time.Duration
+	PasswordResetTTL time.Duration
+
+	// LoginLockoutThreshold failed logins lock the account for LoginLockoutDuration
+	LoginLockoutThreshold int
+	LoginLockoutDuration  time.Duration
+	// AdminToken authorizes the /admin routes, they are disabled when it is empty
+	AdminToken string
+
+	// Notifier delivers the password reset tokens, they are logged when it is nil
+	Notifier tools.Notifier
+}
+
+// MaxTokenTTL is the longest lifetime of the signed tokens, the access tokens and the login
+// challenges of the two factor authentication
+func (settings Settings) MaxTokenTTL() time.Duration {
+	ttl := settings.AccessTokenTTL
+	if ttl <= 0 {
+		ttl = defaultAccessTokenTTL
+	}
+	if ttl < twoFactorTokenTTL {
+		ttl = twoFactorTokenTTL
+	}
+	return ttl
+}
+
+// withKeys falls back to the JwtKey when no keyring is configured
+func (settings Settings) withKeys() Settings {
+	if settings.Keys == nil {
+		settings.Keys = tools.NewHMACKeyring(settings.JwtKey)
+	}
+	return settings
 }
@@ -2,25 +2,41 @@ package controllers_test
 
 import (
 	"bytes"
+	"context"
+	"crypto/ed25519"
+	crand "crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"database/sql"
+	"encoding/base64"
 	"encoding/json"
-	"errors"
-	"fmt"
+	"encoding/pem"
 	"math/rand"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/ann-96/todo-go-backend/app/controllers"
+	appdb "github.com/ann-96/todo-go-backend/app/db"
 	"github.com/ann-96/todo-go-backend/app/models"
+	"github.com/ann-96/todo-go-backend/app/tools"
 	echo "github.com/labstack/echo/v4"
 	"github.com/stretchr/testify/require"
 )
 
 const secretKey = "my-secret-key-my-secret-key-my-secret-key"
 
+var secretKeys = tools.NewHMACKeyring(secretKey)
+
 func TestRegisterAndLogin(t *testing.T) {
-	h, err := controllers.NewUserController(controllers.Settings{JwtKey: secretKey}, getMockSQL())
+	store := appdb.NewMemoryDB()
+	h, err := controllers.NewUserController(controllers.Settings{JwtKey: secretKey}, store, store)
 	require.NoError(t, err)
 
 	login, passw := "useruser", "Somepassw@1"
@@ -40,13 +56,16 @@ func TestRegisterAndLogin(t *testing.T) {
 	require.NoError(t, h.Login(c))
 	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
 
-	err = json.Unmarshal(rec.Body.Bytes(), &jwtToken)
+	tokens := models.TokenResponse{}
+	err = json.Unmarshal(rec.Body.Bytes(), &tokens)
 	require.NoError(t, err)
+	jwtToken = tokens.AccessToken
 }
 
 func TestLoginLength(t *testing.T) {
 
-	h, err := controllers.NewUserController(controllers.Settings{JwtKey: secretKey}, getMockSQL())
+	store := appdb.NewMemoryDB()
+	h, err := controllers.NewUserController(controllers.Settings{JwtKey: secretKey}, store, store)
 	require.NoError(t, err)
 
 	tooLongLogin := getRandomString(120)
@@ -84,7 +103,8 @@ func TestLoginLength(t *testing.T) {
 }
 
 func TestRegisterPasswordLength(t *testing.T) {
-	h, err := controllers.NewUserController(controllers.Settings{JwtKey: secretKey}, getMockSQL())
+	store := appdb.NewMemoryDB()
+	h, err := controllers.NewUserController(controllers.Settings{JwtKey: secretKey}, store, store)
 	require.NoError(t, err)
 
 	login := "validuser"
@@ -125,7 +145,8 @@ func TestRegisterPasswordLength(t *testing.T) {
 
 func TestRegisterLoginAlphanum(t *testing.T) {
 
-	h, err := controllers.NewUserController(controllers.Settings{JwtKey: secretKey}, getMockSQL())
+	store := appdb.NewMemoryDB()
+	h, err := controllers.NewUserController(controllers.Settings{JwtKey: secretKey}, store, store)
 	require.NoError(t, err)
 
 	login := "asdfasdf1@"
@@ -152,11 +173,11 @@ func TestRegisterLoginAlphanum(t *testing.T) {
 }
 
 func TestUpdateTodos(t *testing.T) {
-	mockSQL := getMockSQL()
+	store := appdb.NewMemoryDB()
 
-	userController, err := controllers.NewUserController(controllers.Settings{JwtKey: secretKey}, mockSQL)
+	userController, err := controllers.NewUserController(controllers.Settings{JwtKey: secretKey}, store, store)
 	require.NoError(t, err)
-	todoController, err := controllers.NewTodoController(controllers.Settings{JwtKey: secretKey}, mockSQL)
+	todoController, err := controllers.NewTodoController(controllers.Settings{JwtKey: secretKey}, store, store)
 	require.NoError(t, err)
 
 	login := "loginlogin"
@@ -176,6 +197,7 @@ func TestUpdateTodos(t *testing.T) {
 	addTodo := models.AddTodoRequest{
 		Text:      &todoText,
 		Completed: &todoCompleted,
+		Tags:      []string{},
 	}
 
 	newTodoText := getRandomString(300)
@@ -189,10 +211,12 @@ func TestUpdateTodos(t *testing.T) {
 	require.NoError(t, userController.Login(c))
 	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
 
-	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &jwtToken))
+	tokens := models.TokenResponse{}
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &tokens))
+	jwtToken = tokens.AccessToken
 
 	c, rec = getRequestContext(t, http.MethodPost, addTodo, userController.NewContext)
-	userId, err := controllers.TokenToUserID(jwtToken, secretKey)
+	userId, err := controllers.TokenToUserID(jwtToken, secretKeys)
 	require.NoError(t, err)
 	c.Set("userId", userId)
 
@@ -208,10 +232,11 @@ func TestUpdateTodos(t *testing.T) {
 		AddTodoRequest: models.AddTodoRequest{
 			Text:      &newTodoText,
 			Completed: &newTodoCompleted,
+			Tags:      []string{},
 		},
 	}
 	c, rec = getRequestContext(t, http.MethodPost, updateTodo, userController.NewContext)
-	userId, err = controllers.TokenToUserID(jwtToken, secretKey)
+	userId, err = controllers.TokenToUserID(jwtToken, secretKeys)
 	require.NoError(t, err)
 	c.Set("userId", userId)
 
@@ -220,17 +245,19 @@ func TestUpdateTodos(t *testing.T) {
 
 	resTodo := models.Todo{}
 	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resTodo))
-	require.Equal(t, updateTodo, resTodo)
+	require.Equal(t, updateTodo.Id, resTodo.Id)
+	require.Equal(t, updateTodo.AddTodoRequest, resTodo.AddTodoRequest)
+	require.False(t, resTodo.UpdatedAt.Before(*resTodo.CreatedAt))
 }
 
 func TestTodos(t *testing.T) {
 	// controllers
-	mockSQL := getMockSQL()
+	store := appdb.NewMemoryDB()
 
-	userController, err := controllers.NewUserController(controllers.Settings{JwtKey: secretKey}, mockSQL)
+	userController, err := controllers.NewUserController(controllers.Settings{JwtKey: secretKey}, store, store)
 	require.NoError(t, err)
 
-	todoController, err := controllers.NewTodoController(controllers.Settings{JwtKey: secretKey}, mockSQL)
+	todoController, err := controllers.NewTodoController(controllers.Settings{JwtKey: secretKey}, store, store)
 	require.NoError(t, err)
 
 	// requests
@@ -251,6 +278,7 @@ func TestTodos(t *testing.T) {
 	addTodo := models.AddTodoRequest{
 		Text:      &todoText,
 		Completed: &todoCompleted,
+		Tags:      []string{},
 	}
 
 	// register a user
@@ -264,11 +292,13 @@ func TestTodos(t *testing.T) {
 	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
 
 	// save session id for future use
-	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &jwtToken))
+	tokens := models.TokenResponse{}
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &tokens))
+	jwtToken = tokens.AccessToken
 
 	// create a todo entry
 	c, rec = getRequestContext(t, http.MethodPost, addTodo, userController.NewContext)
-	userId, err := controllers.TokenToUserID(jwtToken, secretKey)
+	userId, err := controllers.TokenToUserID(jwtToken, secretKeys)
 	require.NoError(t, err)
 	c.Set("userId", userId)
 
@@ -280,8 +310,727 @@ func TestTodos(t *testing.T) {
 	require.Equal(t, addTodo, resultTodo.AddTodoRequest)
 }
 
+func TestLogout(t *testing.T) {
+	s := newTestServer(t, controllers.Settings{})
+	s.register("logoutuser", "Passwd@jwklfnjknfkj1")
+
+	require.Equal(t, http.StatusOK, s.todo(http.MethodGet, "/todo/list", nil).Code)
+	require.Equal(t, http.StatusNoContent, s.user(http.MethodPost, "/users/logout", nil).Code)
+
+	// the token is rejected until it expires and is pruned
+	require.Equal(t, http.StatusUnauthorized, s.todo(http.MethodGet, "/todo/list", nil).Code)
+	require.Equal(t, http.StatusUnauthorized, s.user(http.MethodPost, "/users/logout", nil).Code)
+
+	pruned, err := s.store.PruneRevokedTokens(context.Background(), time.Now())
+	require.NoError(t, err)
+	require.Zero(t, pruned)
+	pruned, err = s.store.PruneRevokedTokens(context.Background(), time.Now().Add(31*24*time.Hour))
+	require.NoError(t, err)
+	require.Equal(t, 1, pruned)
+}
+
+func TestRefreshTokenRotation(t *testing.T) {
+	s := newTestServer(t, controllers.Settings{AccessTokenTTL: time.Minute})
+	login, passw := "refreshuser", "Passwd@jwklfnjknfkj1"
+	userId := s.register(login, passw)
+
+	session := s.session(login, passw)
+	require.Equal(t, 60, session.ExpiresIn)
+
+	claims, err := controllers.ParseToken(session.AccessToken, secretKeys)
+	require.NoError(t, err)
+	require.Equal(t, userId, claims.UserID)
+	require.InDelta(t, time.Now().Add(time.Minute).Unix(), claims.ExpiresAt, 5)
+
+	refresh := func(token string) (int, models.TokenResponse) {
+		rec := s.user(http.MethodPost, "/users/refresh", models.RefreshRequest{RefreshToken: &token})
+		res := models.TokenResponse{}
+		if rec.Code == http.StatusOK {
+			s.decode(rec, http.StatusOK, &res)
+		}
+		return rec.Code, res
+	}
+
+	code, rotated := refresh(session.RefreshToken)
+	require.Equal(t, http.StatusOK, code)
+	require.NotEqual(t, session.RefreshToken, rotated.RefreshToken)
+	refreshedUserId, err := controllers.TokenToUserID(rotated.AccessToken, secretKeys)
+	require.NoError(t, err)
+	require.Equal(t, userId, refreshedUserId)
+
+	// reusing a rotated token revokes the rest of its family
+	code, _ = refresh(session.RefreshToken)
+	require.Equal(t, http.StatusUnauthorized, code)
+	code, _ = refresh(rotated.RefreshToken)
+	require.Equal(t, http.StatusUnauthorized, code)
+
+	code, _ = refresh("unknown")
+	require.Equal(t, http.StatusUnauthorized, code)
+
+	// logging out with the refresh token revokes it too
+	session = s.session(login, passw)
+	rec := s.serve(s.users, http.MethodPost, "/users/logout", session.AccessToken, map[string]string{"refreshToken": session.RefreshToken})
+	require.Equal(t, http.StatusNoContent, rec.Code, rec.Body.String())
+
+	code, _ = refresh(session.RefreshToken)
+	require.Equal(t, http.StatusUnauthorized, code)
+}
+
+type mockNotifier struct {
+	resets map[string]string
+}
+
+func (n *mockNotifier) NotifyPasswordReset(login string, token string) error {
+	n.resets[login] = token
+	return nil
+}
+
+func TestPasswordChangeAndReset(t *testing.T) {
+	notifier := &mockNotifier{resets: map[string]string{}}
+	s := newTestServer(t, controllers.Settings{Notifier: notifier, LoginLockoutThreshold: 4, AdminToken: "admin-token"})
+	login, passw := "passwduser", "Passwd@jwklfnjknfkj1"
+	s.register(login, passw)
+
+	change := func(oldPassword, password, password2 string) int {
+		req := models.ChangePasswordRequest{OldPassword: &oldPassword, Password: &password, Password2: &password2}
+		return s.user(http.MethodPost, "/users/password/change", req).Code
+	}
+	forgot := func(login string) int {
+		return s.user(http.MethodPost, "/users/password/forgot", models.ForgotPasswordRequest{Login: &login}).Code
+	}
+	reset := func(token, password string) int {
+		req := models.ResetPasswordRequest{Token: &token, Password: &password, Password2: &password}
+		return s.user(http.MethodPost, "/users/password/reset", req).Code
+	}
+
+	// the wrong old passwords lock the account like failed logins do
+	newPassw := "NewPasswd@jwklfnjknfkj2"
+	weak := "password"
+	wrong := "wrong" + passw
+	for i := 0; i < 4; i++ {
+		require.Equal(t, http.StatusForbidden, change(wrong, newPassw, newPassw))
+	}
+	require.Equal(t, http.StatusTooManyRequests, change(passw, newPassw, newPassw))
+	require.Equal(t, http.StatusTooManyRequests, s.login(login, passw).Code)
+	s.unlock(models.UnlockRequest{Login: login})
+	require.Equal(t, http.StatusBadRequest, change(passw, weak, weak))
+	require.Equal(t, http.StatusBadRequest, change(passw, newPassw, passw))
+
+	// the change ends the access tokens issued before its second and the personal access tokens
+	pat := s.createAccessToken("backup", models.ScopeTodosRead, nil)
+	oldToken := s.token
+	require.Equal(t, http.StatusOK, s.serve(s.todos, http.MethodGet, "/todo/list", pat.Token, nil).Code)
+	time.Sleep(time.Until(time.Now().Truncate(time.Second).Add(time.Second)))
+
+	require.Equal(t, http.StatusNoContent, change(passw, newPassw, newPassw))
+	require.NotEqual(t, http.StatusOK, s.login(login, passw).Code)
+	s.token = s.session(login, newPassw).AccessToken
+	require.Equal(t, http.StatusOK, s.todo(http.MethodGet, "/todo/list", nil).Code)
+	require.Equal(t, http.StatusUnauthorized, s.serve(s.todos, http.MethodGet, "/todo/list", oldToken, nil).Code)
+	require.Equal(t, http.StatusUnauthorized, s.serve(s.todos, http.MethodGet, "/todo/list", pat.Token, nil).Code)
+
+	// unknown logins get the same answer but no token
+	require.Equal(t, http.StatusAccepted, forgot("nobody"))
+	require.Empty(t, notifier.resets)
+
+	require.Equal(t, http.StatusAccepted, forgot(strings.ToUpper(login)))
+	token := notifier.resets[login]
+	require.NotEmpty(t, token)
+
+	require.Equal(t, http.StatusBadRequest, reset(token, weak))
+	require.Equal(t, http.StatusNoContent, reset(token, passw))
+	require.Equal(t, http.StatusOK, s.login(login, passw).Code)
+
+	// the token can only be used once
+	require.Equal(t, http.StatusBadRequest, reset(token, newPassw))
+	require.Equal(t, http.StatusOK, s.login(login, passw).Code)
+}
+
+func TestTwoFactor(t *testing.T) {
+	// the SHA1 test vector of RFC 6238
+	code, err := tools.TOTPCode("GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ", time.Unix(59, 0))
+	require.NoError(t, err)
+	require.Equal(t, "287082", code)
+
+	s := newTestServer(t, controllers.Settings{})
+	login, passw := "totpuser", "Passwd@jwklfnjknfkj1"
+	s.register(login, passw)
+
+	codeAt := func(secret string, t0 time.Time) *string {
+		code, err := tools.TOTPCode(secret, t0)
+		require.NoError(t, err)
+		return &code
+	}
+
+	enrollment := models.TOTPEnrollment{}
+	s.decode(s.user(http.MethodPost, "/users/2fa/enroll", nil), http.StatusOK, &enrollment)
+	require.True(t, strings.HasPrefix(enrollment.URI, "otpauth://totp/todolist:totpuser?"), enrollment.URI)
+
+	wrong := "000000"
+	if *codeAt(enrollment.Secret, time.Now()) == wrong {
+		wrong = "111111"
+	}
+	require.Equal(t, http.StatusBadRequest, s.user(http.MethodPost, "/users/2fa/confirm", models.TwoFactorCodeRequest{Code: &wrong}).Code)
+	recovery := models.RecoveryCodes{}
+	s.decode(s.user(http.MethodPost, "/users/2fa/confirm", models.TwoFactorCodeRequest{Code: codeAt(enrollment.Secret, time.Now())}), http.StatusOK, &recovery)
+	require.Len(t, recovery.RecoveryCodes, 10)
+	require.Equal(t, http.StatusConflict, s.user(http.MethodPost, "/users/2fa/enroll", nil).Code)
+
+	// a login without a code gets a challenge whose token isn't an access token
+	challenge := models.TwoFactorChallenge{}
+	s.decode(s.login(login, passw), http.StatusUnauthorized, &challenge)
+	require.NotEmpty(t, challenge.TwoFactorToken)
+	_, err = controllers.ParseToken(challenge.TwoFactorToken, secretKeys)
+	require.Error(t, err)
+	require.Equal(t, http.StatusUnauthorized, s.serve(s.users, http.MethodPost, "/users/2fa/enroll", challenge.TwoFactorToken, nil).Code)
+
+	loginTwoFactor := func(code *string) *httptest.ResponseRecorder {
+		return s.user(http.MethodPost, "/users/login/2fa", models.LoginTwoFactorRequest{TwoFactorToken: &challenge.TwoFactorToken, Code: code})
+	}
+	loginWithCode := func(code string) *httptest.ResponseRecorder {
+		return s.user(http.MethodPost, "/users/login", models.LoginRequest{Login: &login, Password: &passw, Code: code})
+	}
+
+	// the code of the enrollment was used already
+	rec := loginTwoFactor(codeAt(enrollment.Secret, time.Now()))
+	require.Equal(t, http.StatusUnauthorized, rec.Code, rec.Body.String())
+	session := models.TokenResponse{}
+	s.decode(loginTwoFactor(codeAt(enrollment.Secret, time.Now().Add(30*time.Second))), http.StatusOK, &session)
+	require.NotEmpty(t, session.RefreshToken)
+	s.token = session.AccessToken
+
+	// neither the challenge nor a recovery code can be used twice
+	rec = loginTwoFactor(&recovery.RecoveryCodes[0])
+	require.Equal(t, http.StatusUnauthorized, rec.Code, rec.Body.String())
+	rec = loginWithCode(strings.ToUpper(recovery.RecoveryCodes[0]))
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	rec = loginWithCode(recovery.RecoveryCodes[0])
+	require.Equal(t, http.StatusUnauthorized, rec.Code, rec.Body.String())
+
+	// regenerating the codes invalidates the old ones
+	regenerated := models.RecoveryCodes{}
+	s.decode(s.user(http.MethodPost, "/users/2fa/recovery-codes", models.TwoFactorCodeRequest{Code: &recovery.RecoveryCodes[1]}), http.StatusOK, &regenerated)
+	rec = loginWithCode(recovery.RecoveryCodes[2])
+	require.Equal(t, http.StatusUnauthorized, rec.Code, rec.Body.String())
+
+	// a wrong password doesn't use up the code
+	wrongPassw := "wrong" + passw
+	require.Equal(t, http.StatusForbidden, s.user(http.MethodPost, "/users/me/delete",
+		models.DeleteAccountRequest{Password: &wrongPassw, Code: regenerated.RecoveryCodes[0]}).Code)
+	require.Equal(t, http.StatusForbidden, s.user(http.MethodPost, "/users/2fa/disable",
+		models.DisableTwoFactorRequest{Password: &wrongPassw, Code: &regenerated.RecoveryCodes[0]}).Code)
+	require.Equal(t, http.StatusNoContent, s.user(http.MethodPost, "/users/2fa/disable",
+		models.DisableTwoFactorRequest{Password: &passw, Code: &regenerated.RecoveryCodes[0]}).Code)
+	require.Equal(t, http.StatusOK, s.login(login, passw).Code)
+}
+
+func TestTwoFactorLockout(t *testing.T) {
+	s := newTestServer(t, controllers.Settings{LoginLockoutThreshold: 4, AdminToken: "admin-token"})
+	login, passw := "totplockeduser", "Passwd@jwklfnjknfkj1"
+	s.register(login, passw)
+
+	enrollment := models.TOTPEnrollment{}
+	s.decode(s.user(http.MethodPost, "/users/2fa/enroll", nil), http.StatusOK, &enrollment)
+	code, err := tools.TOTPCode(enrollment.Secret, time.Now())
+	require.NoError(t, err)
+	recovery := models.RecoveryCodes{}
+	s.decode(s.user(http.MethodPost, "/users/2fa/confirm", models.TwoFactorCodeRequest{Code: &code}), http.StatusOK, &recovery)
+
+	challenge := models.TwoFactorChallenge{}
+	s.decode(s.login(login, passw), http.StatusUnauthorized, &challenge)
+	loginTwoFactor := func(code string) *httptest.ResponseRecorder {
+		return s.user(http.MethodPost, "/users/login/2fa", models.LoginTwoFactorRequest{TwoFactorToken: &challenge.TwoFactorToken, Code: &code})
+	}
+
+	// the wrong codes lock the account, the password logins included
+	next, err := tools.TOTPCode(enrollment.Secret, time.Now().Add(30*time.Second))
+	require.NoError(t, err)
+	wrong := "000000"
+	if next == wrong {
+		wrong = "111111"
+	}
+	for i := 0; i < 4; i++ {
+		require.Equal(t, http.StatusUnauthorized, loginTwoFactor(wrong).Code)
+	}
+	require.Equal(t, http.StatusTooManyRequests, loginTwoFactor(next).Code)
+	require.Equal(t, http.StatusTooManyRequests, s.login(login, passw).Code)
+
+	// and the admin lifts the lockout
+	unlock := models.UnlockRequest{Login: login, IP: "192.0.2.1"}
+	s.unlock(unlock)
+	session := models.TokenResponse{}
+	s.decode(loginTwoFactor(next), http.StatusOK, &session)
+	s.token = session.AccessToken
+
+	// the codes of a session can't be guessed to replace the recovery codes or turn the second factor off
+	regenerate := func(code string) int {
+		return s.user(http.MethodPost, "/users/2fa/recovery-codes", models.TwoFactorCodeRequest{Code: &code}).Code
+	}
+	disable := func(password, code string) int {
+		return s.user(http.MethodPost, "/users/2fa/disable", models.DisableTwoFactorRequest{Password: &password, Code: &code}).Code
+	}
+	for i := 0; i < 4; i++ {
+		require.Equal(t, http.StatusUnauthorized, regenerate(wrong))
+	}
+	require.Equal(t, http.StatusTooManyRequests, regenerate(wrong))
+	s.unlock(unlock)
+	wrongPassw := "wrong" + passw
+	for i := 0; i < 2; i++ {
+		require.Equal(t, http.StatusForbidden, disable(wrongPassw, wrong))
+		require.Equal(t, http.StatusUnauthorized, disable(passw, wrong))
+	}
+	require.Equal(t, http.StatusTooManyRequests, disable(passw, wrong))
+	s.unlock(unlock)
+	require.Equal(t, http.StatusNoContent, disable(passw, recovery.RecoveryCodes[0]))
+}
+
+func TestAccessTokens(t *testing.T) {
+	s := newTestServer(t, controllers.Settings{})
+	s.register("patuser", "Passwd@jwklfnjknfkj1")
+
+	name, scope := "past", models.ScopeTodosRead
+	past := time.Now().Add(-time.Minute)
+	require.Equal(t, http.StatusBadRequest, s.user(http.MethodPost, "/users/tokens/create",
+		models.CreateAccessTokenRequest{Name: &name, Scope: &scope, ExpiresAt: &past}).Code)
+	invalidScope := "admin"
+	require.Equal(t, http.StatusBadRequest, s.user(http.MethodPost, "/users/tokens/create",
+		models.CreateAccessTokenRequest{Name: &name, Scope: &invalidScope}).Code)
+
+	readOnly := s.createAccessToken("backup", models.ScopeTodosRead, nil)
+	require.True(t, strings.HasPrefix(readOnly.Token, tools.AccessTokenPrefix))
+	expiresAt := time.Now().Add(time.Hour)
+	readWrite := s.createAccessToken("sync", models.ScopeTodosWrite, &expiresAt)
+
+	text := "from a script"
+	completed := false
+	addReq := models.AddTodoRequest{Text: &text, Completed: &completed}
+	require.Equal(t, http.StatusOK, s.serve(s.todos, http.MethodGet, "/todo/list", readOnly.Token, nil).Code)
+	require.Equal(t, http.StatusForbidden, s.serve(s.todos, http.MethodPost, "/todo/add", readOnly.Token, addReq).Code)
+	require.Equal(t, http.StatusOK, s.serve(s.todos, http.MethodPost, "/todo/add", readWrite.Token, addReq).Code)
+	require.Equal(t, http.StatusOK, s.todo(http.MethodPost, "/todo/add", addReq).Code)
+
+	// the tokens can't manage the account
+	require.Equal(t, http.StatusUnauthorized, s.serve(s.users, http.MethodPost, "/users/tokens/create", readWrite.Token, nil).Code)
+
+	rec := s.user(http.MethodGet, "/users/tokens/list", nil)
+	tokens := []models.AccessToken{}
+	s.decode(rec, http.StatusOK, &tokens)
+	require.Len(t, tokens, 2)
+	require.Equal(t, "backup", tokens[0].Name)
+	require.NotNil(t, tokens[0].LastUsedAt)
+	require.NotNil(t, tokens[1].ExpiresAt)
+	require.NotContains(t, rec.Body.String(), readOnly.Token)
+
+	require.Equal(t, http.StatusNoContent, s.user(http.MethodPost, "/users/tokens/revoke", models.RevokeAccessTokenRequest{Id: &readOnly.Id}).Code)
+	require.Equal(t, http.StatusNotFound, s.user(http.MethodPost, "/users/tokens/revoke", models.RevokeAccessTokenRequest{Id: &readOnly.Id}).Code)
+	require.Equal(t, http.StatusUnauthorized, s.serve(s.todos, http.MethodGet, "/todo/list", readOnly.Token, nil).Code)
+
+	soon := time.Now().Add(100 * time.Millisecond)
+	shortLived := s.createAccessToken("short", models.ScopeTodosRead, &soon)
+	require.Equal(t, http.StatusOK, s.serve(s.todos, http.MethodGet, "/todo/list", shortLived.Token, nil).Code)
+	time.Sleep(time.Until(soon))
+	require.Equal(t, http.StatusUnauthorized, s.serve(s.todos, http.MethodGet, "/todo/list", shortLived.Token, nil).Code)
+	require.Equal(t, http.StatusOK, s.serve(s.todos, http.MethodGet, "/todo/list", readWrite.Token, nil).Code)
+}
+
+func TestKeyRotation(t *testing.T) {
+	dir := t.TempDir()
+	writeKey := func(name string, key interface{}, public bool) {
+		var block *pem.Block
+		if public {
+			der, err := x509.MarshalPKIXPublicKey(key)
+			require.NoError(t, err)
+			block = &pem.Block{Type: "PUBLIC KEY", Bytes: der}
+		} else {
+			der, err := x509.MarshalPKCS8PrivateKey(key)
+			require.NoError(t, err)
+			block = &pem.Block{Type: "PRIVATE KEY", Bytes: der}
+		}
+		require.NoError(t, os.WriteFile(filepath.Join(dir, name+".pem"), pem.EncodeToMemory(block), 0600))
+	}
+	_, edKey, err := ed25519.GenerateKey(crand.Reader)
+	require.NoError(t, err)
+	rsaKey, err := rsa.GenerateKey(crand.Reader, 2048)
+	require.NoError(t, err)
+	writeKey("2022-01", edKey, false)
+
+	_, err = tools.LoadKeyring(dir, "2022-02", "", time.Time{})
+	require.Error(t, err)
+
+	loginWith := func(keys *tools.Keyring) *testServer {
+		s := newTestServer(t, controllers.Settings{Keys: keys})
+		s.register("keysuser", "Passwd@jwklfnjknfkj1")
+		return s
+	}
+
+	oldKeys, err := tools.LoadKeyring(dir, "2022-01", "", time.Time{})
+	require.NoError(t, err)
+	oldToken := loginWith(oldKeys).token
+	claims, err := controllers.ParseToken(oldToken, oldKeys)
+	require.NoError(t, err)
+	_, err = controllers.ParseToken(oldToken, secretKeys)
+	require.Error(t, err)
+
+	// a new key is published before it signs anything
+	writeKey("2022-02", rsaKey, false)
+	publishedKeys, err := tools.LoadKeyring(dir, "2022-01", "", time.Time{})
+	require.NoError(t, err)
+	jwks := models.JWKS{}
+	s := loginWith(publishedKeys)
+	s.decode(s.serve(s.users, http.MethodGet, "/.well-known/jwks.json", "", nil), http.StatusOK, &jwks)
+	require.Len(t, jwks.Keys, 2)
+	require.Equal(t, models.JWK{Kty: "OKP", Kid: "2022-01", Use: "sig", Alg: "EdDSA", Crv: "Ed25519",
+		X: base64.RawURLEncoding.EncodeToString(edKey.Public().(ed25519.PublicKey))}, jwks.Keys[0])
+	require.Equal(t, "RSA", jwks.Keys[1].Kty)
+	require.Equal(t, "RS256", jwks.Keys[1].Alg)
+	require.Equal(t, "AQAB", jwks.Keys[1].E)
+
+	// the new key signs while the old one, kept as a public key, still verifies
+	writeKey("2022-01", edKey.Public(), true)
+	newKeys, err := tools.LoadKeyring(dir, "2022-02", "", time.Time{})
+	require.NoError(t, err)
+	newToken := loginWith(newKeys).token
+	userId, err := controllers.TokenToUserID(newToken, newKeys)
+	require.NoError(t, err)
+	require.Equal(t, claims.UserID, userId)
+	_, err = controllers.TokenToUserID(newToken, oldKeys)
+	require.Error(t, err)
+	reparsed, err := controllers.ParseToken(oldToken, newKeys)
+	require.NoError(t, err)
+	require.Equal(t, claims.Id, reparsed.Id)
+
+	_, err = tools.LoadKeyring(dir, "2022-01", "", time.Time{})
+	require.Error(t, err, "a public key can't sign")
+
+	require.NoError(t, os.Remove(filepath.Join(dir, "2022-01.pem")))
+	retiredKeys, err := tools.LoadKeyring(dir, "2022-02", "", time.Time{})
+	require.NoError(t, err)
+	_, err = controllers.ParseToken(oldToken, retiredKeys)
+	require.Error(t, err)
+}
+
+func TestKeySwitchFromSecret(t *testing.T) {
+	dir := t.TempDir()
+	_, edKey, err := ed25519.GenerateKey(crand.Reader)
+	require.NoError(t, err)
+	der, err := x509.MarshalPKCS8PrivateKey(edKey)
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "2023-01.pem"), pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), 0600))
+
+	// the example secret of the repository is public
+	_, err = tools.LoadKeyring("", "", secretKey, time.Time{})
+	require.Error(t, err)
+	_, err = tools.LoadKeyring(dir, "2023-01", secretKey, time.Now().Add(time.Hour))
+	require.Error(t, err)
+	_, err = tools.LoadKeyring("", "", "", time.Time{})
+	require.Error(t, err)
+
+	// a token is issued with the secret before the switch
+	secret := "switch-secret-switch-secret-switch-secret"
+	hmacKeys, err := tools.LoadKeyring("", "", secret, time.Time{})
+	require.NoError(t, err)
+	s := newTestServer(t, controllers.Settings{Keys: hmacKeys})
+	login, passw := "switchuser", "Passwd@jwklfnjknfkj1"
+	userId := s.register(login, passw)
+	hmacToken := s.token
+
+	// and stays valid after it until the secret retires
+	settings := controllers.Settings{}
+	keys, err := tools.LoadKeyring(dir, "2023-01", secret, time.Now().Add(settings.MaxTokenTTL()))
+	require.NoError(t, err)
+	verified, err := controllers.TokenToUserID(hmacToken, keys)
+	require.NoError(t, err)
+	require.Equal(t, userId, verified)
+	settings.Keys = keys
+	switched := newStoreServer(t, settings, s.store)
+	rec := switched.serve(switched.todos, http.MethodGet, "/todo/list", hmacToken, nil)
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+
+	// the secret signs nothing and isn't published
+	_, err = controllers.TokenToUserID(switched.session(login, passw).AccessToken, hmacKeys)
+	require.Error(t, err)
+	require.Len(t, keys.JWKS().Keys, 1)
+
+	// the retirement is a point in time, loading the keys again doesn't push it back
+	retiresAt := time.Now().Add(20 * time.Millisecond)
+	retiring, err := tools.LoadKeyring(dir, "2023-01", secret, retiresAt)
+	require.NoError(t, err)
+	_, err = controllers.TokenToUserID(hmacToken, retiring)
+	require.NoError(t, err)
+	time.Sleep(30 * time.Millisecond)
+	_, err = controllers.TokenToUserID(hmacToken, retiring)
+	require.Error(t, err)
+	reloaded, err := tools.LoadKeyring(dir, "2023-01", secret, retiresAt)
+	require.NoError(t, err)
+	_, err = controllers.TokenToUserID(hmacToken, reloaded)
+	require.Error(t, err)
+
+	// without a retirement time the secret isn't kept at all
+	withoutRetirement, err := tools.LoadKeyring(dir, "2023-01", secret, time.Time{})
+	require.NoError(t, err)
+	_, err = controllers.TokenToUserID(hmacToken, withoutRetirement)
+	require.Error(t, err)
+}
+
+func TestLoginLockout(t *testing.T) {
+	policy := tools.AttemptPolicy{FreeAttempts: 2, BaseDelay: time.Second, MaxDelay: 5 * time.Second, LockoutAfter: 8, LockoutDuration: time.Hour}
+	delays := []time.Duration{}
+	for failures := 1; failures <= 8; failures++ {
+		delays = append(delays, policy.BlockFor(failures))
+	}
+	require.Equal(t, []time.Duration{0, 0, time.Second, 2 * time.Second, 4 * time.Second, 5 * time.Second, 5 * time.Second, time.Hour}, delays)
+
+	s := newTestServer(t, controllers.Settings{LoginLockoutThreshold: 4, LoginLockoutDuration: 15 * time.Minute, AdminToken: "admin-token"})
+	login, passw := "lockeduser", "Passwd@jwklfnjknfkj1"
+	s.register(login, passw)
+	s.register("otheruser", passw)
+
+	post := func(target string, token string, body interface{}) *httptest.ResponseRecorder {
+		req := newRequest(t, http.MethodPost, target, token, body)
+		// the forwarded address is ignored, the attempts are counted for the peer address
+		req.Header.Set(echo.HeaderXForwardedFor, getRandomString(8))
+		rec := httptest.NewRecorder()
+		s.users.ServeHTTP(rec, req)
+		return rec
+	}
+
+	wrong := "wrong" + passw
+	for i := 0; i < 4; i++ {
+		require.NotEqual(t, http.StatusOK, post("/users/login", "", models.LoginRequest{Login: &login, Password: &wrong}).Code)
+	}
+	rec := post("/users/login", "", models.LoginRequest{Login: &login, Password: &passw})
+	require.Equal(t, http.StatusTooManyRequests, rec.Code)
+	retryAfter, err := strconv.Atoi(rec.Header().Get(echo.HeaderRetryAfter))
+	require.NoError(t, err)
+	require.InDelta(t, 15*60, retryAfter, 5)
+
+	// the other accounts behind the IP aren't locked
+	other := "otheruser"
+	require.Equal(t, http.StatusOK, post("/users/login", "", models.LoginRequest{Login: &other, Password: &passw}).Code)
+
+	require.Equal(t, http.StatusUnauthorized, post("/admin/users/unlock", "wrong-token", models.UnlockRequest{Login: login}).Code)
+	require.Equal(t, http.StatusBadRequest, post("/admin/users/unlock", "admin-token", models.UnlockRequest{}).Code)
+	require.Equal(t, http.StatusNoContent, post("/admin/users/unlock", "admin-token", models.UnlockRequest{Login: strings.ToUpper(login)}).Code)
+	require.Equal(t, http.StatusOK, post("/users/login", "", models.LoginRequest{Login: &login, Password: &passw}).Code)
+
+	// probing for existing logins is slowed down too
+	registerReq := models.RegisterRequest{LoginRequest: models.LoginRequest{Login: &login, Password: &passw}, Password2: &passw}
+	for i := 0; i < 10; i++ {
+		require.Equal(t, http.StatusConflict, post("/users/register", "", registerReq).Code)
+	}
+	require.Equal(t, http.StatusConflict, post("/users/register", "", registerReq).Code)
+	require.Equal(t, http.StatusTooManyRequests, post("/users/register", "", registerReq).Code)
+	require.Equal(t, http.StatusNoContent, post("/admin/users/unlock", "admin-token", models.UnlockRequest{IP: "192.0.2.1"}).Code)
+	require.Equal(t, http.StatusConflict, post("/users/register", "", registerReq).Code)
+
+	// without an admin token there is no admin route
+	s = newStoreServer(t, controllers.Settings{}, s.store)
+	require.Equal(t, http.StatusNotFound, post("/admin/users/unlock", "", models.UnlockRequest{Login: login}).Code)
+}
+
+// mockPool is a store with a connection pool
+type mockPool struct {
+	appdb.Store
+}
+
+func (pool mockPool) Stats() sql.DBStats {
+	return sql.DBStats{MaxOpenConnections: 20, OpenConnections: 3, InUse: 1, Idle: 2, WaitCount: 4, WaitDuration: 1500 * time.Millisecond}
+}
+
+func TestPoolStats(t *testing.T) {
+	store := appdb.NewMemoryDB()
+	get := func(store appdb.Store, token string) *httptest.ResponseRecorder {
+		s := newStoreServer(t, controllers.Settings{AdminToken: "admin-token"}, store)
+		return s.serve(s.users, http.MethodGet, "/admin/db/stats", token, nil)
+	}
+
+	require.Equal(t, http.StatusUnauthorized, get(mockPool{store}, "wrong-token").Code)
+	require.Equal(t, http.StatusNotFound, get(store, "admin-token").Code)
+
+	rec := get(mockPool{store}, "admin-token")
+	require.Equal(t, http.StatusOK, rec.Code)
+	stats := models.PoolStats{}
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &stats))
+	require.Equal(t, models.PoolStats{MaxOpenConnections: 20, OpenConnections: 3, InUse: 1, Idle: 2, WaitCount: 4, WaitDurationMs: 1500}, stats)
+}
+
+func TestDeleteAccount(t *testing.T) {
+	s := newTestServer(t, controllers.Settings{LoginLockoutThreshold: 4, AdminToken: "admin-token"})
+	login, passw := "goneuser", "Passwd@jwklfnjknfkj1"
+	s.register(login, passw)
+	session := s.session(login, passw)
+	otherId := s.register("stayinguser", passw)
+	otherToken := s.token
+	s.token = session.AccessToken
+
+	deleteAccount := func(password string) *httptest.ResponseRecorder {
+		return s.user(http.MethodPost, "/users/me/delete", models.DeleteAccountRequest{Password: &password})
+	}
+
+	ids := []int{}
+	for _, text := range []string{"first todo", "second todo"} {
+		text := text
+		ids = append(ids, s.addTodo(models.AddTodoRequest{Text: &text, Tags: []string{"home"}}))
+	}
+	s.deleteTodo(ids[1])
+
+	rec := s.user(http.MethodGet, "/users/me/export", nil)
+	require.Contains(t, rec.Header().Get(echo.HeaderContentDisposition), "attachment")
+	export := struct {
+		models.UserExport
+		Todos []models.Todo `json:"todos"`
+	}{}
+	s.decode(rec, http.StatusOK, &export)
+	require.Equal(t, login, export.Profile.Login)
+	require.Len(t, export.Tags, 1)
+	require.Len(t, export.Todos, 2)
+	require.Equal(t, ids[0], *export.Todos[0].Id)
+	require.Nil(t, export.Todos[0].DeletedAt)
+	require.NotNil(t, export.Todos[1].DeletedAt)
+
+	// the wrong passwords lock the account like failed logins do
+	for i := 0; i < 4; i++ {
+		require.Equal(t, http.StatusForbidden, deleteAccount("wrong"+passw).Code)
+	}
+	rec = deleteAccount(passw)
+	require.Equal(t, http.StatusTooManyRequests, rec.Code)
+	require.NotEmpty(t, rec.Header().Get(echo.HeaderRetryAfter))
+	require.Equal(t, http.StatusTooManyRequests, s.login(login, passw).Code)
+	s.unlock(models.UnlockRequest{Login: login})
+	require.Equal(t, http.StatusNoContent, deleteAccount(passw).Code)
+
+	// every token of the user is gone, the other users keep theirs
+	require.Equal(t, http.StatusUnauthorized, s.todo(http.MethodGet, "/todo/list", nil).Code)
+	require.Equal(t, http.StatusUnauthorized, s.user(http.MethodPost, "/users/refresh", models.RefreshRequest{RefreshToken: &session.RefreshToken}).Code)
+	require.NotEqual(t, http.StatusOK, s.login(login, passw).Code)
+	require.Equal(t, http.StatusOK, s.serve(s.todos, http.MethodGet, "/todo/list", otherToken, nil).Code)
+	list, err := s.store.List(context.Background(), 0, 10, nil, otherId)
+	require.NoError(t, err)
+	require.Empty(t, list.List)
+
+	// the login is free again
+	s.register(login, passw)
+}
+
+func TestProfile(t *testing.T) {
+	s := newTestServer(t, controllers.Settings{})
+	userId := s.register("profileuser", "Passwd@jwklfnjknfkj1")
+
+	profile := func(body interface{}) models.UserProfile {
+		method := http.MethodPatch
+		if body == nil {
+			method = http.MethodGet
+		}
+		res := models.UserProfile{}
+		s.decode(s.user(method, "/users/me", body), http.StatusOK, &res)
+		return res
+	}
+
+	res := profile(nil)
+	require.Equal(t, userId, res.Id)
+	require.Equal(t, "profileuser", res.Login)
+	require.NotNil(t, res.LastLoginAt)
+	require.WithinDuration(t, time.Now(), res.CreatedAt, time.Minute)
+
+	for _, invalid := range []map[string]string{
+		{"timeZone": "Mars/Olympus_Mons"},
+		{"timeZone": "Local"},
+		{"email": "not an email"},
+		{"email": "Name <name@example.com>"},
+		{"locale": "not a locale"},
+	} {
+		require.Equal(t, http.StatusBadRequest, s.user(http.MethodPatch, "/users/me", invalid).Code, invalid)
+	}
+
+	name, email, locale, kiritimati := "Profile User", "user@example.com", "en-us", "Pacific/Kiritimati"
+	res = profile(models.UpdateProfileRequest{DisplayName: &name, Email: &email, Locale: &locale, TimeZone: &kiritimati})
+	require.Equal(t, name, res.DisplayName)
+	require.Equal(t, email, res.Email)
+	require.Equal(t, "en-US", res.Locale)
+	require.Equal(t, kiritimati, res.TimeZone)
+
+	// the fields left out are kept and an empty string clears a field
+	empty := ""
+	res = profile(models.UpdateProfileRequest{Email: &empty})
+	require.Equal(t, name, res.DisplayName)
+	require.Empty(t, res.Email)
+
+	// the plain dates of the filters are days of the user's time zone, UTC+14 here
+	kiritimatiLoc, err := time.LoadLocation(kiritimati)
+	require.NoError(t, err)
+	year, month, day := time.Now().In(kiritimatiLoc).Date()
+	due := time.Date(year, month, day, 12, 0, 0, 0, kiritimatiLoc)
+	s.addTodo(models.AddTodoRequest{Due: &due})
+
+	date := due.Format("2006-01-02")
+	dueToday := models.ListRequest{Start: "0", Count: "10", DueFrom: date, DueTo: date}
+	require.Len(t, s.list(dueToday).List, 1)
+
+	// the same day starts 25 hours later in UTC-11
+	pagoPago := "Pacific/Pago_Pago"
+	profile(models.UpdateProfileRequest{TimeZone: &pagoPago})
+	require.Empty(t, s.list(dueToday).List)
+}
+
+// slowStore delays List like a slow query, the context cuts it short
+type slowStore struct {
+	appdb.Store
+	latency time.Duration
+}
+
+func (store *slowStore) List(ctx context.Context, start int, count int, filter *models.TodoFilter, userId int) (*models.TodoList, error) {
+	select {
+	case <-time.After(store.latency):
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	return store.Store.List(ctx, start, count, filter, userId)
+}
+
+func TestQueryTimeout(t *testing.T) {
+	timeouts, err := controllers.ParseQueryTimeouts(" /todo/list=50ms, /todo/search=0,")
+	require.NoError(t, err)
+	require.Equal(t, map[string]time.Duration{"/todo/list": 50 * time.Millisecond, "/todo/search": 0}, timeouts)
+	for _, invalid := range []string{"/todo/list", "/todo/list=soon"} {
+		_, err := controllers.ParseQueryTimeouts(invalid)
+		require.Error(t, err, invalid)
+	}
+
+	s := newTestServer(t, controllers.Settings{})
+	s.register("timeoutuser", "Passwd@jwklfnjknfkj1")
+
+	list := func(slow *testServer, ctx context.Context) (*httptest.ResponseRecorder, time.Duration) {
+		req := newRequest(t, http.MethodGet, "/todo/list?start=0&count=10", s.token, nil).WithContext(ctx)
+		rec := httptest.NewRecorder()
+		started := time.Now()
+		slow.todos.ServeHTTP(rec, req)
+		return rec, time.Since(started)
+	}
+
+	// the timeout of the route cuts the slow query short
+	slow := &slowStore{Store: s.store, latency: 5 * time.Second}
+	rec, took := list(newStoreServer(t, controllers.Settings{QueryTimeouts: timeouts}, slow), context.Background())
+	require.Equal(t, http.StatusInternalServerError, rec.Code)
+	require.Contains(t, rec.Body.String(), context.DeadlineExceeded.Error())
+	require.Less(t, int64(took), int64(time.Second))
+
+	// and so does a client going away
+	withoutTimeouts := newStoreServer(t, controllers.Settings{}, slow)
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	rec, took = list(withoutTimeouts, ctx)
+	require.Equal(t, http.StatusInternalServerError, rec.Code)
+	require.Less(t, int64(took), int64(time.Second))
+
+	// a query within its deadline is answered
+	slow.latency = 10 * time.Millisecond
+	rec, _ = list(withoutTimeouts, context.Background())
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+}
+
 func TestRasswordComplexity(t *testing.T) {
-	h, err := controllers.NewUserController(controllers.Settings{JwtKey: secretKey}, getMockSQL())
+	store := appdb.NewMemoryDB()
+	h, err := controllers.NewUserController(controllers.Settings{JwtKey: secretKey}, store, store)
 	require.NoError(t, err)
 
 	login := "loginlogin"
@@ -308,7 +1057,8 @@ func TestRasswordComplexity(t *testing.T) {
 }
 
 func TestRasswordMatch(t *testing.T) {
-	h, err := controllers.NewUserController(controllers.Settings{JwtKey: secretKey}, getMockSQL())
+	store := appdb.NewMemoryDB()
+	h, err := controllers.NewUserController(controllers.Settings{JwtKey: secretKey}, store, store)
 	require.NoError(t, err)
 
 	login := "loginloginlogin"
@@ -335,7 +1085,8 @@ func TestRasswordMatch(t *testing.T) {
 }
 
 func TestLoginLetterCase(t *testing.T) {
-	h, err := controllers.NewUserController(controllers.Settings{JwtKey: secretKey}, getMockSQL())
+	store := appdb.NewMemoryDB()
+	h, err := controllers.NewUserController(controllers.Settings{JwtKey: secretKey}, store, store)
 	require.NoError(t, err)
 
 	login := "loginlogin"
@@ -369,133 +1120,614 @@ func TestLoginLetterCase(t *testing.T) {
 	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
 }
 
-type userIdType int
-type todoIdType int
-type mockSqlDB struct {
-	todos      map[userIdType]map[todoIdType]*models.Todo
-	nextTodoID todoIdType
-	users      map[userIdType]*models.LoginRequest
-	nextUserID userIdType
+func TestTodoDueFilter(t *testing.T) {
+	s := newTestServer(t, controllers.Settings{})
+	s.register("duedateuser", "Passwd@jwklfnjknfkj1")
+
+	now := time.Now()
+	yesterday := now.AddDate(0, 0, -1)
+	later := now.Add(time.Minute)
+	nextWeek := now.AddDate(0, 0, 7)
+	for _, due := range []*time.Time{&yesterday, &later, &nextWeek, nil} {
+		s.addTodo(models.AddTodoRequest{Due: due})
+	}
+
+	list := func(req models.ListRequest) models.TodoList {
+		req.Start, req.Count = "0", "10"
+		return s.list(req)
+	}
+
+	res := list(models.ListRequest{})
+	require.Equal(t, 4, res.Count)
+	require.Equal(t, 1, res.OverdueCount)
+
+	res = list(models.ListRequest{Due: models.DueOverdue})
+	require.Len(t, res.List, 1)
+	require.WithinDuration(t, yesterday, *res.List[0].Due, time.Microsecond)
+
+	res = list(models.ListRequest{DueFrom: now.Format("2006-01-02"), DueTo: nextWeek.Format("2006-01-02")})
+	require.Len(t, res.List, 2)
+
+	res = list(models.ListRequest{DueFrom: now.Format(time.RFC3339)})
+	require.Len(t, res.List, 2)
+
+	rec := s.todo(http.MethodGet, "/todo/list", models.ListRequest{Start: "0", Count: "10", Due: "someday"})
+	require.Equal(t, http.StatusBadRequest, rec.Code, rec.Body.String())
+	rec = s.todo(http.MethodGet, "/todo/list", models.ListRequest{Start: "0", Count: "10", DueTo: "tomorrow"})
+	require.Equal(t, http.StatusBadRequest, rec.Code, rec.Body.String())
 }
 
-var (
-	jwtToken string
-)
+func TestTodoTags(t *testing.T) {
+	s := newTestServer(t, controllers.Settings{})
+	s.register("taguser", "Passwd@jwklfnjknfkj1")
+
+	// a tag created explicitly
+	work := "work"
+	rec := s.todo(http.MethodPost, "/todo/tags/add", models.AddTagRequest{Name: &work})
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	rec = s.todo(http.MethodPost, "/todo/tags/add", models.AddTagRequest{Name: &work})
+	require.Equal(t, http.StatusConflict, rec.Code, rec.Body.String())
+
+	// tags created by attaching them to todos
+	ids := []int{}
+	for _, tags := range [][]string{{"work", "urgent"}, {"work"}, {"home", "urgent", "urgent"}} {
+		ids = append(ids, s.addTodo(models.AddTodoRequest{Tags: tags}))
+	}
+
+	tags := []models.Tag{}
+	s.decode(s.todo(http.MethodGet, "/todo/tags/list", nil), http.StatusOK, &tags)
+	require.Len(t, tags, 3)
 
-func getMockSQL() *mockSqlDB {
-	return &mockSqlDB{
-		todos: make(map[userIdType]map[todoIdType]*models.Todo),
-		users: make(map[userIdType]*models.LoginRequest),
+	list := func(req models.ListRequest) []models.Todo {
+		req.Start, req.Count = "0", "10"
+		return s.list(req).List
 	}
+
+	require.Len(t, list(models.ListRequest{Tags: []string{"work", "home"}}), 3)
+	require.Len(t, list(models.ListRequest{Tags: []string{"work", "urgent"}, TagMode: models.TagModeAll}), 1)
+	require.Len(t, list(models.ListRequest{Tags: []string{"urgent"}}), 2)
+
+	// detach every tag from the last todo
+	text := getRandomString(10)
+	completed := false
+	rec = s.todo(http.MethodPost, "/todo/update", models.Todo{Id: &ids[2], AddTodoRequest: models.AddTodoRequest{Text: &text, Completed: &completed, Tags: []string{}}})
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	require.Len(t, list(models.ListRequest{Tags: []string{"urgent"}}), 1)
+
+	// a deleted tag is detached from its todos
+	for _, tag := range tags {
+		if *tag.Name == work {
+			rec = s.todo(http.MethodPost, "/todo/tags/delete", map[string]int{"id": *tag.Id})
+			require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+
+			// a missing tag is not found
+			rec = s.todo(http.MethodPost, "/todo/tags/delete", map[string]int{"id": *tag.Id})
+			require.Equal(t, http.StatusNotFound, rec.Code, rec.Body.String())
+		}
+	}
+	require.Len(t, list(models.ListRequest{Tags: []string{work}}), 0)
 }
 
-func (db *mockSqlDB) Update(input *models.Todo, userId int) (*models.Todo, error) {
-	_, ok := db.users[userIdType(userId)]
-	if !ok {
-		return nil, fmt.Errorf("the user id %v is not found", userId)
+func TestTodoLists(t *testing.T) {
+	s := newTestServer(t, controllers.Settings{})
+	s.register("listuser", "Passwd@jwklfnjknfkj1")
+
+	addList := func(name string) int {
+		list := models.List{}
+		s.decode(s.todo(http.MethodPost, "/todo/lists/add", models.AddListRequest{Name: &name}), http.StatusOK, &list)
+		return *list.Id
+	}
+	count := func(listId string) int {
+		return s.list(models.ListRequest{Start: "0", Count: "10", ListId: listId}).Count
 	}
 
-	todo, ok := db.todos[userIdType(userId)][todoIdType(*input.Id)]
-	if !ok {
-		return nil, errors.New("entry not found for the user")
+	work, home := addList("work"), addList("home")
+	s.addTodo(models.AddTodoRequest{})
+	s.addTodo(models.AddTodoRequest{ListId: &work})
+	movedTodo := s.addTodo(models.AddTodoRequest{ListId: &work})
+	s.addTodo(models.AddTodoRequest{ListId: &home})
+
+	require.Equal(t, 1, count(models.ListInbox))
+	require.Equal(t, 2, count(strconv.Itoa(work)))
+
+	rec := s.todo(http.MethodPost, "/todo/lists/move", models.MoveTodoRequest{Id: &movedTodo, ListId: &home})
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	require.Equal(t, 1, count(strconv.Itoa(work)))
+	require.Equal(t, 2, count(strconv.Itoa(home)))
+
+	// the todos of a deleted list are moved to the inbox unless the deletion cascades
+	rec = s.todo(http.MethodPost, "/todo/lists/delete", models.DeleteListRequest{Id: work})
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	require.Equal(t, 2, count(models.ListInbox))
+
+	rec = s.todo(http.MethodPost, "/todo/lists/delete", models.DeleteListRequest{Id: home, Cascade: true})
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	require.Equal(t, 2, count(""))
+
+	rec = s.todo(http.MethodGet, "/todo/lists/list", nil)
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	require.Equal(t, "[]\n", rec.Body.String())
+
+	// a todo can't be added to a list that doesn't exist
+	text := getRandomString(10)
+	completed := false
+	rec = s.todo(http.MethodPost, "/todo/add", models.AddTodoRequest{Text: &text, Completed: &completed, ListId: &work})
+	require.NotEqual(t, http.StatusOK, rec.Code, rec.Body.String())
+}
+
+func TestSubtasks(t *testing.T) {
+	s := newTestServer(t, controllers.Settings{})
+	s.register("subtaskuser", "Passwd@jwklfnjknfkj1")
+
+	done := true
+	list := func(view string) models.TodoList {
+		return s.list(models.ListRequest{Start: "0", Count: "10", View: view})
 	}
 
-	if input.Completed != nil {
-		todo.Completed = input.Completed
+	// parent -> (step1 -> step1a, step2), other
+	parent := s.addTodo(models.AddTodoRequest{})
+	step1 := s.addTodo(models.AddTodoRequest{ParentId: &parent})
+	s.addTodo(models.AddTodoRequest{ParentId: &step1, Completed: &done})
+	s.addTodo(models.AddTodoRequest{ParentId: &parent})
+	s.addTodo(models.AddTodoRequest{})
+
+	require.Equal(t, 5, list("").Count)
+
+	tree := list(models.ViewTree)
+	require.Equal(t, 2, tree.Count)
+	require.Len(t, tree.List, 2)
+	require.Len(t, tree.List[0].Children, 2)
+	require.Len(t, tree.List[0].Children[0].Children, 1)
+	require.Equal(t, models.Progress{Done: 1, Total: 3}, *tree.List[0].Progress)
+	require.Equal(t, models.Progress{Done: 1, Total: 1}, *tree.List[0].Children[0].Progress)
+	require.Nil(t, tree.List[1].Progress)
+
+	flat := list(models.ViewFlat)
+	require.Len(t, flat.List, 5)
+	depths := []int{}
+	for _, todo := range flat.List {
+		depths = append(depths, *todo.Depth)
 	}
-	if input.Text != nil {
-		todo.Text = input.Text
+	require.Equal(t, []int{0, 1, 2, 1, 0}, depths)
+
+	// completing the parent completes all of its descendants
+	text := getRandomString(10)
+	rec := s.todo(http.MethodPost, "/todo/update", models.Todo{Id: &parent, CompleteChildren: true, AddTodoRequest: models.AddTodoRequest{Text: &text, Completed: &done}})
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	require.Equal(t, models.Progress{Done: 3, Total: 3}, *list(models.ViewTree).List[0].Progress)
+
+	// deleting the parent deletes the subtree
+	s.deleteTodo(parent)
+	require.Equal(t, 1, list("").Count)
+}
+
+func TestListCursor(t *testing.T) {
+	s := newTestServer(t, controllers.Settings{MaxPageSize: 3})
+	s.register("cursoruser", "Passwd@jwklfnjknfkj1")
+
+	for i := 0; i < 7; i++ {
+		completed := i%2 == 0
+		s.addTodo(models.AddTodoRequest{Completed: &completed})
 	}
 
-	return todo, nil
+	// the page size is capped by the server
+	first := s.list(models.ListRequest{Count: "50"})
+	require.Equal(t, 7, first.Count)
+	require.Equal(t, 4, first.CompletedCount)
+	require.Len(t, first.List, 3)
+	require.Empty(t, first.PrevCursor)
+	require.NotEmpty(t, first.NextCursor)
+
+	second := s.list(models.ListRequest{Cursor: first.NextCursor})
+	third := s.list(models.ListRequest{Cursor: second.NextCursor})
+	require.Len(t, third.List, 1)
+	require.Empty(t, third.NextCursor)
+
+	all := append(append(todoIds(first), todoIds(second)...), todoIds(third)...)
+	require.Len(t, all, 7)
+	require.True(t, sort.IntsAreSorted(all))
+
+	// going back returns the same page
+	require.Equal(t, todoIds(second), todoIds(s.list(models.ListRequest{Cursor: third.PrevCursor})))
+	require.Equal(t, todoIds(first), todoIds(s.list(models.ListRequest{Cursor: second.PrevCursor})))
+
+	// the offset mode still works
+	require.Equal(t, todoIds(second), todoIds(s.list(models.ListRequest{Start: "3", Count: "3"})))
+
+	rec := s.todo(http.MethodGet, "/todo/list", models.ListRequest{Cursor: "not a cursor"})
+	require.Equal(t, http.StatusBadRequest, rec.Code, rec.Body.String())
+
+	// a tampered cursor is refused before its value reaches the store
+	for _, cursor := range []models.Cursor{
+		{Id: 1, Sort: models.SortCreated, Value: "yesterday"},
+		{Id: 1, Sort: models.SortCompleted, Value: "maybe"},
+		{Id: 1, Sort: models.SortPosition, Value: "1.5"},
+		{Id: 1, Sort: models.SortId, Value: "99999999999"},
+		{Id: -1, Sort: models.SortText, Value: "text"},
+	} {
+		rec := s.todo(http.MethodGet, "/todo/list", models.ListRequest{Sort: cursor.Sort, Cursor: cursor.Encode()})
+		require.Equal(t, http.StatusBadRequest, rec.Code, rec.Body.String())
+		require.Contains(t, rec.Body.String(), "invalid cursor")
+	}
 }
 
-func (db *mockSqlDB) List(start int, count int, userId int) (*models.TodoList, error) {
-	todosCount := len(db.todos[userIdType(userId)])
-	if todosCount == 0 || todosCount < start+count {
-		return nil, nil
+func TestListSortAndFilter(t *testing.T) {
+	s := newTestServer(t, controllers.Settings{})
+	s.register("sortuser", "Passwd@jwklfnjknfkj1")
+
+	for i, text := range []string{"buy milk", "Call mom", "buy bread", "walk the dog"} {
+		text := text
+		completed := i%2 == 1
+		s.addTodo(models.AddTodoRequest{Text: &text, Completed: &completed})
 	}
-	completedCount := 0
-	for i := range db.todos[userIdType(userId)] {
-		if *db.todos[userIdType(userId)][i].Completed {
-			completedCount++
-		}
+
+	require.Equal(t, []string{"walk the dog", "buy milk", "buy bread", "Call mom"},
+		todoTexts(s.list(models.ListRequest{Start: "0", Count: "10", Sort: models.SortText, Order: "desc"})))
+	require.Equal(t, []string{"buy milk", "buy bread"},
+		todoTexts(s.list(models.ListRequest{Start: "0", Count: "10", Completed: "false", Query: "BUY"})))
+	require.Equal(t, []string{"Call mom", "walk the dog"},
+		todoTexts(s.list(models.ListRequest{Start: "0", Count: "10", Completed: "true"})))
+
+	// keyset pages follow the sort order
+	first := s.list(models.ListRequest{Count: "2", Sort: models.SortText})
+	require.Equal(t, []string{"buy milk", "walk the dog"},
+		todoTexts(s.list(models.ListRequest{Count: "2", Sort: models.SortText, Cursor: first.NextCursor})))
+
+	// a cursor can't be reused with another sort order
+	rec := s.todo(http.MethodGet, "/todo/list", models.ListRequest{Cursor: first.NextCursor, Sort: models.SortUpdated})
+	require.Equal(t, http.StatusBadRequest, rec.Code, rec.Body.String())
+
+	for _, req := range []models.ListRequest{
+		{Start: "0", Count: "10", Sort: "task; DROP TABLE todos"},
+		{Start: "0", Count: "10", Order: "sideways"},
+		{Start: "0", Count: "10", Completed: "maybe"},
+	} {
+		rec := s.todo(http.MethodGet, "/todo/list", req)
+		require.Equal(t, http.StatusBadRequest, rec.Code, rec.Body.String())
+	}
+}
+
+func TestReorder(t *testing.T) {
+	s := newTestServer(t, controllers.Settings{})
+	s.register("reorderuser", "Passwd@jwklfnjknfkj1")
+
+	ids := map[string]int{}
+	for _, text := range []string{"first", "second", "third"} {
+		text := text
+		ids[text] = s.addTodo(models.AddTodoRequest{Text: &text})
 	}
 
-	res := models.TodoList{
-		Count:          todosCount,
-		CompletedCount: completedCount,
-		List:           make([]models.Todo, 0, count),
+	move := func(req models.ReorderTodoRequest) int {
+		return s.todo(http.MethodPost, "/todo/move", req).Code
 	}
+	texts := func() []string {
+		return todoTexts(s.list(models.ListRequest{}))
+	}
+
+	require.Equal(t, []string{"first", "second", "third"}, texts())
+
+	third, first, second := ids["third"], ids["first"], ids["second"]
+	require.Equal(t, http.StatusOK, move(models.ReorderTodoRequest{Id: &third, Before: &first}))
+	require.Equal(t, []string{"third", "first", "second"}, texts())
+
+	require.Equal(t, http.StatusOK, move(models.ReorderTodoRequest{Id: &third, After: &second}))
+	require.Equal(t, []string{"first", "second", "third"}, texts())
+
+	missing := 1000
+	require.Equal(t, http.StatusBadRequest, move(models.ReorderTodoRequest{Id: &third, Before: &missing}))
+	require.Equal(t, http.StatusBadRequest, move(models.ReorderTodoRequest{Id: &third}))
+	require.Equal(t, http.StatusBadRequest, move(models.ReorderTodoRequest{Id: &third, Before: &first, After: &second}))
+	require.Equal(t, http.StatusBadRequest, move(models.ReorderTodoRequest{Id: &third, After: &third}))
+}
 
-	counter := 0
-	for i := range db.todos[userIdType(userId)] {
-		if counter < start {
-			counter++
-			continue
+func TestTrash(t *testing.T) {
+	s := newTestServer(t, controllers.Settings{})
+	userId := s.register("trashuser", "Passwd@jwklfnjknfkj1")
+
+	restore := func(id int) int {
+		return s.todo(http.MethodPost, "/todo/trash/restore", models.RestoreTodoRequest{Id: &id}).Code
+	}
+	count := func() (int, int) {
+		list, err := s.store.List(context.Background(), 0, 10, nil, userId)
+		require.NoError(t, err)
+
+		trash := models.TodoList{}
+		s.decode(s.todo(http.MethodGet, "/todo/trash/list", models.TrashRequest{}), http.StatusOK, &trash)
+		for _, todo := range trash.List {
+			require.NotNil(t, todo.DeletedAt)
 		}
-		if counter >= start+count {
-			counter++
-			break
+		return list.Count, trash.Count
+	}
+
+	parent := s.addTodo(models.AddTodoRequest{})
+	child := s.addTodo(models.AddTodoRequest{ParentId: &parent})
+	other := s.addTodo(models.AddTodoRequest{})
+
+	// deleting the parent trashes its subtasks too, restoring it brings them back
+	s.deleteTodo(parent)
+	live, trashed := count()
+	require.Equal(t, []int{1, 2}, []int{live, trashed})
+	require.Equal(t, http.StatusOK, restore(parent))
+	live, trashed = count()
+	require.Equal(t, []int{3, 0}, []int{live, trashed})
+
+	// a subtask trashed on its own stays in the trash when its parent is restored
+	s.deleteTodo(child)
+	s.deleteTodo(parent)
+	require.Equal(t, http.StatusOK, restore(parent))
+	live, trashed = count()
+	require.Equal(t, []int{2, 1}, []int{live, trashed})
+	require.Equal(t, http.StatusOK, restore(child))
+	require.Equal(t, http.StatusNotFound, restore(child))
+
+	s.deleteTodo(other)
+	rec := s.todo(http.MethodPost, "/todo/trash/empty", nil)
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	require.JSONEq(t, `{"deleted":1}`, rec.Body.String())
+	require.Equal(t, http.StatusNotFound, restore(other))
+
+	// the purger only removes the todos trashed before the retention period
+	s.deleteTodo(child)
+	purged, err := s.store.PurgeTrash(context.Background(), time.Now().Add(-time.Hour))
+	require.NoError(t, err)
+	require.Zero(t, purged)
+	purged, err = s.store.PurgeTrash(context.Background(), time.Now().Add(time.Second))
+	require.NoError(t, err)
+	require.Equal(t, 1, purged)
+}
+
+func TestSearch(t *testing.T) {
+	s := newTestServer(t, controllers.Settings{})
+	s.register("othersearchuser", "Passwd@jwklfnjknfkj1")
+	bug := "Report the bug"
+	s.addTodo(models.AddTodoRequest{Text: &bug})
+
+	s.register("searchuser", "Passwd@jwklfnjknfkj1")
+	for _, text := range []string{"Prepare the quarterly report", "Send the report to the team lead", "Water the plants"} {
+		text := text
+		s.addTodo(models.AddTodoRequest{Text: &text})
+	}
+
+	search := func(q string) (int, models.SearchResult) {
+		rec := s.todo(http.MethodGet, "/todo/search", models.SearchRequest{Query: q})
+		res := models.SearchResult{}
+		if rec.Code == http.StatusOK {
+			s.decode(rec, http.StatusOK, &res)
 		}
-		res.List = append(res.List, *db.todos[userIdType(userId)][i])
-		counter++
+		return rec.Code, res
 	}
 
-	return &res, nil
+	code, res := search("rep")
+	require.Equal(t, http.StatusOK, code)
+	require.Len(t, res.List, 2)
+
+	code, res = search("REPORT & team:*")
+	require.Equal(t, http.StatusOK, code)
+	require.Len(t, res.List, 1)
+	require.Equal(t, "Send the <mark>report</mark> to the <mark>team</mark> lead", res.List[0].Snippet)
+
+	code, _ = search("&|!")
+	require.Equal(t, http.StatusBadRequest, code)
 }
 
-func (db *mockSqlDB) Add(input *models.AddTodoRequest, userId int) (*models.Todo, error) {
-	if db.todos[userIdType(userId)] == nil {
-		db.todos[userIdType(userId)] = make(map[todoIdType]*models.Todo)
+func TestBatch(t *testing.T) {
+	s := newTestServer(t, controllers.Settings{})
+	userId := s.register("batchuser", "Passwd@jwklfnjknfkj1")
+
+	batch := func(req models.BatchRequest) (int, models.BatchResult) {
+		rec := s.todo(http.MethodPost, "/todo/batch", req)
+		res := models.BatchResult{}
+		_ = json.Unmarshal(rec.Body.Bytes(), &res)
+		return rec.Code, res
 	}
-	id := int(db.nextTodoID)
-	db.todos[userIdType(userId)][db.nextTodoID] = &models.Todo{
-		Id:             &id,
-		AddTodoRequest: *input,
+	addOp := func(text string, completed bool) models.BatchOperation {
+		return models.BatchOperation{Op: models.BatchAdd, Todo: &models.Todo{
+			AddTodoRequest: models.AddTodoRequest{Text: &text, Completed: &completed},
+		}}
+	}
+	listCount := func() int {
+		list, err := s.store.List(context.Background(), 0, 100, nil, userId)
+		require.NoError(t, err)
+		return list.Count
 	}
-	defer func() { db.nextTodoID++ }()
 
-	return db.todos[userIdType(userId)][db.nextTodoID], nil
+	code, res := batch(models.BatchRequest{Operations: []models.BatchOperation{
+		addOp("buy milk", false),
+		addOp("call mom", true),
+		addOp("walk the dog", true),
+	}})
+	require.Equal(t, http.StatusOK, code)
+	require.True(t, res.Committed)
+	require.Len(t, res.Results, 3)
+	require.Equal(t, 3, listCount())
+
+	// a failed operation rolls back the whole atomic batch
+	missing := 1000
+	code, res = batch(models.BatchRequest{Operations: []models.BatchOperation{
+		addOp("water the plants", false),
+		{Op: models.BatchDelete, Id: &missing},
+	}})
+	require.Equal(t, http.StatusBadRequest, code)
+	require.False(t, res.Committed)
+	require.Equal(t, 3, listCount())
+
+	// the best effort mode skips invalid and failed operations
+	code, res = batch(models.BatchRequest{Mode: models.BatchModeBestEffort, Operations: []models.BatchOperation{
+		{Op: models.BatchUpdate},
+		{Op: models.BatchDelete, Id: &missing},
+		addOp("water the plants", false),
+	}})
+	require.Equal(t, http.StatusOK, code)
+	require.True(t, res.Committed)
+	require.Len(t, res.Results, 3)
+	for i, result := range res.Results {
+		require.Equal(t, i, result.Index)
+		require.Equal(t, i == 2, result.Ok, result.Error)
+	}
+	require.Equal(t, 4, listCount())
+
+	// the action deletes all completed todos
+	code, res = batch(models.BatchRequest{Action: &models.BatchAction{
+		Action: models.BatchActionDelete,
+		Filter: models.ListRequest{Completed: "true"},
+	}})
+	require.Equal(t, http.StatusOK, code)
+	require.Equal(t, 2, res.Affected)
+	require.Equal(t, 2, listCount())
+
+	code, _ = batch(models.BatchRequest{})
+	require.Equal(t, http.StatusBadRequest, code)
 }
 
-func (db *mockSqlDB) Delete(id int, userID int) error {
-	delete(db.todos[userIdType(userID)], todoIdType(id))
+// testServer serves the user and todo routes of one store, the requests go out with the access
+// token of the user logged in last
+type testServer struct {
+	t     *testing.T
+	store appdb.Store
+	keys  *tools.Keyring
+	users http.Handler
+	todos http.Handler
+	token string
+}
 
-	return nil
+// newTestServer serves a new memory store, signing with secretKey unless the settings have keys
+func newTestServer(t *testing.T, settings controllers.Settings) *testServer {
+	return newStoreServer(t, settings, appdb.NewMemoryDB())
 }
 
-func (db *mockSqlDB) Register(input *models.RegisterRequest) error {
-	exists := false
-	for i := range db.users {
-		if *db.users[i].Login == *input.Login && *db.users[i].Password == *input.Password {
-			exists = true
-		}
+func newStoreServer(t *testing.T, settings controllers.Settings, store appdb.Store) *testServer {
+	if settings.Keys == nil && settings.JwtKey == "" {
+		settings.JwtKey = secretKey
 	}
-	if exists {
-		return fmt.Errorf(`pq: duplicate key value violates unique constraint "users_login_key"`)
+	users, err := controllers.NewUserController(settings, store, store)
+	require.NoError(t, err)
+	todos, err := controllers.NewTodoController(settings, store, store)
+	require.NoError(t, err)
+
+	keys := settings.Keys
+	if keys == nil {
+		keys = tools.NewHMACKeyring(settings.JwtKey)
 	}
-	db.users[db.nextUserID] = &input.LoginRequest
-	db.nextUserID++
-	return nil
+	return &testServer{t: t, store: store, keys: keys, users: users, todos: todos}
 }
 
-func (db *mockSqlDB) Login(input *models.LoginRequest) (userIdType *int, err error) {
-	for i := range db.users {
-		if *db.users[i].Login == *input.Login && *db.users[i].Password == *input.Password {
-			userIdType = (*int)(&i)
-		}
+// register adds a user and logs them in for the next requests
+func (s *testServer) register(login, passw string) int {
+	registerReq := models.RegisterRequest{LoginRequest: models.LoginRequest{Login: &login, Password: &passw}, Password2: &passw}
+	rec := s.serve(s.users, http.MethodPost, "/users/register", "", registerReq)
+	require.Equal(s.t, http.StatusCreated, rec.Code, rec.Body.String())
+
+	s.token = s.session(login, passw).AccessToken
+	userId, err := controllers.TokenToUserID(s.token, s.keys)
+	require.NoError(s.t, err)
+	return userId
+}
+
+func (s *testServer) login(login, passw string) *httptest.ResponseRecorder {
+	return s.serve(s.users, http.MethodPost, "/users/login", "", models.LoginRequest{Login: &login, Password: &passw})
+}
+
+// session logs in without changing the user of the next requests
+func (s *testServer) session(login, passw string) models.TokenResponse {
+	tokens := models.TokenResponse{}
+	s.decode(s.login(login, passw), http.StatusOK, &tokens)
+	return tokens
+}
+
+// unlock lifts the lockouts with the admin token of the tests
+func (s *testServer) unlock(req models.UnlockRequest) {
+	rec := s.serve(s.users, http.MethodPost, "/admin/users/unlock", "admin-token", req)
+	require.Equal(s.t, http.StatusNoContent, rec.Code, rec.Body.String())
+}
+
+// serve sends the body as JSON to the handler with the token
+func (s *testServer) serve(handler http.Handler, method, target, token string, body interface{}) *httptest.ResponseRecorder {
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, newRequest(s.t, method, target, token, body))
+	return rec
+}
+
+func (s *testServer) user(method, target string, body interface{}) *httptest.ResponseRecorder {
+	return s.serve(s.users, method, target, s.token, body)
+}
+
+func (s *testServer) todo(method, target string, body interface{}) *httptest.ResponseRecorder {
+	return s.serve(s.todos, method, target, s.token, body)
+}
+
+// decode checks the status of the response and decodes its body into res
+func (s *testServer) decode(rec *httptest.ResponseRecorder, status int, res interface{}) {
+	require.Equal(s.t, status, rec.Code, rec.Body.String())
+	require.NoError(s.t, json.Unmarshal(rec.Body.Bytes(), res))
+}
+
+// addTodo adds an open todo with a random text unless the request has them and returns its id
+func (s *testServer) addTodo(req models.AddTodoRequest) int {
+	if req.Text == nil {
+		text := getRandomString(10)
+		req.Text = &text
 	}
-	if userIdType == nil {
-		err = fmt.Errorf("user or password is invalid")
+	if req.Completed == nil {
+		req.Completed = new(bool)
 	}
-	return
+	todo := models.Todo{}
+	s.decode(s.todo(http.MethodPost, "/todo/add", req), http.StatusOK, &todo)
+	return *todo.Id
 }
 
-func (db *mockSqlDB) Migrate() error {
-	return nil
+func (s *testServer) deleteTodo(id int) {
+	rec := s.todo(http.MethodPost, "/todo/delete", map[string]int{"id": id})
+	require.Equal(s.t, http.StatusOK, rec.Code, rec.Body.String())
 }
 
+func (s *testServer) list(req models.ListRequest) models.TodoList {
+	list := models.TodoList{}
+	s.decode(s.todo(http.MethodGet, "/todo/list", req), http.StatusOK, &list)
+	return list
+}
+
+func (s *testServer) createAccessToken(name, scope string, expiresAt *time.Time) models.CreatedAccessToken {
+	token := models.CreatedAccessToken{}
+	req := models.CreateAccessTokenRequest{Name: &name, Scope: &scope, ExpiresAt: expiresAt}
+	s.decode(s.user(http.MethodPost, "/users/tokens/create", req), http.StatusCreated, &token)
+	return token
+}
+
+// newRequest builds a request with the body as JSON, a nil body is left out
+func newRequest(t *testing.T, method, target, token string, body interface{}) *http.Request {
+	var req *http.Request
+	if body == nil {
+		req = httptest.NewRequest(method, target, nil)
+	} else {
+		reqJson, err := json.Marshal(body)
+		require.NoError(t, err)
+		req = httptest.NewRequest(method, target, bytes.NewReader(reqJson))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	}
+	req.Header.Set(echo.HeaderAuthorization, token)
+	return req
+}
+
+func todoIds(list models.TodoList) []int {
+	res := []int{}
+	for _, todo := range list.List {
+		res = append(res, *todo.Id)
+	}
+	return res
+}
+
+func todoTexts(list models.TodoList) []string {
+	res := []string{}
+	for _, todo := range list.List {
+		res = append(res, *todo.Text)
+	}
+	return res
+}
+
+var (
+	jwtToken string
+)
+
 var letters = []rune("abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ1234567890")
 
 func getRandomString(n int) string {
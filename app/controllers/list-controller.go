@@ -0,0 +1,97 @@
+package controllers
+
+import (
+	"net/http"
+
+	"github.com/ann-96/todo-go-backend/app/models"
+	echo "github.com/labstack/echo/v4"
+)
+
+func (controller *todoController) AddList(c echo.Context) error {
+	userId := c.Get("userId").(int)
+	ctx := c.Request().Context()
+
+	req := &models.AddListRequest{}
+	if err := c.Bind(req); err != nil {
+		return c.JSON(http.StatusBadRequest, &models.ErrResponse{Msg: err.Error()})
+	}
+	if err := c.Validate(req); err != nil {
+		return c.JSON(http.StatusBadRequest, &models.ErrResponse{Msg: err.Error()})
+	}
+
+	res, err := controller.todos.AddList(ctx, req, userId)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, &models.ErrResponse{Msg: err.Error()})
+	}
+
+	return c.JSON(http.StatusOK, res)
+}
+
+func (controller *todoController) UpdateList(c echo.Context) error {
+	userId := c.Get("userId").(int)
+	ctx := c.Request().Context()
+
+	req := &models.List{}
+	if err := c.Bind(req); err != nil {
+		return c.JSON(http.StatusBadRequest, &models.ErrResponse{Msg: err.Error()})
+	}
+	if err := c.Validate(req); err != nil {
+		return c.JSON(http.StatusBadRequest, &models.ErrResponse{Msg: err.Error()})
+	}
+
+	res, err := controller.todos.UpdateList(ctx, req, userId)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, &models.ErrResponse{Msg: err.Error()})
+	}
+
+	return c.JSON(http.StatusOK, res)
+}
+
+func (controller *todoController) ListLists(c echo.Context) error {
+	userId := c.Get("userId").(int)
+	ctx := c.Request().Context()
+
+	res, err := controller.todos.ListLists(ctx, userId)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, &models.ErrResponse{Msg: err.Error()})
+	}
+
+	return c.JSON(http.StatusOK, res)
+}
+
+func (controller *todoController) DeleteList(c echo.Context) error {
+	userId := c.Get("userId").(int)
+	ctx := c.Request().Context()
+
+	req := &models.DeleteListRequest{}
+	if err := c.Bind(req); err != nil {
+		return c.JSON(http.StatusBadRequest, &models.ErrResponse{Msg: err.Error()})
+	}
+
+	err := controller.todos.DeleteList(ctx, req, userId)
+	if err != nil {
+		return c.JSON(http.StatusNotFound, &models.ErrResponse{Msg: err.Error()})
+	}
+
+	return c.JSON(http.StatusOK, nil)
+}
+
+func (controller *todoController) MoveTodo(c echo.Context) error {
+	userId := c.Get("userId").(int)
+	ctx := c.Request().Context()
+
+	req := &models.MoveTodoRequest{}
+	if err := c.Bind(req); err != nil {
+		return c.JSON(http.StatusBadRequest, &models.ErrResponse{Msg: err.Error()})
+	}
+	if err := c.Validate(req); err != nil {
+		return c.JSON(http.StatusBadRequest, &models.ErrResponse{Msg: err.Error()})
+	}
+
+	res, err := controller.todos.MoveTodo(ctx, req, userId)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, &models.ErrResponse{Msg: err.Error()})
+	}
+
+	return c.JSON(http.StatusOK, res)
+}
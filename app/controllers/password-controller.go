@@ -0,0 +1,131 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/ann-96/todo-go-backend/app/db"
+	"github.com/ann-96/todo-go-backend/app/models"
+	"github.com/ann-96/todo-go-backend/app/tools"
+	echo "github.com/labstack/echo/v4"
+	passwordvalidator "github.com/wagslane/go-password-validator"
+)
+
+const defaultPasswordResetTTL = time.Hour
+
+// ChangePassword replaces the password of the user, the failed checks of the old password count
+// towards the lockout of the login like those of Login
+func (controller *userController) ChangePassword(c echo.Context) error {
+	userId := c.Get("userId").(int)
+	ctx := c.Request().Context()
+
+	req := &models.ChangePasswordRequest{}
+	if err := c.Bind(req); err != nil {
+		return c.JSON(http.StatusBadRequest, &models.ErrResponse{Msg: err.Error()})
+	}
+	if err := c.Validate(req); err != nil {
+		return c.JSON(http.StatusBadRequest, &models.ErrResponse{Msg: err.Error()})
+	}
+	if err := checkNewPassword(*req.Password, *req.Password2); err != nil {
+		return c.JSON(http.StatusBadRequest, &models.ErrResponse{Msg: err.Error()})
+	}
+
+	loginKey, until, err := controller.accountBlockedUntil(c, userId)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, &models.ErrResponse{Msg: err.Error()})
+	} else if !until.IsZero() {
+		return tooManyAttempts(c, until)
+	}
+
+	if err := controller.users.ChangePassword(ctx, userId, *req.OldPassword, *req.Password, time.Now().Add(controller.MaxTokenTTL())); err != nil {
+		if errors.Is(err, db.ErrWrongPassword) {
+			if err := controller.failedLogin(c, loginKey); err != nil {
+				return c.JSON(http.StatusInternalServerError, &models.ErrResponse{Msg: err.Error()})
+			}
+			return c.JSON(http.StatusForbidden, &models.ErrResponse{Msg: err.Error()})
+		}
+		return c.JSON(http.StatusInternalServerError, &models.ErrResponse{Msg: err.Error()})
+	}
+	if err := controller.users.ResetAttempts(ctx, loginKey); err != nil {
+		return c.JSON(http.StatusInternalServerError, &models.ErrResponse{Msg: err.Error()})
+	}
+
+	return c.NoContent(http.StatusNoContent)
+}
+
+// ForgotPassword sends a password reset token to the user, the response is the same
+// whether the user exists or not
+func (controller *userController) ForgotPassword(c echo.Context) error {
+	ctx := c.Request().Context()
+	req := &models.ForgotPasswordRequest{}
+	if err := c.Bind(req); err != nil {
+		return c.JSON(http.StatusBadRequest, &models.ErrResponse{Msg: err.Error()})
+	}
+	if err := c.Validate(req); err != nil {
+		return c.JSON(http.StatusBadRequest, &models.ErrResponse{Msg: err.Error()})
+	}
+
+	login := strings.ToLower(*req.Login)
+	token, err := tools.NewOpaqueToken()
+	if err != nil {
+		return err
+	}
+	created, err := controller.users.CreatePasswordReset(ctx, login, tools.HashToken(token), time.Now().Add(controller.passwordResetTTL()))
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, &models.ErrResponse{Msg: err.Error()})
+	}
+	if created {
+		if err := controller.notifier().NotifyPasswordReset(login, token); err != nil {
+			return c.JSON(http.StatusInternalServerError, &models.ErrResponse{Msg: err.Error()})
+		}
+	}
+
+	return c.NoContent(http.StatusAccepted)
+}
+
+func (controller *userController) ResetPassword(c echo.Context) error {
+	ctx := c.Request().Context()
+	req := &models.ResetPasswordRequest{}
+	if err := c.Bind(req); err != nil {
+		return c.JSON(http.StatusBadRequest, &models.ErrResponse{Msg: err.Error()})
+	}
+	if err := c.Validate(req); err != nil {
+		return c.JSON(http.StatusBadRequest, &models.ErrResponse{Msg: err.Error()})
+	}
+	if err := checkNewPassword(*req.Password, *req.Password2); err != nil {
+		return c.JSON(http.StatusBadRequest, &models.ErrResponse{Msg: err.Error()})
+	}
+
+	if err := controller.users.ResetPassword(ctx, tools.HashToken(*req.Token), *req.Password, time.Now().Add(controller.MaxTokenTTL())); err != nil {
+		if errors.Is(err, db.ErrInvalidResetToken) {
+			return c.JSON(http.StatusBadRequest, &models.ErrResponse{Msg: err.Error()})
+		}
+		return c.JSON(http.StatusInternalServerError, &models.ErrResponse{Msg: err.Error()})
+	}
+
+	return c.NoContent(http.StatusNoContent)
+}
+
+// checkNewPassword applies the same rules as the registration
+func checkNewPassword(password, password2 string) error {
+	if password != password2 {
+		return errors.New("Entered passwords didn't match")
+	}
+	return passwordvalidator.Validate(password, passwordComplexity)
+}
+
+func (controller *userController) passwordResetTTL() time.Duration {
+	if controller.PasswordResetTTL > 0 {
+		return controller.PasswordResetTTL
+	}
+	return defaultPasswordResetTTL
+}
+
+func (controller *userController) notifier() tools.Notifier {
+	if controller.Notifier != nil {
+		return controller.Notifier
+	}
+	return &tools.LogNotifier{}
+}
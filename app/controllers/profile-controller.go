@@ -0,0 +1,70 @@
+package controllers
+
+import (
+	"fmt"
+	"net/http"
+	"net/mail"
+	"time"
+
+	"github.com/ann-96/todo-go-backend/app/models"
+	echo "github.com/labstack/echo/v4"
+	"golang.org/x/text/language"
+)
+
+func (controller *userController) Profile(c echo.Context) error {
+	userId := c.Get("userId").(int)
+	ctx := c.Request().Context()
+
+	res, err := controller.users.UserProfile(ctx, userId)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, &models.ErrResponse{Msg: err.Error()})
+	}
+
+	return c.JSON(http.StatusOK, res)
+}
+
+func (controller *userController) UpdateProfile(c echo.Context) error {
+	userId := c.Get("userId").(int)
+	ctx := c.Request().Context()
+
+	req := &models.UpdateProfileRequest{}
+	if err := c.Bind(req); err != nil {
+		return c.JSON(http.StatusBadRequest, &models.ErrResponse{Msg: err.Error()})
+	}
+	if err := c.Validate(req); err != nil {
+		return c.JSON(http.StatusBadRequest, &models.ErrResponse{Msg: err.Error()})
+	}
+	if err := checkProfile(req); err != nil {
+		return c.JSON(http.StatusBadRequest, &models.ErrResponse{Msg: err.Error()})
+	}
+
+	res, err := controller.users.UpdateProfile(ctx, req, userId)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, &models.ErrResponse{Msg: err.Error()})
+	}
+
+	return c.JSON(http.StatusOK, res)
+}
+
+// checkProfile validates the fields being set and normalizes the locale
+func checkProfile(req *models.UpdateProfileRequest) error {
+	if req.Email != nil && *req.Email != "" {
+		if address, err := mail.ParseAddress(*req.Email); err != nil || address.Address != *req.Email {
+			return fmt.Errorf("invalid email")
+		}
+	}
+	if req.TimeZone != nil && *req.TimeZone != "" {
+		if _, err := time.LoadLocation(*req.TimeZone); err != nil || *req.TimeZone == "Local" {
+			return fmt.Errorf("invalid timeZone, expected an IANA time zone like Europe/Paris")
+		}
+	}
+	if req.Locale != nil && *req.Locale != "" {
+		tag, err := language.Parse(*req.Locale)
+		if err != nil {
+			return fmt.Errorf("invalid locale, expected a BCP 47 language tag like en-US")
+		}
+		locale := tag.String()
+		req.Locale = &locale
+	}
+	return nil
+}
@@ -0,0 +1,87 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/ann-96/todo-go-backend/app/db"
+	"github.com/ann-96/todo-go-backend/app/models"
+	echo "github.com/labstack/echo/v4"
+)
+
+func (controller *todoController) AddTag(c echo.Context) error {
+	userId := c.Get("userId").(int)
+	ctx := c.Request().Context()
+
+	req := &models.AddTagRequest{}
+	if err := c.Bind(req); err != nil {
+		return c.JSON(http.StatusBadRequest, &models.ErrResponse{Msg: err.Error()})
+	}
+	if err := c.Validate(req); err != nil {
+		return c.JSON(http.StatusBadRequest, &models.ErrResponse{Msg: err.Error()})
+	}
+
+	res, err := controller.todos.AddTag(ctx, req, userId)
+	if err != nil {
+		if errors.Is(err, db.ErrTagExists) {
+			return c.JSON(http.StatusConflict, &models.ErrResponse{Msg: err.Error()})
+		}
+		return c.JSON(http.StatusInternalServerError, &models.ErrResponse{Msg: err.Error()})
+	}
+
+	return c.JSON(http.StatusOK, res)
+}
+
+func (controller *todoController) UpdateTag(c echo.Context) error {
+	userId := c.Get("userId").(int)
+	ctx := c.Request().Context()
+
+	req := &models.Tag{}
+	if err := c.Bind(req); err != nil {
+		return c.JSON(http.StatusBadRequest, &models.ErrResponse{Msg: err.Error()})
+	}
+	if err := c.Validate(req); err != nil {
+		return c.JSON(http.StatusBadRequest, &models.ErrResponse{Msg: err.Error()})
+	}
+
+	res, err := controller.todos.UpdateTag(ctx, req, userId)
+	if err != nil {
+		if errors.Is(err, db.ErrTagExists) {
+			return c.JSON(http.StatusConflict, &models.ErrResponse{Msg: err.Error()})
+		}
+		return c.JSON(http.StatusBadRequest, &models.ErrResponse{Msg: err.Error()})
+	}
+
+	return c.JSON(http.StatusOK, res)
+}
+
+func (controller *todoController) ListTags(c echo.Context) error {
+	userId := c.Get("userId").(int)
+	ctx := c.Request().Context()
+
+	res, err := controller.todos.ListTags(ctx, userId)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, &models.ErrResponse{Msg: err.Error()})
+	}
+
+	return c.JSON(http.StatusOK, res)
+}
+
+func (controller *todoController) DeleteTag(c echo.Context) error {
+	userId := c.Get("userId").(int)
+	ctx := c.Request().Context()
+
+	req := &struct {
+		Id int `json:"id"`
+	}{}
+	if err := c.Bind(req); err != nil {
+		return c.JSON(http.StatusBadRequest, &models.ErrResponse{Msg: err.Error()})
+	}
+
+	err := controller.todos.DeleteTag(ctx, req.Id, userId)
+	if err != nil {
+		return c.JSON(http.StatusNotFound, &models.ErrResponse{Msg: err.Error()})
+	}
+
+	return c.JSON(http.StatusOK, nil)
+}
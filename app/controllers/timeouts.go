@@ -0,0 +1,70 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	echo "github.com/labstack/echo/v4"
+)
+
+// defaultQueryTimeout bounds the queries of the requests when Settings.QueryTimeout is zero
+const defaultQueryTimeout = 10 * time.Second
+
+// queryTimeout cancels the context of the request, and with it its queries, once the timeout
+// of its route is over, a route without a deadline in Settings.QueryTimeouts keeps the context
+func queryTimeout(settings Settings) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			timeout, ok := settings.QueryTimeouts[c.Path()]
+			if !ok {
+				timeout = settings.QueryTimeout
+				if timeout <= 0 {
+					timeout = defaultQueryTimeout
+				}
+			}
+			if timeout <= 0 {
+				return next(c)
+			}
+
+			ctx, cancel := context.WithTimeout(c.Request().Context(), timeout)
+			defer cancel()
+			c.SetRequest(c.Request().WithContext(ctx))
+			return next(c)
+		}
+	}
+}
+
+// ParseQueryTimeouts reads the timeouts of the routes from a list like
+// "/todo/search=2s,/users/me/export=0", zero takes the deadline off a route
+func ParseQueryTimeouts(input string) (map[string]time.Duration, error) {
+	res := map[string]time.Duration{}
+	for _, entry := range strings.Split(input, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		path, value, ok := strings.Cut(entry, "=")
+		if !ok {
+			return nil, fmt.Errorf("the query timeout %q is not path=duration", entry)
+		}
+		timeout, err := time.ParseDuration(strings.TrimSpace(value))
+		if err != nil {
+			return nil, fmt.Errorf("the query timeout of %s: %w", path, err)
+		}
+		res[strings.TrimSpace(path)] = timeout
+	}
+	return res, nil
+}
+
+// cancelableRequests derives the contexts of the requests served by e from a context
+// cancelled by the returned function, so a shutdown can stop the queries still running
+func cancelableRequests(e *echo.Echo) context.CancelFunc {
+	ctx, cancel := context.WithCancel(context.Background())
+	e.Server.BaseContext = func(net.Listener) context.Context {
+		return ctx
+	}
+	return cancel
+}
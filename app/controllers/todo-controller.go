@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"net/http"
 	"strconv"
+	"time"
 
 	"github.com/ann-96/todo-go-backend/app/db"
 	"github.com/ann-96/todo-go-backend/app/models"
@@ -13,13 +14,21 @@ import (
 	"github.com/labstack/echo/v4/middleware"
 )
 
+const defaultMaxPageSize = 100
+
 type todoController struct {
-	e  *echo.Echo
-	db db.TodoSqlDB
+	e     *echo.Echo
+	todos db.TodoStore
+	// users tell the time zones of the users and check the personal access tokens
+	users db.UserStore
 	Settings
+
+	cancelRequests context.CancelFunc
 }
 
-func NewTodoController(settings Settings, db db.TodoSqlDB) (*todoController, error) {
+func NewTodoController(settings Settings, todos db.TodoStore, users db.UserStore) (*todoController, error) {
+	settings = settings.withKeys()
+
 	e := echo.New()
 	e.Validator = tools.NewValidator()
 
@@ -29,28 +38,39 @@ func NewTodoController(settings Settings, db db.TodoSqlDB) (*todoController, err
 		AllowOrigins: []string{"*"},
 		AllowHeaders: []string{echo.HeaderOrigin, echo.HeaderContentType, echo.HeaderAccept, "Authorization"},
 	}))
-	e.Use(middleware.KeyAuthWithConfig(middleware.KeyAuthConfig{
-		KeyLookup: "header:authorization",
-		Validator: func(input string, c echo.Context) (bool, error) {
-			userID, err := TokenToUserID(input, settings.JwtKey)
-			if err != nil {
-				return false, err
-			}
-			c.Set("userId", userID)
-			return true, nil
-		},
-	}))
+	e.Use(queryTimeout(settings))
+	e.Use(todoAuth(settings, users), checkScope)
 
 	controller := &todoController{
-		Settings: settings,
-		db:       db,
-		e:        e,
+		Settings:       settings,
+		todos:          todos,
+		users:          users,
+		e:              e,
+		cancelRequests: cancelableRequests(e),
 	}
 
 	controller.e.POST("/todo/add", controller.Add)
 	controller.e.POST("/todo/update", controller.Update)
 	controller.e.GET("/todo/list", controller.List)
 	controller.e.POST("/todo/delete", controller.Delete)
+	controller.e.GET("/todo/search", controller.Search)
+	controller.e.POST("/todo/batch", controller.Batch)
+	controller.e.POST("/todo/move", controller.Reorder)
+
+	controller.e.GET("/todo/trash/list", controller.ListTrash)
+	controller.e.POST("/todo/trash/restore", controller.RestoreTodo)
+	controller.e.POST("/todo/trash/empty", controller.EmptyTrash)
+
+	controller.e.POST("/todo/tags/add", controller.AddTag)
+	controller.e.POST("/todo/tags/update", controller.UpdateTag)
+	controller.e.GET("/todo/tags/list", controller.ListTags)
+	controller.e.POST("/todo/tags/delete", controller.DeleteTag)
+
+	controller.e.POST("/todo/lists/add", controller.AddList)
+	controller.e.POST("/todo/lists/update", controller.UpdateList)
+	controller.e.GET("/todo/lists/list", controller.ListLists)
+	controller.e.POST("/todo/lists/delete", controller.DeleteList)
+	controller.e.POST("/todo/lists/move", controller.MoveTodo)
 
 	return controller, nil
 }
@@ -60,7 +80,9 @@ func (controller *todoController) Run() error {
 	return controller.e.Start(connectionString)
 }
 
+// Shutdown waits for the running requests until ctx is done and then cancels their queries
 func (controller *todoController) Shutdown(ctx context.Context) error {
+	defer controller.cancelRequests()
 	return controller.e.Shutdown(ctx)
 }
 
@@ -70,6 +92,7 @@ func (controller *todoController) Logger() echo.Logger {
 
 func (controller *todoController) Add(c echo.Context) error {
 	userId := c.Get("userId").(int)
+	ctx := c.Request().Context()
 
 	req := &models.AddTodoRequest{}
 	if err := c.Bind(req); err != nil {
@@ -79,7 +102,7 @@ func (controller *todoController) Add(c echo.Context) error {
 		return c.JSON(http.StatusBadRequest, &models.ErrResponse{Msg: err.Error()})
 	}
 
-	res, err := controller.db.Add(req, userId)
+	res, err := controller.todos.Add(ctx, req, userId)
 	if err != nil {
 		return c.JSON(http.StatusInternalServerError, &models.ErrResponse{Msg: err.Error()})
 	}
@@ -89,6 +112,7 @@ func (controller *todoController) Add(c echo.Context) error {
 
 func (controller *todoController) Update(c echo.Context) error {
 	userId := c.Get("userId").(int)
+	ctx := c.Request().Context()
 
 	req := &models.Todo{}
 	if err := c.Bind(req); err != nil {
@@ -98,7 +122,7 @@ func (controller *todoController) Update(c echo.Context) error {
 		return c.JSON(http.StatusBadRequest, &models.ErrResponse{Msg: err.Error()})
 	}
 
-	res, err := controller.db.Update(req, userId)
+	res, err := controller.todos.Update(ctx, req, userId)
 	if err != nil {
 		return c.JSON(http.StatusBadRequest, &models.ErrResponse{Msg: err.Error()})
 	}
@@ -108,21 +132,45 @@ func (controller *todoController) Update(c echo.Context) error {
 
 func (controller *todoController) List(c echo.Context) error {
 	userId := c.Get("userId").(int)
+	ctx := c.Request().Context()
 
 	req := &models.ListRequest{}
 	if err := c.Bind(req); err != nil {
 		return c.JSON(http.StatusBadRequest, &models.ErrResponse{Msg: err.Error()})
 	}
-	startVal, err := strconv.Atoi(req.Start)
-	if err != nil {
+	if err := c.Validate(req); err != nil {
 		return c.JSON(http.StatusBadRequest, &models.ErrResponse{Msg: err.Error()})
 	}
-	countVal, err := strconv.Atoi(req.Count)
+	loc, err := controller.userLocation(ctx, userId)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, &models.ErrResponse{Msg: err.Error()})
+	}
+	filter, err := parseTodoFilter(req, time.Now(), loc)
 	if err != nil {
 		return c.JSON(http.StatusBadRequest, &models.ErrResponse{Msg: err.Error()})
 	}
 
-	res, err := controller.db.List(startVal, countVal, userId)
+	startVal, countVal := 0, controller.maxPageSize()
+	if !filter.Keyset {
+		startVal, err = strconv.Atoi(req.Start)
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, &models.ErrResponse{Msg: err.Error()})
+		}
+	}
+	if req.Count != "" || !filter.Keyset {
+		countVal, err = strconv.Atoi(req.Count)
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, &models.ErrResponse{Msg: err.Error()})
+		}
+	}
+	if startVal < 0 || countVal < 0 {
+		return c.JSON(http.StatusBadRequest, &models.ErrResponse{Msg: "start and count can't be negative"})
+	}
+	if countVal > controller.maxPageSize() {
+		countVal = controller.maxPageSize()
+	}
+
+	res, err := controller.todos.List(ctx, startVal, countVal, filter, userId)
 	if err != nil {
 		return c.JSON(http.StatusInternalServerError, &models.ErrResponse{Msg: err.Error()})
 	}
@@ -132,6 +180,7 @@ func (controller *todoController) List(c echo.Context) error {
 
 func (controller *todoController) Delete(c echo.Context) error {
 	userId := c.Get("userId").(int)
+	ctx := c.Request().Context()
 
 	req := &struct {
 		Id int `json:"id" binding:"validate"`
@@ -143,7 +192,7 @@ func (controller *todoController) Delete(c echo.Context) error {
 		return c.JSON(http.StatusBadRequest, &models.ErrResponse{Msg: err.Error()})
 	}
 
-	err := controller.db.Delete(req.Id, userId)
+	err := controller.todos.Delete(ctx, req.Id, userId)
 	if err != nil {
 		return c.JSON(http.StatusNotFound, &models.ErrResponse{Msg: err.Error()})
 	}
@@ -151,6 +200,191 @@ func (controller *todoController) Delete(c echo.Context) error {
 	return c.JSON(http.StatusOK, nil)
 }
 
+func (controller *todoController) Reorder(c echo.Context) error {
+	userId := c.Get("userId").(int)
+	ctx := c.Request().Context()
+
+	req := &models.ReorderTodoRequest{}
+	if err := c.Bind(req); err != nil {
+		return c.JSON(http.StatusBadRequest, &models.ErrResponse{Msg: err.Error()})
+	}
+	if err := c.Validate(req); err != nil {
+		return c.JSON(http.StatusBadRequest, &models.ErrResponse{Msg: err.Error()})
+	}
+	anchor := req.Before
+	if anchor == nil {
+		anchor = req.After
+	}
+	if (req.Before == nil) == (req.After == nil) {
+		return c.JSON(http.StatusBadRequest, &models.ErrResponse{Msg: "either before or after is required"})
+	}
+	if *anchor == *req.Id {
+		return c.JSON(http.StatusBadRequest, &models.ErrResponse{Msg: "a todo can't be moved next to itself"})
+	}
+
+	res, err := controller.todos.ReorderTodo(ctx, req, userId)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, &models.ErrResponse{Msg: err.Error()})
+	}
+
+	return c.JSON(http.StatusOK, res)
+}
+
+func (controller *todoController) Search(c echo.Context) error {
+	userId := c.Get("userId").(int)
+	ctx := c.Request().Context()
+
+	req := &models.SearchRequest{}
+	if err := c.Bind(req); err != nil {
+		return c.JSON(http.StatusBadRequest, &models.ErrResponse{Msg: err.Error()})
+	}
+	if err := c.Validate(req); err != nil {
+		return c.JSON(http.StatusBadRequest, &models.ErrResponse{Msg: err.Error()})
+	}
+
+	terms := tools.SearchTerms(req.Query)
+	if len(terms) == 0 {
+		return c.JSON(http.StatusBadRequest, &models.ErrResponse{Msg: "the query has no words to search for"})
+	}
+
+	countVal := controller.maxPageSize()
+	if req.Count != "" {
+		count, err := strconv.Atoi(req.Count)
+		if err != nil || count < 0 {
+			return c.JSON(http.StatusBadRequest, &models.ErrResponse{Msg: "invalid count"})
+		}
+		if count < countVal {
+			countVal = count
+		}
+	}
+
+	res, err := controller.todos.Search(ctx, terms, countVal, userId)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, &models.ErrResponse{Msg: err.Error()})
+	}
+
+	return c.JSON(http.StatusOK, res)
+}
+
+func (controller *todoController) maxPageSize() int {
+	if controller.MaxPageSize > 0 {
+		return controller.MaxPageSize
+	}
+	return defaultMaxPageSize
+}
+
+// userLocation returns the time zone of the user's profile, the server time zone when there is none
+func (controller *todoController) userLocation(ctx context.Context, userId int) (*time.Location, error) {
+	timeZone, err := controller.users.UserTimeZone(ctx, userId)
+	if err != nil {
+		return nil, err
+	}
+	if timeZone == "" {
+		return time.Local, nil
+	}
+	loc, err := time.LoadLocation(timeZone)
+	if err != nil {
+		return time.Local, nil
+	}
+	return loc, nil
+}
+
+func parseTodoFilter(req *models.ListRequest, now time.Time, loc *time.Location) (*models.TodoFilter, error) {
+	filter := &models.TodoFilter{
+		Tags:    req.Tags,
+		AllTags: req.TagMode == models.TagModeAll,
+		View:    req.View,
+		Query:   req.Query,
+		Sort:    req.Sort,
+		Desc:    req.Order == "desc",
+		Keyset:  req.Start == "" || req.Cursor != "",
+	}
+	if filter.Sort == "" {
+		filter.Sort = models.SortPosition
+	}
+
+	if req.Completed != "" {
+		completed := req.Completed == "true"
+		filter.Completed = &completed
+	}
+
+	if req.Cursor != "" {
+		cursor, err := models.DecodeCursor(req.Cursor)
+		if err != nil {
+			return nil, err
+		}
+		if cursor.Sort != filter.Sort || cursor.Desc != filter.Desc {
+			return nil, fmt.Errorf("the cursor doesn't match the sort order")
+		}
+		filter.Cursor = cursor
+	}
+
+	if req.ListId == models.ListInbox {
+		filter.Inbox = true
+	} else if req.ListId != "" {
+		listId, err := strconv.Atoi(req.ListId)
+		if err != nil {
+			return nil, fmt.Errorf("invalid listId: %w", err)
+		}
+		filter.ListId = &listId
+	}
+
+	switch req.Due {
+	case models.DueOverdue:
+		filter.Overdue = true
+	case models.DueToday:
+		year, month, day := now.In(loc).Date()
+		from := time.Date(year, month, day, 0, 0, 0, 0, loc)
+		to := from.AddDate(0, 0, 1)
+		filter.DueFrom, filter.DueTo = &from, &to
+	}
+
+	if req.DueFrom != "" {
+		from, err := parseDueBound(req.DueFrom, false, loc)
+		if err != nil {
+			return nil, fmt.Errorf("invalid dueFrom: %w", err)
+		}
+		if filter.DueFrom == nil || from.After(*filter.DueFrom) {
+			filter.DueFrom = &from
+		}
+	}
+	if req.DueTo != "" {
+		to, err := parseDueBound(req.DueTo, true, loc)
+		if err != nil {
+			return nil, fmt.Errorf("invalid dueTo: %w", err)
+		}
+		if filter.DueTo == nil || to.Before(*filter.DueTo) {
+			filter.DueTo = &to
+		}
+	}
+
+	return filter, nil
+}
+
+// parseDueBound accepts either an RFC 3339 timestamp or a plain date,
+// the upper bound of a plain date is the start of the next day
+func parseDueBound(in string, upper bool, loc *time.Location) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, in); err == nil {
+		if upper {
+			t = t.Add(time.Microsecond)
+		}
+		return t, nil
+	}
+
+	t, err := time.ParseInLocation("2006-01-02", in, loc)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("expected a date or an RFC 3339 timestamp")
+	}
+	if upper {
+		t = t.AddDate(0, 0, 1)
+	}
+	return t, nil
+}
+
+func (controller *todoController) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	controller.e.ServeHTTP(w, r)
+}
+
 func (controller *todoController) NewContext(r *http.Request, w http.ResponseWriter) echo.Context {
 	return controller.e.NewContext(r, w)
 }
@@ -0,0 +1,77 @@
+package controllers
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/ann-96/todo-go-backend/app/models"
+	echo "github.com/labstack/echo/v4"
+)
+
+func (controller *todoController) ListTrash(c echo.Context) error {
+	userId := c.Get("userId").(int)
+	ctx := c.Request().Context()
+
+	req := &models.TrashRequest{}
+	if err := c.Bind(req); err != nil {
+		return c.JSON(http.StatusBadRequest, &models.ErrResponse{Msg: err.Error()})
+	}
+
+	startVal, countVal := 0, controller.maxPageSize()
+	var err error
+	if req.Start != "" {
+		if startVal, err = strconv.Atoi(req.Start); err != nil {
+			return c.JSON(http.StatusBadRequest, &models.ErrResponse{Msg: err.Error()})
+		}
+	}
+	if req.Count != "" {
+		if countVal, err = strconv.Atoi(req.Count); err != nil {
+			return c.JSON(http.StatusBadRequest, &models.ErrResponse{Msg: err.Error()})
+		}
+	}
+	if startVal < 0 || countVal < 0 {
+		return c.JSON(http.StatusBadRequest, &models.ErrResponse{Msg: "start and count can't be negative"})
+	}
+	if countVal > controller.maxPageSize() {
+		countVal = controller.maxPageSize()
+	}
+
+	res, err := controller.todos.ListTrash(ctx, startVal, countVal, userId)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, &models.ErrResponse{Msg: err.Error()})
+	}
+
+	return c.JSON(http.StatusOK, res)
+}
+
+func (controller *todoController) RestoreTodo(c echo.Context) error {
+	userId := c.Get("userId").(int)
+	ctx := c.Request().Context()
+
+	req := &models.RestoreTodoRequest{}
+	if err := c.Bind(req); err != nil {
+		return c.JSON(http.StatusBadRequest, &models.ErrResponse{Msg: err.Error()})
+	}
+	if err := c.Validate(req); err != nil {
+		return c.JSON(http.StatusBadRequest, &models.ErrResponse{Msg: err.Error()})
+	}
+
+	res, err := controller.todos.RestoreTodo(ctx, *req.Id, userId)
+	if err != nil {
+		return c.JSON(http.StatusNotFound, &models.ErrResponse{Msg: err.Error()})
+	}
+
+	return c.JSON(http.StatusOK, res)
+}
+
+func (controller *todoController) EmptyTrash(c echo.Context) error {
+	userId := c.Get("userId").(int)
+	ctx := c.Request().Context()
+
+	deleted, err := controller.todos.EmptyTrash(ctx, userId)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, &models.ErrResponse{Msg: err.Error()})
+	}
+
+	return c.JSON(http.StatusOK, &models.EmptyTrashResult{Deleted: deleted})
+}
@@ -0,0 +1,237 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/ann-96/todo-go-backend/app/db"
+	"github.com/ann-96/todo-go-backend/app/models"
+	"github.com/ann-96/todo-go-backend/app/tools"
+	"github.com/golang-jwt/jwt"
+	"github.com/google/uuid"
+	echo "github.com/labstack/echo/v4"
+)
+
+const (
+	totpIssuer        = "todolist"
+	twoFactorTokenTTL = 5 * time.Minute
+	recoveryCodeCount = 10
+)
+
+// EnrollTwoFactor starts a TOTP enrollment, it only takes effect once ConfirmTwoFactor gets a valid code
+func (controller *userController) EnrollTwoFactor(c echo.Context) error {
+	userId := c.Get("userId").(int)
+	ctx := c.Request().Context()
+
+	secret, err := tools.NewTOTPSecret()
+	if err != nil {
+		return err
+	}
+	login, err := controller.users.StartTOTPEnrollment(ctx, userId, secret)
+	if err != nil {
+		if errors.Is(err, db.ErrTwoFactorEnabled) {
+			return c.JSON(http.StatusConflict, &models.ErrResponse{Msg: err.Error()})
+		}
+		return c.JSON(http.StatusInternalServerError, &models.ErrResponse{Msg: err.Error()})
+	}
+
+	return c.JSON(http.StatusOK, &models.TOTPEnrollment{
+		Secret: secret,
+		URI:    tools.TOTPURI(totpIssuer, login, secret),
+	})
+}
+
+func (controller *userController) ConfirmTwoFactor(c echo.Context) error {
+	userId := c.Get("userId").(int)
+	ctx := c.Request().Context()
+
+	req := &models.TwoFactorCodeRequest{}
+	if err := c.Bind(req); err != nil {
+		return c.JSON(http.StatusBadRequest, &models.ErrResponse{Msg: err.Error()})
+	}
+	if err := c.Validate(req); err != nil {
+		return c.JSON(http.StatusBadRequest, &models.ErrResponse{Msg: err.Error()})
+	}
+
+	codes, hashes, err := newRecoveryCodes()
+	if err != nil {
+		return err
+	}
+	if err := controller.users.ConfirmTOTPEnrollment(ctx, userId, *req.Code, hashes); err != nil {
+		switch {
+		case errors.Is(err, db.ErrTwoFactorEnabled):
+			return c.JSON(http.StatusConflict, &models.ErrResponse{Msg: err.Error()})
+		case errors.Is(err, db.ErrNoTwoFactorPending), errors.Is(err, db.ErrWrongCode):
+			return c.JSON(http.StatusBadRequest, &models.ErrResponse{Msg: err.Error()})
+		}
+		return c.JSON(http.StatusInternalServerError, &models.ErrResponse{Msg: err.Error()})
+	}
+
+	return c.JSON(http.StatusOK, &models.RecoveryCodes{RecoveryCodes: codes})
+}
+
+// DisableTwoFactor turns the second factor off, the failed checks count towards the lockout
+// of the login like those of Login
+func (controller *userController) DisableTwoFactor(c echo.Context) error {
+	userId := c.Get("userId").(int)
+	ctx := c.Request().Context()
+
+	req := &models.DisableTwoFactorRequest{}
+	if err := c.Bind(req); err != nil {
+		return c.JSON(http.StatusBadRequest, &models.ErrResponse{Msg: err.Error()})
+	}
+	if err := c.Validate(req); err != nil {
+		return c.JSON(http.StatusBadRequest, &models.ErrResponse{Msg: err.Error()})
+	}
+
+	loginKey, until, err := controller.accountBlockedUntil(c, userId)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, &models.ErrResponse{Msg: err.Error()})
+	} else if !until.IsZero() {
+		return tooManyAttempts(c, until)
+	}
+
+	if err := controller.users.VerifyPassword(ctx, userId, *req.Password); err != nil {
+		if errors.Is(err, db.ErrWrongPassword) {
+			if err := controller.failedLogin(c, loginKey); err != nil {
+				return c.JSON(http.StatusInternalServerError, &models.ErrResponse{Msg: err.Error()})
+			}
+			return c.JSON(http.StatusForbidden, &models.ErrResponse{Msg: err.Error()})
+		}
+		return c.JSON(http.StatusInternalServerError, &models.ErrResponse{Msg: err.Error()})
+	}
+	if err := controller.users.VerifySecondFactor(ctx, userId, *req.Code); err != nil {
+		if err := controller.failedLogin(c, loginKey); err != nil {
+			return c.JSON(http.StatusInternalServerError, &models.ErrResponse{Msg: err.Error()})
+		}
+		return secondFactorError(c, err)
+	}
+	if err := controller.users.ResetAttempts(ctx, loginKey); err != nil {
+		return c.JSON(http.StatusInternalServerError, &models.ErrResponse{Msg: err.Error()})
+	}
+	if err := controller.users.DisableTwoFactor(ctx, userId); err != nil {
+		return c.JSON(http.StatusInternalServerError, &models.ErrResponse{Msg: err.Error()})
+	}
+
+	return c.NoContent(http.StatusNoContent)
+}
+
+// RegenerateRecoveryCodes replaces all the recovery codes, the unused ones stop working. The
+// failed checks of the code count towards the lockout of the login like those of Login
+func (controller *userController) RegenerateRecoveryCodes(c echo.Context) error {
+	userId := c.Get("userId").(int)
+	ctx := c.Request().Context()
+
+	req := &models.TwoFactorCodeRequest{}
+	if err := c.Bind(req); err != nil {
+		return c.JSON(http.StatusBadRequest, &models.ErrResponse{Msg: err.Error()})
+	}
+	if err := c.Validate(req); err != nil {
+		return c.JSON(http.StatusBadRequest, &models.ErrResponse{Msg: err.Error()})
+	}
+
+	loginKey, until, err := controller.accountBlockedUntil(c, userId)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, &models.ErrResponse{Msg: err.Error()})
+	} else if !until.IsZero() {
+		return tooManyAttempts(c, until)
+	}
+	if err := controller.users.VerifySecondFactor(ctx, userId, *req.Code); err != nil {
+		if err := controller.failedLogin(c, loginKey); err != nil {
+			return c.JSON(http.StatusInternalServerError, &models.ErrResponse{Msg: err.Error()})
+		}
+		return secondFactorError(c, err)
+	}
+	if err := controller.users.ResetAttempts(ctx, loginKey); err != nil {
+		return c.JSON(http.StatusInternalServerError, &models.ErrResponse{Msg: err.Error()})
+	}
+	codes, hashes, err := newRecoveryCodes()
+	if err != nil {
+		return err
+	}
+	if err := controller.users.ReplaceRecoveryCodes(ctx, userId, hashes); err != nil {
+		return c.JSON(http.StatusInternalServerError, &models.ErrResponse{Msg: err.Error()})
+	}
+
+	return c.JSON(http.StatusOK, &models.RecoveryCodes{RecoveryCodes: codes})
+}
+
+// LoginTwoFactor finishes a login by exchanging the token of its challenge and a code for a session
+func (controller *userController) LoginTwoFactor(c echo.Context) error {
+	ctx := c.Request().Context()
+	req := &models.LoginTwoFactorRequest{}
+	if err := c.Bind(req); err != nil {
+		return c.JSON(http.StatusBadRequest, &models.ErrResponse{Msg: err.Error()})
+	}
+	if err := c.Validate(req); err != nil {
+		return c.JSON(http.StatusBadRequest, &models.ErrResponse{Msg: err.Error()})
+	}
+
+	claims, err := parseClaims(*req.TwoFactorToken, controller.Keys)
+	if err != nil || claims.Purpose != models.PurposeTwoFactor {
+		return c.JSON(http.StatusUnauthorized, &models.ErrResponse{Msg: "invalid token"})
+	}
+	revoked, err := controller.users.IsTokenRevoked(ctx, claims.Id, claims.UserID, time.Unix(claims.IssuedAt, 0))
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, &models.ErrResponse{Msg: err.Error()})
+	}
+	if revoked {
+		return c.JSON(http.StatusUnauthorized, &models.ErrResponse{Msg: "the token is revoked"})
+	}
+
+	loginKey, until, err := controller.accountBlockedUntil(c, claims.UserID)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, &models.ErrResponse{Msg: err.Error()})
+	} else if !until.IsZero() {
+		return tooManyAttempts(c, until)
+	}
+	if err := controller.users.VerifySecondFactor(ctx, claims.UserID, *req.Code); err != nil {
+		if err := controller.failedLogin(c, loginKey); err != nil {
+			return c.JSON(http.StatusInternalServerError, &models.ErrResponse{Msg: err.Error()})
+		}
+		return secondFactorError(c, err)
+	}
+	if err := controller.users.ResetAttempts(ctx, loginKey); err != nil {
+		return c.JSON(http.StatusInternalServerError, &models.ErrResponse{Msg: err.Error()})
+	}
+	// the challenge is over, its token can't start another session
+	if err := controller.users.RevokeToken(ctx, claims.Id, time.Unix(claims.ExpiresAt, 0)); err != nil {
+		return c.JSON(http.StatusInternalServerError, &models.ErrResponse{Msg: err.Error()})
+	}
+
+	return controller.startSession(c, claims.UserID)
+}
+
+// twoFactorToken issues the token of a login challenge, it isn't accepted as an access token
+func (controller *userController) twoFactorToken(userId int) (string, error) {
+	return controller.signToken(&models.Claims{
+		UserID:  userId,
+		Purpose: models.PurposeTwoFactor,
+		StandardClaims: jwt.StandardClaims{
+			ExpiresAt: time.Now().Add(twoFactorTokenTTL).Unix(),
+			IssuedAt:  time.Now().Unix(),
+			Id:        uuid.New().String(),
+		},
+	})
+}
+
+func secondFactorError(c echo.Context, err error) error {
+	if errors.Is(err, db.ErrWrongCode) || errors.Is(err, db.ErrTwoFactorNotEnabled) {
+		return c.JSON(http.StatusUnauthorized, &models.ErrResponse{Msg: err.Error()})
+	}
+	return c.JSON(http.StatusInternalServerError, &models.ErrResponse{Msg: err.Error()})
+}
+
+// newRecoveryCodes returns the codes to show to the user once and the hashes to store
+func newRecoveryCodes() ([]string, []string, error) {
+	codes, err := tools.NewRecoveryCodes(recoveryCodeCount)
+	if err != nil {
+		return nil, nil, err
+	}
+	hashes := make([]string, 0, len(codes))
+	for _, code := range codes {
+		hashes = append(hashes, tools.HashToken(tools.NormalizeRecoveryCode(code)))
+	}
+	return codes, hashes, nil
+}
@@ -2,6 +2,7 @@ package controllers
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"net/http"
 	"strings"
@@ -14,28 +15,40 @@ import (
 	"github.com/google/uuid"
 	echo "github.com/labstack/echo/v4"
 	"github.com/labstack/echo/v4/middleware"
-	passwordvalidator "github.com/wagslane/go-password-validator"
 )
 
-const passwordComplexity = 50
+const (
+	passwordComplexity = 50
+
+	defaultAccessTokenTTL  = 15 * time.Minute
+	defaultRefreshTokenTTL = 30 * 24 * time.Hour
+)
 
 type userController struct {
-	e  *echo.Echo
-	db db.TodoSqlDB
+	e     *echo.Echo
+	users db.UserStore
+	// todos are read for the exports of the accounts
+	todos db.TodoStore
 	Settings
+
+	cancelRequests context.CancelFunc
 }
 
-func NewUserController(settings Settings, db db.TodoSqlDB) (*userController, error) {
+func NewUserController(settings Settings, users db.UserStore, todos db.TodoStore) (*userController, error) {
+	settings = settings.withKeys()
 
 	e := echo.New()
 	e.Validator = tools.NewValidator()
+	// the attempts are limited per IP, so the clients must not pick theirs with X-Forwarded-For
+	e.IPExtractor = echo.ExtractIPDirect()
 
 	e.Use(middleware.Logger())
 	e.Use(middleware.Recover())
 	e.Use(middleware.CORSWithConfig(middleware.CORSConfig{
 		AllowOrigins: []string{"*"},
-		AllowHeaders: []string{echo.HeaderOrigin, echo.HeaderContentType, echo.HeaderAccept},
+		AllowHeaders: []string{echo.HeaderOrigin, echo.HeaderContentType, echo.HeaderAccept, "Authorization"},
 	}))
+	e.Use(queryTimeout(settings))
 	// e.Use(middleware.BodyDump(func(c echo.Context, reqBody, resBody []byte) {
 	// 	fmt.Printf("%s", string(reqBody))
 	// }))
@@ -43,13 +56,39 @@ func NewUserController(settings Settings, db db.TodoSqlDB) (*userController, err
 	usercontroller := &userController{
 		Settings: settings,
 
-		db: db,
-		e:  e,
+		users:          users,
+		todos:          todos,
+		e:              e,
+		cancelRequests: cancelableRequests(e),
 	}
 
+	usercontroller.e.GET("/.well-known/jwks.json", usercontroller.JWKS)
 	usercontroller.e.POST("/users/register", usercontroller.Register)
 	usercontroller.e.POST("/users/login", usercontroller.Login)
-	usercontroller.e.POST("/users/logout", usercontroller.Logout)
+	usercontroller.e.POST("/users/refresh", usercontroller.Refresh)
+	usercontroller.e.POST("/users/login/2fa", usercontroller.LoginTwoFactor)
+	usercontroller.e.POST("/users/password/forgot", usercontroller.ForgotPassword)
+	usercontroller.e.POST("/users/password/reset", usercontroller.ResetPassword)
+
+	auth := jwtAuth(settings, users)
+	usercontroller.e.POST("/users/logout", usercontroller.Logout, auth)
+	usercontroller.e.POST("/users/password/change", usercontroller.ChangePassword, auth)
+	usercontroller.e.POST("/users/2fa/enroll", usercontroller.EnrollTwoFactor, auth)
+	usercontroller.e.POST("/users/2fa/confirm", usercontroller.ConfirmTwoFactor, auth)
+	usercontroller.e.POST("/users/2fa/disable", usercontroller.DisableTwoFactor, auth)
+	usercontroller.e.POST("/users/2fa/recovery-codes", usercontroller.RegenerateRecoveryCodes, auth)
+	usercontroller.e.GET("/users/tokens/list", usercontroller.ListAccessTokens, auth)
+	usercontroller.e.POST("/users/tokens/create", usercontroller.CreateAccessToken, auth)
+	usercontroller.e.POST("/users/tokens/revoke", usercontroller.RevokeAccessToken, auth)
+	usercontroller.e.GET("/users/me", usercontroller.Profile, auth)
+	usercontroller.e.PATCH("/users/me", usercontroller.UpdateProfile, auth)
+	usercontroller.e.GET("/users/me/export", usercontroller.Export, auth)
+	usercontroller.e.POST("/users/me/delete", usercontroller.DeleteAccount, auth)
+
+	if settings.AdminToken != "" {
+		usercontroller.e.POST("/admin/users/unlock", usercontroller.Unlock, adminAuth(settings))
+		usercontroller.e.GET("/admin/db/stats", usercontroller.PoolStats, adminAuth(settings))
+	}
 
 	return usercontroller, nil
 }
@@ -59,7 +98,9 @@ func (controller *userController) Run() error {
 	return controller.e.Start(connectionString)
 }
 
+// Shutdown waits for the running requests until ctx is done and then cancels their queries
 func (controller *userController) Shutdown(ctx context.Context) error {
+	defer controller.cancelRequests()
 	return controller.e.Shutdown(ctx)
 }
 
@@ -68,6 +109,7 @@ func (controller *userController) Logger() echo.Logger {
 }
 
 func (controller *userController) Register(c echo.Context) error {
+	ctx := c.Request().Context()
 	req := &models.RegisterRequest{}
 	if err := c.Bind(req); err != nil {
 		return c.JSON(http.StatusBadRequest, &models.ErrResponse{Msg: err.Error()})
@@ -75,19 +117,26 @@ func (controller *userController) Register(c echo.Context) error {
 	if err := c.Validate(req); err != nil {
 		return c.JSON(http.StatusBadRequest, &models.ErrResponse{Msg: err.Error()})
 	}
-	if *req.Password != *req.Password2 {
-		return c.JSON(http.StatusBadRequest, &models.ErrResponse{Msg: "Entered passwords didn't match"})
-	}
-	if err := passwordvalidator.Validate(*req.Password, passwordComplexity); err != nil {
+	if err := checkNewPassword(*req.Password, *req.Password2); err != nil {
 		return c.JSON(http.StatusBadRequest, &models.ErrResponse{Msg: err.Error()})
 	}
 
 	*req.Login = strings.ToLower(*req.Login)
 
-	err := controller.db.Register(req)
+	ipKey := attemptKey("register-ip", c.RealIP())
+	if until, err := controller.blockedUntil(ctx, ipKey); err != nil {
+		return c.JSON(http.StatusInternalServerError, &models.ErrResponse{Msg: err.Error()})
+	} else if !until.IsZero() {
+		return tooManyAttempts(c, until)
+	}
+
+	_, err := controller.users.Register(ctx, req)
 	if err != nil {
-		if err.Error() == `pq: duplicate key value violates unique constraint "users_login_key"` {
-			return c.JSON(http.StatusConflict, &models.ErrResponse{Msg: "the user already exists"})
+		if errors.Is(err, db.ErrUserExists) {
+			if _, err := controller.users.RecordFailedAttempt(ctx, ipKey, controller.registerPolicy()); err != nil {
+				return c.JSON(http.StatusInternalServerError, &models.ErrResponse{Msg: err.Error()})
+			}
+			return c.JSON(http.StatusConflict, &models.ErrResponse{Msg: err.Error()})
 		}
 		return c.JSON(http.StatusInternalServerError, &models.ErrResponse{Msg: err.Error()})
 	}
@@ -96,6 +145,7 @@ func (controller *userController) Register(c echo.Context) error {
 }
 
 func (controller *userController) Login(c echo.Context) error {
+	ctx := c.Request().Context()
 	req := &models.LoginRequest{}
 	if err := c.Bind(req); err != nil {
 		return c.JSON(http.StatusBadRequest, &models.ErrResponse{Msg: err.Error()})
@@ -106,54 +156,205 @@ func (controller *userController) Login(c echo.Context) error {
 
 	*req.Login = strings.ToLower(*req.Login)
 
-	userId, err := controller.db.Login(req)
+	loginKey := loginAttemptKey(*req.Login)
+	if until, err := controller.blockedUntil(ctx, attemptKey("ip", c.RealIP()), loginKey); err != nil {
+		return c.JSON(http.StatusInternalServerError, &models.ErrResponse{Msg: err.Error()})
+	} else if !until.IsZero() {
+		return tooManyAttempts(c, until)
+	}
+
+	userId, err := controller.users.Login(ctx, req)
+	if err != nil {
+		if err := controller.failedLogin(c, loginKey); err != nil {
+			return c.JSON(http.StatusInternalServerError, &models.ErrResponse{Msg: err.Error()})
+		}
+		return c.JSON(http.StatusInternalServerError, &models.ErrResponse{Msg: err.Error()})
+	}
+
+	enabled, err := controller.users.TwoFactorEnabled(ctx, *userId)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, &models.ErrResponse{Msg: err.Error()})
+	}
+	if enabled {
+		if req.Code == "" {
+			token, err := controller.twoFactorToken(*userId)
+			if err != nil {
+				return err
+			}
+			return c.JSON(http.StatusUnauthorized, &models.TwoFactorChallenge{Msg: "a two-factor code is required", TwoFactorToken: token})
+		}
+		if err := controller.users.VerifySecondFactor(ctx, *userId, req.Code); err != nil {
+			if err := controller.failedLogin(c, loginKey); err != nil {
+				return c.JSON(http.StatusInternalServerError, &models.ErrResponse{Msg: err.Error()})
+			}
+			return secondFactorError(c, err)
+		}
+	}
+
+	if err := controller.users.ResetAttempts(ctx, loginKey); err != nil {
+		return c.JSON(http.StatusInternalServerError, &models.ErrResponse{Msg: err.Error()})
+	}
+	return controller.startSession(c, *userId)
+}
+
+// startSession issues the first refresh token of a new token family along with an access token
+func (controller *userController) startSession(c echo.Context, userId int) error {
+	ctx := c.Request().Context()
+	refreshToken, err := tools.NewOpaqueToken()
+	if err != nil {
+		return err
+	}
+	expiresAt := time.Now().Add(controller.refreshTokenTTL())
+	err = controller.users.InTx(ctx, func(tx db.Tx) error {
+		if err := tx.RecordLogin(ctx, userId); err != nil {
+			return err
+		}
+		return tx.CreateRefreshToken(ctx, userId, tools.HashToken(refreshToken), expiresAt)
+	})
 	if err != nil {
 		return c.JSON(http.StatusInternalServerError, &models.ErrResponse{Msg: err.Error()})
 	}
 
-	expirationTime := time.Now().Add(30 * 24 * time.Hour)
+	return controller.tokenResponse(c, userId, refreshToken)
+}
+
+// Refresh exchanges a refresh token for a new access token and a new refresh token,
+// the presented refresh token can't be used again
+func (controller *userController) Refresh(c echo.Context) error {
+	ctx := c.Request().Context()
+	req := &models.RefreshRequest{}
+	if err := c.Bind(req); err != nil {
+		return c.JSON(http.StatusBadRequest, &models.ErrResponse{Msg: err.Error()})
+	}
+	if err := c.Validate(req); err != nil {
+		return c.JSON(http.StatusBadRequest, &models.ErrResponse{Msg: err.Error()})
+	}
+
+	refreshToken, err := tools.NewOpaqueToken()
+	if err != nil {
+		return err
+	}
+	expiresAt := time.Now().Add(controller.refreshTokenTTL())
+	userId, err := controller.users.RotateRefreshToken(ctx, tools.HashToken(*req.RefreshToken), tools.HashToken(refreshToken), expiresAt)
+	if err != nil {
+		if errors.Is(err, db.ErrInvalidRefreshToken) || errors.Is(err, db.ErrRefreshTokenReused) {
+			return c.JSON(http.StatusUnauthorized, &models.ErrResponse{Msg: err.Error()})
+		}
+		return c.JSON(http.StatusInternalServerError, &models.ErrResponse{Msg: err.Error()})
+	}
+
+	return controller.tokenResponse(c, userId, refreshToken)
+}
+
+// tokenResponse issues an access token for the user and sends it along with the refresh token
+func (controller *userController) tokenResponse(c echo.Context, userId int, refreshToken string) error {
+	ttl := controller.accessTokenTTL()
 	claims := &models.Claims{
-		UserID: *userId,
+		UserID: userId,
 		StandardClaims: jwt.StandardClaims{
-			ExpiresAt: expirationTime.Unix(),
+			ExpiresAt: time.Now().Add(ttl).Unix(),
+			IssuedAt:  time.Now().Unix(),
 			Id:        uuid.New().String(),
 		},
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	tokenString, err := token.SignedString([]byte(controller.Settings.JwtKey))
+	tokenString, err := controller.signToken(claims)
 	if err != nil {
 		return err
 	}
-	return c.JSON(http.StatusOK, tokenString)
+	return c.JSON(http.StatusOK, &models.TokenResponse{
+		AccessToken:  tokenString,
+		RefreshToken: refreshToken,
+		ExpiresIn:    int(ttl.Seconds()),
+	})
+}
+
+func (controller *userController) signToken(claims *models.Claims) (string, error) {
+	return controller.Keys.Sign(claims)
+}
+
+// JWKS publishes the public keys verifying the tokens for the other services
+func (controller *userController) JWKS(c echo.Context) error {
+	c.Response().Header().Set(echo.HeaderCacheControl, "public, max-age=300")
+	return c.JSON(http.StatusOK, controller.Keys.JWKS())
+}
+
+func (controller *userController) accessTokenTTL() time.Duration {
+	if controller.AccessTokenTTL > 0 {
+		return controller.AccessTokenTTL
+	}
+	return defaultAccessTokenTTL
 }
 
+func (controller *userController) refreshTokenTTL() time.Duration {
+	if controller.RefreshTokenTTL > 0 {
+		return controller.RefreshTokenTTL
+	}
+	return defaultRefreshTokenTTL
+}
+
+// Logout revokes the token of the request until it expires, along with the refresh token if one is given
 func (controller *userController) Logout(c echo.Context) error {
+	ctx := c.Request().Context()
+	claims := c.Get("claims").(*models.Claims)
+
+	req := &models.LogoutRequest{}
+	if err := c.Bind(req); err != nil {
+		return c.JSON(http.StatusBadRequest, &models.ErrResponse{Msg: err.Error()})
+	}
+	if req.RefreshToken != "" {
+		if err := controller.users.RevokeRefreshToken(ctx, tools.HashToken(req.RefreshToken)); err != nil {
+			return c.JSON(http.StatusInternalServerError, &models.ErrResponse{Msg: err.Error()})
+		}
+	}
+
+	if err := controller.users.RevokeToken(ctx, claims.Id, time.Unix(claims.ExpiresAt, 0)); err != nil {
+		return c.JSON(http.StatusInternalServerError, &models.ErrResponse{Msg: err.Error()})
+	}
+
 	return c.JSON(http.StatusNoContent, nil)
 }
 
+func (controller *userController) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	controller.e.ServeHTTP(w, r)
+}
+
 func (controller *userController) NewContext(r *http.Request, w http.ResponseWriter) echo.Context {
 	return controller.e.NewContext(r, w)
 }
 
-func TokenToUserID(input, key string) (int, error) {
-	token, err := jwt.ParseWithClaims(input, &models.Claims{}, func(token *jwt.Token) (interface{}, error) {
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
-		}
+func TokenToUserID(input string, keys *tools.Keyring) (int, error) {
+	claims, err := ParseToken(input, keys)
+	if err != nil {
+		return 0, err
+	}
+	return claims.UserID, nil
+}
 
-		return []byte(key), nil
-	})
+// ParseToken verifies an access token and returns its claims
+func ParseToken(input string, keys *tools.Keyring) (*models.Claims, error) {
+	claims, err := parseClaims(input, keys)
+	if err != nil {
+		return nil, err
+	}
+	if claims.Purpose != "" {
+		return nil, fmt.Errorf("invalid token")
+	}
+	return claims, nil
+}
 
+// parseClaims verifies a token of any purpose, every token must have an id to be revocable
+func parseClaims(input string, keys *tools.Keyring) (*models.Claims, error) {
+	token, err := jwt.ParseWithClaims(input, &models.Claims{}, keys.Keyfunc)
 	if err != nil {
-		return 0, err
+		return nil, err
 	}
 	claims, ok := token.Claims.(*models.Claims)
 	if ok && token.Valid {
-		if claims == nil {
-			return 0, fmt.Errorf("invalid token")
+		if claims == nil || claims.Id == "" {
+			return nil, fmt.Errorf("invalid token")
 		}
-		return claims.UserID, nil
+		return claims, nil
 	}
-	return 0, fmt.Errorf("invalid token")
+	return nil, fmt.Errorf("invalid token")
 }
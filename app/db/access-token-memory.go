@@ -0,0 +1,120 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/ann-96/todo-go-backend/app/models"
+)
+
+type memoryAccessToken struct {
+	models.AccessToken
+	userId int
+	hash   string
+}
+
+func (db *memoryDB) CreateAccessToken(ctx context.Context, input *models.CreateAccessTokenRequest, tokenHash string, userId int) (*models.AccessToken, error) {
+	if err := db.lock(ctx); err != nil {
+		return nil, err
+	}
+	defer db.unlock()
+
+	user, err := db.user(userId)
+	if err != nil {
+		return nil, err
+	}
+	db.changeUser(user)
+	db.changeAccessToken(tokenHash)
+
+	db.lastAccessTokenId++
+	token := &memoryAccessToken{
+		AccessToken: models.AccessToken{
+			Id:        db.lastAccessTokenId,
+			Name:      *input.Name,
+			Scope:     *input.Scope,
+			ExpiresAt: memoryTime(input.ExpiresAt),
+			CreatedAt: memoryNow(),
+		},
+		userId: userId,
+		hash:   tokenHash,
+	}
+	user.accessTokens[token.Id] = token
+	db.accessTokens[tokenHash] = token
+
+	return token.model(), nil
+}
+
+// model copies the token, it is changed in place once used
+func (token *memoryAccessToken) model() *models.AccessToken {
+	res := token.AccessToken
+	res.ExpiresAt = memoryTime(token.ExpiresAt)
+	res.LastUsedAt = memoryTime(token.LastUsedAt)
+	return &res
+}
+
+func (db *memoryDB) ListAccessTokens(ctx context.Context, userId int) ([]models.AccessToken, error) {
+	if err := db.rlock(ctx); err != nil {
+		return nil, err
+	}
+	defer db.runlock()
+
+	list := []models.AccessToken{}
+	if user, ok := db.users[userId]; ok {
+		for _, token := range user.accessTokens {
+			list = append(list, *token.model())
+		}
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].Id < list[j].Id
+	})
+
+	return list, nil
+}
+
+func (db *memoryDB) RevokeAccessToken(ctx context.Context, id int, userId int) error {
+	if err := db.lock(ctx); err != nil {
+		return err
+	}
+	defer db.unlock()
+
+	user, ok := db.users[userId]
+	if !ok {
+		return fmt.Errorf("entry not found for the user")
+	}
+	token, ok := user.accessTokens[id]
+	if !ok {
+		return fmt.Errorf("entry not found for the user")
+	}
+	db.changeUser(user)
+	db.changeAccessToken(token.hash)
+	delete(user.accessTokens, id)
+	delete(db.accessTokens, token.hash)
+	return nil
+}
+
+func (db *memoryDB) UseAccessToken(ctx context.Context, tokenHash string) (int, string, error) {
+	if err := db.lock(ctx); err != nil {
+		return 0, "", err
+	}
+	defer db.unlock()
+
+	token, ok := db.accessTokens[tokenHash]
+	now := memoryNow()
+	if !ok || (token.ExpiresAt != nil && !token.ExpiresAt.After(now)) {
+		return 0, "", ErrInvalidAccessToken
+	}
+	db.changeAccessToken(tokenHash)
+	token.LastUsedAt = &now
+	return token.userId, token.Scope, nil
+}
+
+// removeAccessTokens forgets the tokens of the user
+func (db *memoryDB) removeAccessTokens(user *memoryUser) {
+	db.changeUser(user)
+	for _, token := range user.accessTokens {
+		db.changeAccessToken(token.hash)
+		delete(db.accessTokens, token.hash)
+	}
+	user.accessTokens = make(map[int]*memoryAccessToken)
+}
@@ -0,0 +1,85 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/ann-96/todo-go-backend/app/models"
+)
+
+var ErrInvalidAccessToken = errors.New("the access token is invalid or expired")
+
+const accessTokenColumns = "id, name, scope, expires_at, last_used_at, created_at"
+
+func (db *postgresDB) CreateAccessToken(ctx context.Context, input *models.CreateAccessTokenRequest, tokenHash string, userId int) (*models.AccessToken, error) {
+	row := db.sql.QueryRowContext(ctx, fmt.Sprintf(`
+		INSERT INTO access_tokens(userid, name, token_hash, scope, expires_at)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING %s;`, accessTokenColumns), userId, input.Name, tokenHash, input.Scope, input.ExpiresAt)
+	return scanAccessToken(row)
+}
+
+func (db *postgresDB) ListAccessTokens(ctx context.Context, userId int) ([]models.AccessToken, error) {
+	rows, err := db.sql.QueryContext(ctx, fmt.Sprintf("SELECT %s FROM access_tokens WHERE userid=$1 ORDER BY id ASC;", accessTokenColumns), userId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	list := []models.AccessToken{}
+	for rows.Next() {
+		token, err := scanAccessToken(rows)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, *token)
+	}
+
+	return list, rows.Err()
+}
+
+func (db *postgresDB) RevokeAccessToken(ctx context.Context, id int, userId int) error {
+	res, err := db.sql.ExecContext(ctx, "DELETE FROM access_tokens WHERE id=$1 AND userid=$2;", id, userId)
+	if err != nil {
+		return err
+	}
+	if deleted, err := res.RowsAffected(); err != nil {
+		return err
+	} else if deleted == 0 {
+		return fmt.Errorf("entry not found for the user")
+	}
+	return nil
+}
+
+func (db *postgresDB) UseAccessToken(ctx context.Context, tokenHash string) (int, string, error) {
+	row := db.sql.QueryRowContext(ctx, `
+		UPDATE access_tokens SET last_used_at=now()
+		WHERE token_hash=$1 AND (expires_at IS NULL OR expires_at > now())
+		RETURNING userid, scope;`, tokenHash)
+	var userId int
+	var scope string
+	if err := row.Scan(&userId, &scope); err != nil {
+		if err == sql.ErrNoRows {
+			err = ErrInvalidAccessToken
+		}
+		return 0, "", err
+	}
+	return userId, scope, nil
+}
+
+func scanAccessToken(row rowScanner) (*models.AccessToken, error) {
+	token := &models.AccessToken{}
+	var expiresAt, lastUsedAt sql.NullTime
+	if err := row.Scan(&token.Id, &token.Name, &token.Scope, &expiresAt, &lastUsedAt, &token.CreatedAt); err != nil {
+		return nil, err
+	}
+	if expiresAt.Valid {
+		token.ExpiresAt = &expiresAt.Time
+	}
+	if lastUsedAt.Valid {
+		token.LastUsedAt = &lastUsedAt.Time
+	}
+	return token, nil
+}
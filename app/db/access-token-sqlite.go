@@ -0,0 +1,77 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/ann-96/todo-go-backend/app/models"
+)
+
+func (db *sqliteDB) CreateAccessToken(ctx context.Context, input *models.CreateAccessTokenRequest, tokenHash string, userId int) (*models.AccessToken, error) {
+	row := db.sql.QueryRowContext(ctx, fmt.Sprintf(`
+		INSERT INTO access_tokens(userid, name, token_hash, scope, expires_at, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		RETURNING %s;`, accessTokenColumns), userId, input.Name, tokenHash, input.Scope, sqliteMicros(input.ExpiresAt), sqliteNow())
+	return scanSQLiteAccessToken(row)
+}
+
+func (db *sqliteDB) ListAccessTokens(ctx context.Context, userId int) ([]models.AccessToken, error) {
+	rows, err := db.sql.QueryContext(ctx, fmt.Sprintf("SELECT %s FROM access_tokens WHERE userid=$1 ORDER BY id ASC;", accessTokenColumns), userId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	list := []models.AccessToken{}
+	for rows.Next() {
+		token, err := scanSQLiteAccessToken(rows)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, *token)
+	}
+
+	return list, rows.Err()
+}
+
+func (db *sqliteDB) RevokeAccessToken(ctx context.Context, id int, userId int) error {
+	res, err := db.sql.ExecContext(ctx, "DELETE FROM access_tokens WHERE id=$1 AND userid=$2;", id, userId)
+	if err != nil {
+		return err
+	}
+	if deleted, err := res.RowsAffected(); err != nil {
+		return err
+	} else if deleted == 0 {
+		return errTodoNotFound
+	}
+	return nil
+}
+
+func (db *sqliteDB) UseAccessToken(ctx context.Context, tokenHash string) (int, string, error) {
+	row := db.sql.QueryRowContext(ctx, `
+		UPDATE access_tokens SET last_used_at=$2
+		WHERE token_hash=$1 AND (expires_at IS NULL OR expires_at > $2)
+		RETURNING userid, scope;`, tokenHash, sqliteNow())
+	var userId int
+	var scope string
+	if err := row.Scan(&userId, &scope); err != nil {
+		if err == sql.ErrNoRows {
+			err = ErrInvalidAccessToken
+		}
+		return 0, "", err
+	}
+	return userId, scope, nil
+}
+
+func scanSQLiteAccessToken(row rowScanner) (*models.AccessToken, error) {
+	token := &models.AccessToken{}
+	var expiresAt, lastUsedAt, createdAt sqliteTime
+	if err := row.Scan(&token.Id, &token.Name, &token.Scope, &expiresAt, &lastUsedAt, &createdAt); err != nil {
+		return nil, err
+	}
+	token.ExpiresAt = expiresAt.ptr()
+	token.LastUsedAt = lastUsedAt.ptr()
+	token.CreatedAt = createdAt.Time
+	return token, nil
+}
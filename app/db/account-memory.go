@@ -0,0 +1,156 @@
+package db
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/ann-96/todo-go-backend/app/models"
+)
+
+func (user *memoryUser) profile() *models.UserProfile {
+	return &models.UserProfile{
+		Id:               user.id,
+		Login:            user.login,
+		DisplayName:      user.displayName,
+		Email:            user.email,
+		TimeZone:         user.timeZone,
+		Locale:           user.locale,
+		TwoFactorEnabled: user.totpEnabled,
+		CreatedAt:        user.createdAt,
+		LastLoginAt:      memoryTime(user.lastLoginAt),
+	}
+}
+
+func (db *memoryDB) UserProfile(ctx context.Context, userId int) (*models.UserProfile, error) {
+	if err := db.rlock(ctx); err != nil {
+		return nil, err
+	}
+	defer db.runlock()
+
+	user, err := db.user(userId)
+	if err != nil {
+		return nil, err
+	}
+	return user.profile(), nil
+}
+
+func (db *memoryDB) UpdateProfile(ctx context.Context, input *models.UpdateProfileRequest, userId int) (*models.UserProfile, error) {
+	if err := db.lock(ctx); err != nil {
+		return nil, err
+	}
+	defer db.unlock()
+
+	user, err := db.user(userId)
+	if err != nil {
+		return nil, err
+	}
+	db.changeUser(user)
+
+	// a missing field keeps the value and an empty string clears it
+	if input.DisplayName != nil {
+		user.displayName = *input.DisplayName
+	}
+	if input.Email != nil {
+		user.email = *input.Email
+	}
+	if input.TimeZone != nil {
+		user.timeZone = *input.TimeZone
+	}
+	if input.Locale != nil {
+		user.locale = *input.Locale
+	}
+	return user.profile(), nil
+}
+
+func (db *memoryDB) UserTimeZone(ctx context.Context, userId int) (string, error) {
+	if err := db.rlock(ctx); err != nil {
+		return "", err
+	}
+	defer db.runlock()
+
+	if user, ok := db.users[userId]; ok {
+		return user.timeZone, nil
+	}
+	return "", nil
+}
+
+func (db *memoryDB) RecordLogin(ctx context.Context, userId int) error {
+	if err := db.lock(ctx); err != nil {
+		return err
+	}
+	defer db.unlock()
+
+	if user, ok := db.users[userId]; ok {
+		db.changeUser(user)
+		now := memoryNow()
+		user.lastLoginAt = &now
+	}
+	return nil
+}
+
+func (db *memoryDB) ExportTodos(ctx context.Context, userId int, fn func(todo *models.Todo) error) error {
+	// the todos are copied first so that fn, which may write to a slow client, runs
+	// without holding the store
+	if err := db.rlock(ctx); err != nil {
+		return err
+	}
+	todos := []models.Todo{}
+	if user, ok := db.users[userId]; ok {
+		for _, todo := range user.data.todos {
+			item := user.data.todoModel(todo)
+			item.DeletedAt = memoryTime(todo.deletedAt)
+			todos = append(todos, item)
+		}
+	}
+	db.runlock()
+
+	sort.Slice(todos, func(i, j int) bool {
+		return *todos[i].Id < *todos[j].Id
+	})
+	for i := range todos {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if err := fn(&todos[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (db *memoryDB) DeleteUser(ctx context.Context, userId int, password string, tokensExpireAt time.Time) error {
+	hash, err := db.checkPassword(ctx, userId, password)
+	if err != nil {
+		return err
+	}
+
+	if err := db.lock(ctx); err != nil {
+		return err
+	}
+	defer db.unlock()
+
+	user, err := db.checkedUser(userId, hash)
+	if err != nil {
+		return err
+	}
+
+	for tokenHash, token := range db.refreshTokens {
+		if token.userId == userId {
+			db.changeRefreshToken(tokenHash)
+			delete(db.refreshTokens, tokenHash)
+		}
+	}
+	for tokenHash, reset := range db.passwordResets {
+		if reset.userId == userId {
+			db.changePasswordReset(tokenHash)
+			delete(db.passwordResets, tokenHash)
+		}
+	}
+	db.removeAccessTokens(user)
+	db.changeUserEntry(userId, user.login)
+	delete(db.logins, user.login)
+	delete(db.users, userId)
+
+	return db.RevokeUserTokens(ctx, userId, tokensExpireAt, tokensExpireAt)
+}
@@ -0,0 +1,120 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/ann-96/todo-go-backend/app/models"
+	"github.com/ann-96/todo-go-backend/app/tools"
+)
+
+// profileColumns are the columns read by scanProfile
+const profileColumns = `id, login, COALESCE(display_name, ''), COALESCE(email, ''), COALESCE(time_zone, ''),
+	COALESCE(locale, ''), totp_enabled, created_at, last_login_at`
+
+func scanProfile(row rowScanner) (*models.UserProfile, error) {
+	res := &models.UserProfile{}
+	var lastLoginAt sql.NullTime
+	if err := row.Scan(&res.Id, &res.Login, &res.DisplayName, &res.Email, &res.TimeZone,
+		&res.Locale, &res.TwoFactorEnabled, &res.CreatedAt, &lastLoginAt); err != nil {
+		if err == sql.ErrNoRows {
+			err = fmt.Errorf("user not found")
+		}
+		return nil, err
+	}
+	if lastLoginAt.Valid {
+		res.LastLoginAt = &lastLoginAt.Time
+	}
+	return res, nil
+}
+
+func (db *postgresDB) UserProfile(ctx context.Context, userId int) (*models.UserProfile, error) {
+	return scanProfile(db.sql.QueryRowContext(ctx, fmt.Sprintf("SELECT %s FROM users WHERE id=$1;", profileColumns), userId))
+}
+
+func (db *postgresDB) UpdateProfile(ctx context.Context, input *models.UpdateProfileRequest, userId int) (*models.UserProfile, error) {
+	// a NULL parameter keeps the column and an empty string clears it
+	stmt := fmt.Sprintf(`
+		UPDATE users SET
+			display_name = CASE WHEN $1::text IS NULL THEN display_name ELSE NULLIF($1, '') END,
+			email = CASE WHEN $2::text IS NULL THEN email ELSE NULLIF($2, '') END,
+			time_zone = CASE WHEN $3::text IS NULL THEN time_zone ELSE NULLIF($3, '') END,
+			locale = CASE WHEN $4::text IS NULL THEN locale ELSE NULLIF($4, '') END
+		WHERE id=$5
+		RETURNING %s;`, profileColumns)
+	return scanProfile(db.sql.QueryRowContext(ctx, stmt, input.DisplayName, input.Email, input.TimeZone, input.Locale, userId))
+}
+
+func (db *postgresDB) UserTimeZone(ctx context.Context, userId int) (string, error) {
+	row := db.sql.QueryRowContext(ctx, "SELECT COALESCE(time_zone, '') FROM users WHERE id=$1;", userId)
+	var timeZone string
+	if err := row.Scan(&timeZone); err != nil && err != sql.ErrNoRows {
+		return "", err
+	}
+	return timeZone, nil
+}
+
+func (db *postgresDB) RecordLogin(ctx context.Context, userId int) error {
+	_, err := db.sql.ExecContext(ctx, "UPDATE users SET last_login_at=now() WHERE id=$1;", userId)
+	return err
+}
+
+func (db *postgresDB) ExportTodos(ctx context.Context, userId int, fn func(todo *models.Todo) error) error {
+	rows, err := db.sql.QueryContext(ctx, fmt.Sprintf("SELECT %s, deleted_at FROM todos WHERE userid=$1 ORDER BY id ASC;", todoColumns), userId)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var deletedAt sql.NullTime
+		todo, err := scanTodo(rows, &deletedAt)
+		if err != nil {
+			return err
+		}
+		if deletedAt.Valid {
+			todo.DeletedAt = &deletedAt.Time
+		}
+		if err := fn(todo); err != nil {
+			return err
+		}
+	}
+
+	return rows.Err()
+}
+
+func (db *postgresDB) DeleteUser(ctx context.Context, userId int, password string, tokensExpireAt time.Time) error {
+	tx, err := db.sql.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	row := tx.QueryRowContext(ctx, "SELECT passwordhash FROM users WHERE id=$1 FOR UPDATE;", userId)
+	var hash string
+	if err := row.Scan(&hash); err != nil {
+		if err == sql.ErrNoRows {
+			err = ErrWrongPassword
+		}
+		return err
+	}
+	ok, _, err := tools.VerifyPassword(password, hash)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return ErrWrongPassword
+	}
+
+	// the todos, tags, lists and tokens of the user go along through the cascades
+	if _, err := tx.ExecContext(ctx, "DELETE FROM users WHERE id=$1;", userId); err != nil {
+		return err
+	}
+	if err := revokeUserTokens(ctx, tx, userId, tokensExpireAt, tokensExpireAt); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
@@ -0,0 +1,100 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/ann-96/todo-go-backend/app/models"
+)
+
+func scanSQLiteProfile(row rowScanner) (*models.UserProfile, error) {
+	res := &models.UserProfile{}
+	var createdAt, lastLoginAt sqliteTime
+	if err := row.Scan(&res.Id, &res.Login, &res.DisplayName, &res.Email, &res.TimeZone,
+		&res.Locale, &res.TwoFactorEnabled, &createdAt, &lastLoginAt); err != nil {
+		if err == sql.ErrNoRows {
+			err = errUserNotFound
+		}
+		return nil, err
+	}
+	res.CreatedAt = createdAt.Time
+	res.LastLoginAt = lastLoginAt.ptr()
+	return res, nil
+}
+
+func (db *sqliteDB) UserProfile(ctx context.Context, userId int) (*models.UserProfile, error) {
+	return scanSQLiteProfile(db.sql.QueryRowContext(ctx, fmt.Sprintf("SELECT %s FROM users WHERE id=$1;", profileColumns), userId))
+}
+
+func (db *sqliteDB) UpdateProfile(ctx context.Context, input *models.UpdateProfileRequest, userId int) (*models.UserProfile, error) {
+	// a NULL parameter keeps the column and an empty string clears it
+	stmt := fmt.Sprintf(`
+		UPDATE users SET
+			display_name = CASE WHEN $1 IS NULL THEN display_name ELSE NULLIF($1, '') END,
+			email = CASE WHEN $2 IS NULL THEN email ELSE NULLIF($2, '') END,
+			time_zone = CASE WHEN $3 IS NULL THEN time_zone ELSE NULLIF($3, '') END,
+			locale = CASE WHEN $4 IS NULL THEN locale ELSE NULLIF($4, '') END
+		WHERE id=$5
+		RETURNING %s;`, profileColumns)
+	return scanSQLiteProfile(db.sql.QueryRowContext(ctx, stmt, input.DisplayName, input.Email, input.TimeZone, input.Locale, userId))
+}
+
+func (db *sqliteDB) UserTimeZone(ctx context.Context, userId int) (string, error) {
+	row := db.sql.QueryRowContext(ctx, "SELECT COALESCE(time_zone, '') FROM users WHERE id=$1;", userId)
+	var timeZone string
+	if err := row.Scan(&timeZone); err != nil && err != sql.ErrNoRows {
+		return "", err
+	}
+	return timeZone, nil
+}
+
+func (db *sqliteDB) RecordLogin(ctx context.Context, userId int) error {
+	_, err := db.sql.ExecContext(ctx, "UPDATE users SET last_login_at=$1 WHERE id=$2;", sqliteNow(), userId)
+	return err
+}
+
+func (db *sqliteDB) ExportTodos(ctx context.Context, userId int, fn func(todo *models.Todo) error) error {
+	rows, err := db.sql.QueryContext(ctx, fmt.Sprintf("SELECT %s, deleted_at FROM todos WHERE userid=$1 ORDER BY id ASC;", sqliteTodoColumns), userId)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var deletedAt sqliteTime
+		todo, err := scanSQLiteTodo(rows, &deletedAt)
+		if err != nil {
+			return err
+		}
+		todo.DeletedAt = deletedAt.ptr()
+		if err := fn(todo); err != nil {
+			return err
+		}
+	}
+
+	return rows.Err()
+}
+
+func (db *sqliteDB) DeleteUser(ctx context.Context, userId int, password string, tokensExpireAt time.Time) error {
+	tx, err := db.sql.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := sqliteCheckPassword(ctx, tx, userId, password); err != nil {
+		return err
+	}
+
+	// the todos, tags, lists and tokens of the user go along through the cascades
+	if _, err := tx.ExecContext(ctx, "DELETE FROM users WHERE id=$1;", userId); err != nil {
+		return err
+	}
+	if err := sqliteRevokeUserTokens(ctx, tx, userId, tokensExpireAt, tokensExpireAt); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
@@ -0,0 +1,99 @@
+package db
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/ann-96/todo-go-backend/app/models"
+)
+
+func (db *memoryDB) Batch(ctx context.Context, input *models.Batch, userId int) (*models.BatchResult, error) {
+	if err := db.lock(ctx); err != nil {
+		return nil, err
+	}
+	defer db.unlock()
+
+	user, err := db.user(userId)
+	if err != nil {
+		return nil, err
+	}
+	db.changeUser(user)
+
+	// the batch works on a copy that replaces the data of the user once everything went through
+	batch := &memoryUser{id: user.id, data: user.data.clone()}
+	res := &models.BatchResult{
+		Results: []models.BatchOperationResult{},
+	}
+	for i, op := range input.Operations {
+		result := models.BatchOperationResult{Index: input.Indexes[i]}
+
+		var saved *memoryData
+		if input.BestEffort {
+			saved = batch.data.clone()
+		}
+
+		result.Todo, err = db.batchOperation(batch, &op)
+		if err != nil {
+			result.Error = err.Error()
+			res.Results = append(res.Results, result)
+			if !input.BestEffort {
+				return res, nil
+			}
+			batch.data = saved
+			continue
+		}
+
+		result.Ok = true
+		res.Results = append(res.Results, result)
+	}
+
+	if input.Action != "" {
+		if res.Affected, err = batchMemoryAction(batch.data, input.Action, input.Filter); err != nil {
+			return nil, err
+		}
+	}
+
+	user.data = batch.data
+	res.Committed = true
+
+	return res, nil
+}
+
+func (db *memoryDB) batchOperation(user *memoryUser, op *models.BatchOperation) (*models.Todo, error) {
+	switch op.Op {
+	case models.BatchAdd:
+		return db.addTodo(user, &op.Todo.AddTodoRequest)
+	case models.BatchUpdate:
+		return db.updateTodo(user, op.Todo)
+	case models.BatchDelete:
+		return nil, deleteMemoryTodo(user.data, *op.Id)
+	}
+	return nil, fmt.Errorf("unknown operation %q", op.Op)
+}
+
+func batchMemoryAction(data *memoryData, action string, filter *models.TodoFilter) (int, error) {
+	now := memoryNow()
+	matching := []*memoryTodo{}
+	for _, todo := range data.todos {
+		if todo.deletedAt == nil && data.matches(todo, filter, now) {
+			matching = append(matching, todo)
+		}
+	}
+
+	switch action {
+	case models.BatchActionDelete:
+		ids := make([]int, 0, len(matching))
+		for _, todo := range matching {
+			ids = append(ids, todo.id)
+		}
+		data.trash(ids, now)
+	case models.BatchActionComplete, models.BatchActionUncomplete:
+		for _, todo := range matching {
+			todo.completed = action == models.BatchActionComplete
+			todo.updatedAt = now
+		}
+	default:
+		return 0, fmt.Errorf("unknown action %q", action)
+	}
+	return len(matching), nil
+}
@@ -0,0 +1,99 @@
+package db
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/ann-96/todo-go-backend/app/models"
+)
+
+func (db *postgresDB) Batch(ctx context.Context, input *models.Batch, userId int) (*models.BatchResult, error) {
+	tx, err := db.sql.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	res := &models.BatchResult{
+		Results: []models.BatchOperationResult{},
+	}
+	for i, op := range input.Operations {
+		result := models.BatchOperationResult{Index: input.Indexes[i]}
+
+		// a failed statement aborts the transaction unless it is rolled back to a savepoint
+		if input.BestEffort {
+			if _, err := tx.ExecContext(ctx, "SAVEPOINT batch_operation;"); err != nil {
+				return nil, err
+			}
+		}
+
+		result.Todo, err = batchOperation(ctx, tx, &op, userId)
+		if err != nil {
+			result.Error = err.Error()
+			res.Results = append(res.Results, result)
+			if !input.BestEffort {
+				return res, nil
+			}
+			if _, err := tx.ExecContext(ctx, "ROLLBACK TO SAVEPOINT batch_operation;"); err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		if input.BestEffort {
+			if _, err := tx.ExecContext(ctx, "RELEASE SAVEPOINT batch_operation;"); err != nil {
+				return nil, err
+			}
+		}
+		result.Ok = true
+		res.Results = append(res.Results, result)
+	}
+
+	if input.Action != "" {
+		if res.Affected, err = batchAction(ctx, tx, input.Action, input.Filter, userId); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	res.Committed = true
+
+	return res, nil
+}
+
+func batchOperation(ctx context.Context, tx *sqlTx, op *models.BatchOperation, userId int) (*models.Todo, error) {
+	switch op.Op {
+	case models.BatchAdd:
+		return addTodo(ctx, tx, &op.Todo.AddTodoRequest, userId)
+	case models.BatchUpdate:
+		return updateTodo(ctx, tx, op.Todo, userId)
+	case models.BatchDelete:
+		return nil, deleteTodo(ctx, tx, *op.Id, userId)
+	}
+	return nil, fmt.Errorf("unknown operation %q", op.Op)
+}
+
+func batchAction(ctx context.Context, tx *sqlTx, action string, filter *models.TodoFilter, userId int) (int, error) {
+	where, args := todoFilterConditions(filter, userId)
+
+	var stmt string
+	switch action {
+	case models.BatchActionDelete:
+		return trashMatching(ctx, tx, where, args, userId)
+	case models.BatchActionComplete:
+		stmt = fmt.Sprintf("UPDATE todos SET completed=true, updated_at=now() WHERE %s;", where)
+	case models.BatchActionUncomplete:
+		stmt = fmt.Sprintf("UPDATE todos SET completed=false, updated_at=now() WHERE %s;", where)
+	default:
+		return 0, fmt.Errorf("unknown action %q", action)
+	}
+
+	res, err := tx.ExecContext(ctx, stmt, args...)
+	if err != nil {
+		return 0, err
+	}
+	affected, err := res.RowsAffected()
+	return int(affected), err
+}
@@ -0,0 +1,1222 @@
+package db_test
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	appdb "github.com/ann-96/todo-go-backend/app/db"
+	"github.com/ann-96/todo-go-backend/app/models"
+	"github.com/ann-96/todo-go-backend/app/tools"
+	"github.com/stretchr/testify/require"
+)
+
+// TestConformance runs the same checks against every store, postgres only when TEST_SQL_HOST
+// points at a database the test may fill
+func TestConformance(t *testing.T) {
+	stores := map[string]func(t *testing.T) appdb.Store{
+		appdb.DriverMemory: func(t *testing.T) appdb.Store {
+			return openStore(t, appdb.Settings{Driver: appdb.DriverMemory})
+		},
+		appdb.DriverSQLite: func(t *testing.T) appdb.Store {
+			return openStore(t, appdb.Settings{
+				Driver: appdb.DriverSQLite,
+				Path:   filepath.Join(t.TempDir(), "todos.db"),
+			})
+		},
+		appdb.DriverPostgres: func(t *testing.T) appdb.Store {
+			host := os.Getenv("TEST_SQL_HOST")
+			if host == "" {
+				t.Skip("TEST_SQL_HOST is not set")
+			}
+			return openStore(t, appdb.Settings{
+				Driver:   appdb.DriverPostgres,
+				IP:       host,
+				Port:     envOr("TEST_SQL_PORT", "5432"),
+				User:     envOr("TEST_SQL_USER", "postgres"),
+				Password: envOr("TEST_SQL_PASS", "postgres"),
+				Name:     envOr("TEST_SQL_DBNAME", "postgres"),
+			})
+		},
+	}
+
+	checks := []struct {
+		name  string
+		check func(t *testing.T, store appdb.Store)
+	}{
+		{"Users", checkUsers},
+		{"Profile", checkProfile},
+		{"Todos", checkTodos},
+		{"Filters", checkFilters},
+		{"Cursor", checkCursor},
+		{"Subtasks", checkSubtasks},
+		{"Reorder", checkReorder},
+		{"Trash", checkTrash},
+		{"Tags", checkTags},
+		{"Lists", checkLists},
+		{"Search", checkSearch},
+		{"Batch", checkBatch},
+		{"RefreshTokens", checkRefreshTokens},
+		{"Passwords", checkPasswords},
+		{"LegacyPassword", checkLegacyPassword},
+		{"TwoFactor", checkTwoFactor},
+		{"AccessTokens", checkAccessTokens},
+		{"Revocation", checkRevocation},
+		{"Attempts", checkAttempts},
+		{"DeleteUser", checkDeleteUser},
+		{"Transactions", checkTransactions},
+		{"Cancel", checkCancel},
+	}
+
+	for name, open := range stores {
+		t.Run(name, func(t *testing.T) {
+			store := open(t)
+			for _, c := range checks {
+				t.Run(c.name, func(t *testing.T) {
+					c.check(t, store)
+				})
+			}
+		})
+	}
+}
+
+// TestMigrations steps through the embedded migrations on a database of its own
+func TestMigrations(t *testing.T) {
+	store, err := appdb.Open(appdb.Settings{Driver: appdb.DriverSQLite, Path: filepath.Join(t.TempDir(), "todos.db")})
+	require.NoError(t, err)
+
+	status, err := store.MigrationStatus()
+	require.NoError(t, err)
+	require.Equal(t, uint(0), status.Version)
+	require.False(t, status.Dirty)
+	require.Greater(t, status.Latest, uint(0))
+	latest := status.Latest
+
+	require.NoError(t, store.Migrate())
+	require.NoError(t, store.Migrate())
+	status, err = store.MigrationStatus()
+	require.NoError(t, err)
+	require.Equal(t, &appdb.MigrationStatus{Version: latest, Latest: latest}, status)
+
+	require.NoError(t, store.MigrateSteps(-1))
+	status, err = store.MigrationStatus()
+	require.NoError(t, err)
+	require.Equal(t, latest-1, status.Version)
+
+	require.NoError(t, store.MigrateTo(latest))
+	require.NoError(t, store.ForceMigration(int(latest)))
+	status, err = store.MigrationStatus()
+	require.NoError(t, err)
+	require.Equal(t, latest, status.Version)
+	require.Error(t, store.MigrateTo(latest+1))
+	register(t, store)
+
+	memory, err := appdb.Open(appdb.Settings{Driver: appdb.DriverMemory})
+	require.NoError(t, err)
+	require.NoError(t, memory.Migrate())
+	_, err = memory.MigrationStatus()
+	require.ErrorIs(t, err, appdb.ErrNoMigrations)
+	require.ErrorIs(t, memory.MigrateSteps(-1), appdb.ErrNoMigrations)
+}
+
+func openStore(t *testing.T, settings appdb.Settings) appdb.Store {
+	store, err := appdb.Open(settings)
+	require.NoError(t, err)
+	require.NoError(t, store.Migrate())
+	return store
+}
+
+func envOr(key string, fallback string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return fallback
+}
+
+var lastLogin int64
+
+// register adds a user with a login no other check or earlier run uses
+func register(t *testing.T, store appdb.Store) (int, string) {
+	login := fmt.Sprintf("user%d%d", time.Now().UnixNano()%1e9, atomic.AddInt64(&lastLogin, 1))
+	password := "Str0ng-passw0rd"
+	id, err := store.Register(context.Background(), &models.RegisterRequest{
+		LoginRequest: models.LoginRequest{Login: &login, Password: &password},
+	})
+	require.NoError(t, err)
+
+	loggedIn, err := store.Login(context.Background(), &models.LoginRequest{Login: &login, Password: &password})
+	require.NoError(t, err)
+	require.Equal(t, id, *loggedIn)
+	return id, login
+}
+
+const password = "Str0ng-passw0rd"
+
+type todoOption func(todo *models.AddTodoRequest)
+
+func addTodo(t *testing.T, store appdb.Store, userId int, text string, options ...todoOption) models.Todo {
+	completed := false
+	input := &models.AddTodoRequest{Text: &text, Completed: &completed}
+	for _, option := range options {
+		option(input)
+	}
+	todo, err := store.Add(context.Background(), input, userId)
+	require.NoError(t, err)
+	return *todo
+}
+
+func completed(todo *models.AddTodoRequest) {
+	done := true
+	todo.Completed = &done
+}
+
+func withTags(tags ...string) todoOption {
+	return func(todo *models.AddTodoRequest) { todo.Tags = tags }
+}
+
+func inList(listId int) todoOption {
+	return func(todo *models.AddTodoRequest) { todo.ListId = &listId }
+}
+
+func under(parentId int) todoOption {
+	return func(todo *models.AddTodoRequest) { todo.ParentId = &parentId }
+}
+
+func due(at time.Time) todoOption {
+	return func(todo *models.AddTodoRequest) { todo.Due = &at }
+}
+
+func listTodos(t *testing.T, store appdb.TodoStore, userId int, filter *models.TodoFilter) *models.TodoList {
+	list, err := store.List(context.Background(), 0, 100, filter, userId)
+	require.NoError(t, err)
+	return list
+}
+
+func texts(todos []models.Todo) []string {
+	res := []string{}
+	for _, todo := range todos {
+		res = append(res, *todo.Text)
+	}
+	return res
+}
+
+func checkUsers(t *testing.T, store appdb.Store) {
+	ctx := context.Background()
+	userId, login := register(t, store)
+
+	pass := password
+	_, err := store.Register(ctx, &models.RegisterRequest{LoginRequest: models.LoginRequest{Login: &login, Password: &pass}})
+	require.ErrorIs(t, err, appdb.ErrUserExists)
+
+	wrong := "wrong-password"
+	_, err = store.Login(ctx, &models.LoginRequest{Login: &login, Password: &wrong})
+	require.Error(t, err)
+	unknown := login + "x"
+	_, err = store.Login(ctx, &models.LoginRequest{Login: &unknown, Password: &pass})
+	require.Error(t, err)
+
+	require.NoError(t, store.VerifyPassword(ctx, userId, password))
+	require.ErrorIs(t, store.VerifyPassword(ctx, userId, wrong), appdb.ErrWrongPassword)
+	require.ErrorIs(t, store.VerifyPassword(ctx, userId+1000000, password), appdb.ErrWrongPassword)
+}
+
+func checkProfile(t *testing.T, store appdb.Store) {
+	ctx := context.Background()
+	userId, login := register(t, store)
+
+	profile, err := store.UserProfile(ctx, userId)
+	require.NoError(t, err)
+	require.Equal(t, login, profile.Login)
+	require.Equal(t, userId, profile.Id)
+	require.Nil(t, profile.LastLoginAt)
+	require.WithinDuration(t, time.Now(), profile.CreatedAt, time.Minute)
+
+	name, zone := "Alice", "Europe/Paris"
+	profile, err = store.UpdateProfile(ctx, &models.UpdateProfileRequest{DisplayName: &name, TimeZone: &zone}, userId)
+	require.NoError(t, err)
+	require.Equal(t, "Alice", profile.DisplayName)
+	require.Equal(t, "Europe/Paris", profile.TimeZone)
+
+	empty := ""
+	profile, err = store.UpdateProfile(ctx, &models.UpdateProfileRequest{DisplayName: &empty}, userId)
+	require.NoError(t, err)
+	require.Equal(t, "", profile.DisplayName)
+	require.Equal(t, "Europe/Paris", profile.TimeZone)
+
+	timeZone, err := store.UserTimeZone(ctx, userId)
+	require.NoError(t, err)
+	require.Equal(t, "Europe/Paris", timeZone)
+
+	require.NoError(t, store.RecordLogin(ctx, userId))
+	profile, err = store.UserProfile(ctx, userId)
+	require.NoError(t, err)
+	require.NotNil(t, profile.LastLoginAt)
+
+	_, err = store.UserProfile(ctx, userId+1000000)
+	require.Error(t, err)
+}
+
+func checkTodos(t *testing.T, store appdb.Store) {
+	ctx := context.Background()
+	userId, _ := register(t, store)
+	otherId, _ := register(t, store)
+
+	at := time.Date(2030, 5, 6, 7, 8, 9, 123456000, time.UTC)
+	first := addTodo(t, store, userId, "first todo", withTags("work", "home", "work"), due(at))
+	require.Equal(t, "first todo", *first.Text)
+	require.False(t, *first.Completed)
+	require.Equal(t, []string{"home", "work"}, first.Tags)
+	require.True(t, first.Due.Equal(at))
+	require.Nil(t, first.ListId)
+	require.NotNil(t, first.CreatedAt)
+	second := addTodo(t, store, userId, "second todo", completed)
+	require.Greater(t, *second.Position, *first.Position)
+	require.Equal(t, []string{}, second.Tags)
+
+	text, done := "first todo changed", true
+	update := &models.Todo{Id: first.Id, AddTodoRequest: models.AddTodoRequest{Text: &text, Completed: &done, Tags: []string{"home"}}}
+	updated, err := store.Update(ctx, update, userId)
+	require.NoError(t, err)
+	require.Equal(t, text, *updated.Text)
+	require.True(t, *updated.Completed)
+	require.Nil(t, updated.Due)
+	require.Equal(t, []string{"home"}, updated.Tags)
+	require.False(t, updated.UpdatedAt.Before(*first.UpdatedAt))
+
+	// a nil tag list keeps the tags
+	update.Tags = nil
+	updated, err = store.Update(ctx, update, userId)
+	require.NoError(t, err)
+	require.Equal(t, []string{"home"}, updated.Tags)
+
+	_, err = store.Update(ctx, update, otherId)
+	require.Error(t, err)
+	require.Error(t, store.Delete(ctx, *first.Id, otherId))
+
+	list := listTodos(t, store, userId, nil)
+	require.Equal(t, []string{text, "second todo"}, texts(list.List))
+	require.Equal(t, 2, list.Count)
+	require.Equal(t, 2, list.CompletedCount)
+	require.Empty(t, listTodos(t, store, otherId, nil).List)
+
+	page, err := store.List(ctx, 1, 1, nil, userId)
+	require.NoError(t, err)
+	require.Equal(t, []string{"second todo"}, texts(page.List))
+	require.Equal(t, 2, page.Count)
+
+	require.NoError(t, store.Delete(ctx, *first.Id, userId))
+	require.Error(t, store.Delete(ctx, *first.Id, userId))
+	_, err = store.Update(ctx, update, userId)
+	require.Error(t, err)
+	require.Equal(t, []string{"second todo"}, texts(listTodos(t, store, userId, nil).List))
+
+	var exported []string
+	err = store.ExportTodos(ctx, userId, func(todo *models.Todo) error {
+		exported = append(exported, fmt.Sprintf("%s %v", *todo.Text, todo.DeletedAt != nil))
+		return nil
+	})
+	require.NoError(t, err)
+	require.Equal(t, []string{text + " true", "second todo false"}, exported)
+}
+
+func checkFilters(t *testing.T, store appdb.Store) {
+	ctx := context.Background()
+	userId, _ := register(t, store)
+
+	list, err := store.AddList(ctx, &models.AddListRequest{Name: stringPtr("errands")}, userId)
+	require.NoError(t, err)
+	past, future := time.Now().Add(-48*time.Hour), time.Now().Add(48*time.Hour)
+	addTodo(t, store, userId, "Buy Milk", withTags("shop"), inList(*list.Id), due(past))
+	addTodo(t, store, userId, "Pay the ÉLECTRICITY bill", withTags("bills", "home"), due(future))
+	addTodo(t, store, userId, "Clean the house", withTags("home"), completed, due(past))
+
+	yes := true
+	cases := []struct {
+		filter models.TodoFilter
+		texts  []string
+	}{
+		{models.TodoFilter{Overdue: true}, []string{"Buy Milk"}},
+		{models.TodoFilter{DueFrom: &past}, []string{"Buy Milk", "Pay the ÉLECTRICITY bill", "Clean the house"}},
+		{models.TodoFilter{DueTo: &future}, []string{"Buy Milk", "Clean the house"}},
+		{models.TodoFilter{Completed: &yes}, []string{"Clean the house"}},
+		{models.TodoFilter{Query: "milk"}, []string{"Buy Milk"}},
+		{models.TodoFilter{Query: "électricity"}, []string{"Pay the ÉLECTRICITY bill"}},
+		{models.TodoFilter{Tags: []string{"home", "shop"}}, []string{"Buy Milk", "Pay the ÉLECTRICITY bill", "Clean the house"}},
+		{models.TodoFilter{Tags: []string{"home", "bills"}, AllTags: true}, []string{"Pay the ÉLECTRICITY bill"}},
+		{models.TodoFilter{ListId: list.Id}, []string{"Buy Milk"}},
+		{models.TodoFilter{Inbox: true}, []string{"Pay the ÉLECTRICITY bill", "Clean the house"}},
+		{models.TodoFilter{Sort: models.SortText}, []string{"Buy Milk", "Clean the house", "Pay the ÉLECTRICITY bill"}},
+		{models.TodoFilter{Sort: models.SortCompleted, Desc: true}, []string{"Clean the house", "Pay the ÉLECTRICITY bill", "Buy Milk"}},
+		{models.TodoFilter{Sort: models.SortCreated, Desc: true}, []string{"Clean the house", "Pay the ÉLECTRICITY bill", "Buy Milk"}},
+	}
+	for _, c := range cases {
+		filter := c.filter
+		list := listTodos(t, store, userId, &filter)
+		require.Equal(t, c.texts, texts(list.List), "%+v", filter)
+		require.Equal(t, len(c.texts), list.Count, "%+v", filter)
+	}
+
+	// the counts are those of the todos matching the filter, without one those of the user
+	all := listTodos(t, store, userId, &models.TodoFilter{Tags: []string{"home"}})
+	require.Equal(t, 2, all.Count)
+	require.Equal(t, 1, all.CompletedCount)
+	require.Equal(t, 0, all.OverdueCount)
+	all = listTodos(t, store, userId, nil)
+	require.Equal(t, 3, all.Count)
+	require.Equal(t, 1, all.CompletedCount)
+	require.Equal(t, 1, all.OverdueCount)
+	page, err := store.List(ctx, 1, 1, nil, userId)
+	require.NoError(t, err)
+	require.Len(t, page.List, 1)
+	require.Equal(t, 3, page.Count)
+
+	_, err = store.List(ctx, 0, 10, &models.TodoFilter{Sort: "task; DROP TABLE todos"}, userId)
+	require.Error(t, err)
+}
+
+func checkCursor(t *testing.T, store appdb.Store) {
+	ctx := context.Background()
+	userId, _ := register(t, store)
+	for i := 0; i < 7; i++ {
+		addTodo(t, store, userId, fmt.Sprintf("todo %d", i%3))
+	}
+
+	for _, sort := range []string{models.SortPosition, models.SortText, models.SortCreated, models.SortId} {
+		for _, desc := range []bool{false, true} {
+			filter := &models.TodoFilter{Sort: sort, Desc: desc, Keyset: true}
+			offset := listTodos(t, store, userId, &models.TodoFilter{Sort: sort, Desc: desc})
+
+			var seen []int
+			pages := [][]int{}
+			for {
+				page, err := store.List(ctx, 0, 3, filter, userId)
+				require.NoError(t, err)
+				ids := []int{}
+				for _, todo := range page.List {
+					ids = append(ids, *todo.Id)
+				}
+				pages = append(pages, ids)
+				seen = append(seen, ids...)
+				if page.NextCursor == "" {
+					break
+				}
+				cursor, err := models.DecodeCursor(page.NextCursor)
+				require.NoError(t, err)
+				filter = &models.TodoFilter{Sort: sort, Desc: desc, Keyset: true, Cursor: cursor}
+			}
+
+			expected := []int{}
+			for _, todo := range offset.List {
+				expected = append(expected, *todo.Id)
+			}
+			require.Equal(t, expected, seen, "sort %s desc %v", sort, desc)
+			require.Len(t, pages, 3)
+
+			// the last page leads back to the one before it
+			page, err := store.List(ctx, 0, 3, filter, userId)
+			require.NoError(t, err)
+			cursor, err := models.DecodeCursor(page.PrevCursor)
+			require.NoError(t, err)
+			back, err := store.List(ctx, 0, 3, &models.TodoFilter{Sort: sort, Desc: desc, Keyset: true, Cursor: cursor}, userId)
+			require.NoError(t, err)
+			require.Equal(t, pages[1], idsOf(back.List))
+		}
+	}
+}
+
+func idsOf(todos []models.Todo) []int {
+	res := []int{}
+	for _, todo := range todos {
+		res = append(res, *todo.Id)
+	}
+	return res
+}
+
+func checkSubtasks(t *testing.T, store appdb.Store) {
+	ctx := context.Background()
+	userId, _ := register(t, store)
+	otherId, _ := register(t, store)
+
+	root := addTodo(t, store, userId, "root todo")
+	child := addTodo(t, store, userId, "child todo", under(*root.Id))
+	addTodo(t, store, userId, "grandchild todo", under(*child.Id), completed)
+	addTodo(t, store, userId, "other root")
+
+	text := "stolen child"
+	completedValue := false
+	_, err := store.Add(ctx, &models.AddTodoRequest{Text: &text, Completed: &completedValue, ParentId: root.Id}, otherId)
+	require.Error(t, err)
+
+	tree := listTodos(t, store, userId, &models.TodoFilter{View: models.ViewTree})
+	require.Equal(t, []string{"root todo", "other root"}, texts(tree.List))
+	require.Equal(t, 2, tree.Count)
+	require.Equal(t, []string{"child todo"}, texts(tree.List[0].Children))
+	require.Equal(t, []string{"grandchild todo"}, texts(tree.List[0].Children[0].Children))
+	require.Equal(t, &models.Progress{Done: 1, Total: 2}, tree.List[0].Progress)
+
+	flat := listTodos(t, store, userId, &models.TodoFilter{View: models.ViewFlat})
+	require.Equal(t, []string{"root todo", "child todo", "grandchild todo", "other root"}, texts(flat.List))
+	require.Equal(t, 2, *flat.List[2].Depth)
+
+	done := true
+	_, err = store.Update(ctx, &models.Todo{Id: root.Id, CompleteChildren: true,
+		AddTodoRequest: models.AddTodoRequest{Text: root.Text, Completed: &done}}, userId)
+	require.NoError(t, err)
+	for _, todo := range listTodos(t, store, userId, &models.TodoFilter{View: models.ViewFlat}).List[:3] {
+		require.True(t, *todo.Completed, *todo.Text)
+	}
+}
+
+func checkReorder(t *testing.T, store appdb.Store) {
+	ctx := context.Background()
+	userId, _ := register(t, store)
+	a := addTodo(t, store, userId, "todo a")
+	b := addTodo(t, store, userId, "todo b")
+	c := addTodo(t, store, userId, "todo c")
+
+	_, err := store.ReorderTodo(ctx, &models.ReorderTodoRequest{Id: c.Id, Before: a.Id}, userId)
+	require.NoError(t, err)
+	require.Equal(t, []string{"todo c", "todo a", "todo b"}, texts(listTodos(t, store, userId, nil).List))
+
+	// moving back and forth halves the gap until the positions are rebalanced
+	for i := 0; i < 12; i++ {
+		_, err = store.ReorderTodo(ctx, &models.ReorderTodoRequest{Id: b.Id, After: c.Id}, userId)
+		require.NoError(t, err)
+		_, err = store.ReorderTodo(ctx, &models.ReorderTodoRequest{Id: c.Id, After: b.Id}, userId)
+		require.NoError(t, err)
+	}
+	require.Equal(t, []string{"todo b", "todo c", "todo a"}, texts(listTodos(t, store, userId, nil).List))
+
+	moved, err := store.ReorderTodo(ctx, &models.ReorderTodoRequest{Id: b.Id, After: a.Id}, userId)
+	require.NoError(t, err)
+	require.Equal(t, []string{"todo c", "todo a", "todo b"}, texts(listTodos(t, store, userId, nil).List))
+	require.Equal(t, "todo b", *moved.Text)
+
+	otherId, _ := register(t, store)
+	_, err = store.ReorderTodo(ctx, &models.ReorderTodoRequest{Id: b.Id, After: a.Id}, otherId)
+	require.Error(t, err)
+}
+
+func checkTrash(t *testing.T, store appdb.Store) {
+	ctx := context.Background()
+	userId, _ := register(t, store)
+
+	parent := addTodo(t, store, userId, "parent todo")
+	child := addTodo(t, store, userId, "child todo", under(*parent.Id), completed)
+	other := addTodo(t, store, userId, "other todo")
+
+	require.NoError(t, store.Delete(ctx, *parent.Id, userId))
+	require.Equal(t, []string{"other todo"}, texts(listTodos(t, store, userId, nil).List))
+
+	trash, err := store.ListTrash(ctx, 0, 10, userId)
+	require.NoError(t, err)
+	require.Equal(t, 2, trash.Count)
+	require.Equal(t, 1, trash.CompletedCount)
+	require.ElementsMatch(t, []string{"parent todo", "child todo"}, texts(trash.List))
+	require.NotNil(t, trash.List[0].DeletedAt)
+
+	_, err = store.RestoreTodo(ctx, *other.Id, userId)
+	require.Error(t, err)
+
+	// the child comes back alone as a top level todo while its parent stays in the trash
+	restored, err := store.RestoreTodo(ctx, *child.Id, userId)
+	require.NoError(t, err)
+	require.Nil(t, restored.ParentId)
+	require.Nil(t, restored.DeletedAt)
+	require.NoError(t, store.Delete(ctx, *child.Id, userId))
+
+	restored, err = store.RestoreTodo(ctx, *parent.Id, userId)
+	require.NoError(t, err)
+	require.Equal(t, "parent todo", *restored.Text)
+	require.Equal(t, []string{"parent todo", "other todo"}, texts(listTodos(t, store, userId, nil).List))
+
+	require.NoError(t, store.Delete(ctx, *parent.Id, userId))
+	emptied, err := store.EmptyTrash(ctx, userId)
+	require.NoError(t, err)
+	require.Equal(t, 2, emptied)
+	trash, err = store.ListTrash(ctx, 0, 10, userId)
+	require.NoError(t, err)
+	require.Empty(t, trash.List)
+
+	require.NoError(t, store.Delete(ctx, *other.Id, userId))
+	purged, err := store.PurgeTrash(ctx, time.Now().Add(-time.Hour))
+	require.NoError(t, err)
+	require.Equal(t, 1, countTrash(t, store, userId))
+	purged, err = store.PurgeTrash(ctx, time.Now().Add(time.Minute))
+	require.NoError(t, err)
+	require.GreaterOrEqual(t, purged, 1)
+	require.Equal(t, 0, countTrash(t, store, userId))
+}
+
+func countTrash(t *testing.T, store appdb.Store, userId int) int {
+	trash, err := store.ListTrash(context.Background(), 0, 10, userId)
+	require.NoError(t, err)
+	return trash.Count
+}
+
+func checkTags(t *testing.T, store appdb.Store) {
+	ctx := context.Background()
+	userId, _ := register(t, store)
+	otherId, _ := register(t, store)
+
+	work, err := store.AddTag(ctx, &models.AddTagRequest{Name: stringPtr("work")}, userId)
+	require.NoError(t, err)
+	_, err = store.AddTag(ctx, &models.AddTagRequest{Name: stringPtr("work")}, userId)
+	require.ErrorIs(t, err, appdb.ErrTagExists)
+	_, err = store.AddTag(ctx, &models.AddTagRequest{Name: stringPtr("work")}, otherId)
+	require.NoError(t, err)
+
+	todo := addTodo(t, store, userId, "tagged todo", withTags("work", "errands"))
+	tags, err := store.ListTags(ctx, userId)
+	require.NoError(t, err)
+	require.Equal(t, []string{"errands", "work"}, tagNames(tags))
+
+	_, err = store.UpdateTag(ctx, &models.Tag{Id: work.Id, AddTagRequest: models.AddTagRequest{Name: stringPtr("errands")}}, userId)
+	require.ErrorIs(t, err, appdb.ErrTagExists)
+	_, err = store.UpdateTag(ctx, &models.Tag{Id: work.Id, AddTagRequest: models.AddTagRequest{Name: stringPtr("job")}}, otherId)
+	require.Error(t, err)
+	_, err = store.UpdateTag(ctx, &models.Tag{Id: work.Id, AddTagRequest: models.AddTagRequest{Name: stringPtr("job")}}, userId)
+	require.NoError(t, err)
+	require.Equal(t, []string{"errands", "job"}, listTodos(t, store, userId, nil).List[0].Tags)
+
+	require.Error(t, store.DeleteTag(ctx, *work.Id, otherId))
+	require.NoError(t, store.DeleteTag(ctx, *work.Id, userId))
+	require.Error(t, store.DeleteTag(ctx, *work.Id, userId))
+	list := listTodos(t, store, userId, nil)
+	require.Equal(t, *todo.Id, *list.List[0].Id)
+	require.Equal(t, []string{"errands"}, list.List[0].Tags)
+}
+
+func tagNames(tags []models.Tag) []string {
+	res := []string{}
+	for _, tag := range tags {
+		res = append(res, *tag.Name)
+	}
+	return res
+}
+
+func stringPtr(s string) *string {
+	return &s
+}
+
+func checkLists(t *testing.T, store appdb.Store) {
+	ctx := context.Background()
+	userId, _ := register(t, store)
+	otherId, _ := register(t, store)
+
+	home, err := store.AddList(ctx, &models.AddListRequest{Name: stringPtr("home")}, userId)
+	require.NoError(t, err)
+	work, err := store.AddList(ctx, &models.AddListRequest{Name: stringPtr("work")}, userId)
+	require.NoError(t, err)
+	_, err = store.UpdateList(ctx, &models.List{Id: work.Id, AddListRequest: models.AddListRequest{Name: stringPtr("job")}}, userId)
+	require.NoError(t, err)
+	_, err = store.UpdateList(ctx, &models.List{Id: work.Id, AddListRequest: models.AddListRequest{Name: stringPtr("x")}}, otherId)
+	require.Error(t, err)
+
+	lists, err := store.ListLists(ctx, userId)
+	require.NoError(t, err)
+	require.Len(t, lists, 2)
+	require.Equal(t, "home", *lists[0].Name)
+	require.Equal(t, "job", *lists[1].Name)
+
+	_, err = store.Add(ctx, &models.AddTodoRequest{Text: stringPtr("foreign list"), Completed: new(bool), ListId: home.Id}, otherId)
+	require.Error(t, err)
+
+	dishes := addTodo(t, store, userId, "wash dishes", inList(*home.Id))
+	report := addTodo(t, store, userId, "write report")
+	moved, err := store.MoveTodo(ctx, &models.MoveTodoRequest{Id: report.Id, ListId: work.Id}, userId)
+	require.NoError(t, err)
+	require.Equal(t, *work.Id, *moved.ListId)
+	_, err = store.MoveTodo(ctx, &models.MoveTodoRequest{Id: report.Id, ListId: work.Id}, otherId)
+	require.Error(t, err)
+
+	require.NoError(t, store.DeleteList(ctx, &models.DeleteListRequest{Id: *home.Id}, userId))
+	require.Equal(t, []string{"wash dishes"}, texts(listTodos(t, store, userId, &models.TodoFilter{Inbox: true}).List))
+	require.Error(t, store.DeleteList(ctx, &models.DeleteListRequest{Id: *work.Id}, otherId))
+	outline := addTodo(t, store, userId, "outline", under(*report.Id))
+	require.NoError(t, store.DeleteList(ctx, &models.DeleteListRequest{Id: *work.Id, Cascade: true}, userId))
+	require.Equal(t, []int{*dishes.Id}, idsOf(listTodos(t, store, userId, nil).List))
+
+	lists, err = store.ListLists(ctx, userId)
+	require.NoError(t, err)
+	require.Empty(t, lists)
+
+	// the todos of a list deleted with them are in the trash and come back to the inbox
+	trash, err := store.ListTrash(ctx, 0, 10, userId)
+	require.NoError(t, err)
+	require.ElementsMatch(t, []int{*report.Id, *outline.Id}, idsOf(trash.List))
+	restored, err := store.RestoreTodo(ctx, *report.Id, userId)
+	require.NoError(t, err)
+	require.Nil(t, restored.ListId)
+	require.ElementsMatch(t, []int{*dishes.Id, *report.Id, *outline.Id}, idsOf(listTodos(t, store, userId, &models.TodoFilter{Inbox: true}).List))
+	trash, err = store.ListTrash(ctx, 0, 10, userId)
+	require.NoError(t, err)
+	require.Empty(t, trash.List)
+}
+
+func checkSearch(t *testing.T, store appdb.Store) {
+	ctx := context.Background()
+	userId, _ := register(t, store)
+	otherId, _ := register(t, store)
+
+	addTodo(t, store, userId, "Prepare the quarterly report")
+	addTodo(t, store, userId, "Report the bug")
+	trashed := addTodo(t, store, userId, "Reporting duty")
+	addTodo(t, store, userId, "Walk the dog")
+	addTodo(t, store, otherId, "Another report")
+	require.NoError(t, store.Delete(ctx, *trashed.Id, userId))
+
+	res, err := store.Search(ctx, tools.SearchTerms("rep"), 10, userId)
+	require.NoError(t, err)
+	require.ElementsMatch(t, []string{"Prepare the quarterly report", "Report the bug"}, searchTexts(res))
+	for _, hit := range res.List {
+		require.Contains(t, strings.ToLower(hit.Snippet), "<mark>report</mark>")
+		require.Greater(t, hit.Rank, 0.0)
+	}
+
+	res, err = store.Search(ctx, tools.SearchTerms("report quart"), 10, userId)
+	require.NoError(t, err)
+	require.Equal(t, []string{"Prepare the quarterly report"}, searchTexts(res))
+
+	res, err = store.Search(ctx, tools.SearchTerms("report"), 1, userId)
+	require.NoError(t, err)
+	require.Len(t, res.List, 1)
+
+	res, err = store.Search(ctx, tools.SearchTerms("cat"), 10, userId)
+	require.NoError(t, err)
+	require.Empty(t, res.List)
+
+	// the markup of the text is escaped, only the matches are marked up
+	addTodo(t, store, userId, `Fix <script>alert("xss")</script> & report`)
+	res, err = store.Search(ctx, tools.SearchTerms("alert"), 10, userId)
+	require.NoError(t, err)
+	require.Len(t, res.List, 1)
+	require.Equal(t, `Fix <script>alert("xss")</script> & report`, *res.List[0].Text)
+	require.Contains(t, res.List[0].Snippet, "<mark>alert</mark>")
+	unmarked := strings.NewReplacer("<mark>", "", "</mark>", "").Replace(res.List[0].Snippet)
+	require.NotContains(t, unmarked, "<", res.List[0].Snippet)
+	require.NotContains(t, unmarked, ">", res.List[0].Snippet)
+}
+
+func searchTexts(res *models.SearchResult) []string {
+	out := []string{}
+	for _, hit := range res.List {
+		out = append(out, *hit.Text)
+	}
+	return out
+}
+
+func checkBatch(t *testing.T, store appdb.Store) {
+	ctx := context.Background()
+	userId, _ := register(t, store)
+
+	kept := addTodo(t, store, userId, "kept todo")
+	missing := 1 << 30
+	no := false
+	batch := &models.Batch{
+		Operations: []models.BatchOperation{
+			{Op: models.BatchAdd, Todo: &models.Todo{AddTodoRequest: models.AddTodoRequest{Text: stringPtr("added todo"), Completed: &no, Tags: []string{"new"}}}},
+			{Op: models.BatchDelete, Id: kept.Id},
+			{Op: models.BatchDelete, Id: &missing},
+		},
+		Indexes: []int{0, 1, 2},
+	}
+
+	// a failed operation rolls back the whole batch
+	res, err := store.Batch(ctx, batch, userId)
+	require.NoError(t, err)
+	require.False(t, res.Committed)
+	require.Len(t, res.Results, 3)
+	require.False(t, res.Results[2].Ok)
+	require.Equal(t, []string{"kept todo"}, texts(listTodos(t, store, userId, nil).List))
+	tags, err := store.ListTags(ctx, userId)
+	require.NoError(t, err)
+	require.Empty(t, tags)
+
+	// a best effort batch keeps what went through
+	batch.BestEffort = true
+	res, err = store.Batch(ctx, batch, userId)
+	require.NoError(t, err)
+	require.True(t, res.Committed)
+	require.True(t, res.Results[0].Ok)
+	require.Equal(t, "added todo", *res.Results[0].Todo.Text)
+	require.True(t, res.Results[1].Ok)
+	require.False(t, res.Results[2].Ok)
+	require.NotEmpty(t, res.Results[2].Error)
+	require.Equal(t, []string{"added todo"}, texts(listTodos(t, store, userId, nil).List))
+
+	addTodo(t, store, userId, "second added todo")
+	res, err = store.Batch(ctx, &models.Batch{Action: models.BatchActionComplete, Filter: &models.TodoFilter{Query: "added"}}, userId)
+	require.NoError(t, err)
+	require.Equal(t, 2, res.Affected)
+	require.Equal(t, 2, listTodos(t, store, userId, nil).CompletedCount)
+
+	res, err = store.Batch(ctx, &models.Batch{Action: models.BatchActionDelete, Filter: &models.TodoFilter{Tags: []string{"new"}}}, userId)
+	require.NoError(t, err)
+	require.Equal(t, 1, res.Affected)
+	require.Equal(t, []string{"second added todo"}, texts(listTodos(t, store, userId, nil).List))
+
+	_, err = store.Batch(ctx, &models.Batch{Action: "explode"}, userId)
+	require.Error(t, err)
+}
+
+func checkRefreshTokens(t *testing.T, store appdb.Store) {
+	ctx := context.Background()
+	userId, _ := register(t, store)
+	expiresAt := time.Now().Add(time.Hour)
+	prefix := fmt.Sprintf("refresh-%d-", userId)
+
+	require.NoError(t, store.CreateRefreshToken(ctx, userId, prefix+"a", expiresAt))
+	rotatedUser, err := store.RotateRefreshToken(ctx, prefix+"a", prefix+"b", expiresAt)
+	require.NoError(t, err)
+	require.Equal(t, userId, rotatedUser)
+
+	_, err = store.RotateRefreshToken(ctx, prefix+"unknown", prefix+"c", expiresAt)
+	require.ErrorIs(t, err, appdb.ErrInvalidRefreshToken)
+
+	// presenting a spent token again revokes its whole family
+	_, err = store.RotateRefreshToken(ctx, prefix+"a", prefix+"c", expiresAt)
+	require.ErrorIs(t, err, appdb.ErrRefreshTokenReused)
+	_, err = store.RotateRefreshToken(ctx, prefix+"b", prefix+"c", expiresAt)
+	require.ErrorIs(t, err, appdb.ErrRefreshTokenReused)
+
+	require.NoError(t, store.CreateRefreshToken(ctx, userId, prefix+"d", expiresAt))
+	require.NoError(t, store.RevokeRefreshToken(ctx, prefix+"d"))
+	_, err = store.RotateRefreshToken(ctx, prefix+"d", prefix+"e", expiresAt)
+	require.ErrorIs(t, err, appdb.ErrRefreshTokenReused)
+
+	require.NoError(t, store.CreateRefreshToken(ctx, userId, prefix+"expired", time.Now().Add(-time.Minute)))
+	_, err = store.RotateRefreshToken(ctx, prefix+"expired", prefix+"f", expiresAt)
+	require.ErrorIs(t, err, appdb.ErrInvalidRefreshToken)
+	pruned, err := store.PruneRefreshTokens(ctx, time.Now())
+	require.NoError(t, err)
+	require.GreaterOrEqual(t, pruned, 1)
+	_, err = store.RotateRefreshToken(ctx, prefix+"expired", prefix+"f", expiresAt)
+	require.ErrorIs(t, err, appdb.ErrInvalidRefreshToken)
+}
+
+func checkPasswords(t *testing.T, store appdb.Store) {
+	ctx := context.Background()
+	userId, login := register(t, store)
+	expiresAt := time.Now().Add(time.Hour)
+	prefix := fmt.Sprintf("password-%d-", userId)
+
+	scope := models.ScopeTodosRead
+	usePAT := func(name string) error {
+		_, _, err := store.UseAccessToken(ctx, prefix+name)
+		return err
+	}
+	createPAT := func(name string) {
+		_, err := store.CreateAccessToken(ctx, &models.CreateAccessTokenRequest{Name: stringPtr(name), Scope: &scope}, prefix+name, userId)
+		require.NoError(t, err)
+		require.NoError(t, usePAT(name))
+	}
+	issuedAt := time.Now().Add(-time.Minute)
+	isRevoked := func(issuedAt time.Time) bool {
+		revoked, err := store.IsTokenRevoked(ctx, prefix+"jti", userId, issuedAt)
+		require.NoError(t, err)
+		return revoked
+	}
+	require.False(t, isRevoked(issuedAt))
+
+	require.NoError(t, store.CreateRefreshToken(ctx, userId, prefix+"session", expiresAt))
+	createPAT("before-change")
+	require.ErrorIs(t, store.ChangePassword(ctx, userId, "wrong-password", "N3w-passw0rd", expiresAt), appdb.ErrWrongPassword)
+	require.NoError(t, usePAT("before-change"))
+	require.NoError(t, store.ChangePassword(ctx, userId, password, "N3w-passw0rd", expiresAt))
+	require.NoError(t, store.VerifyPassword(ctx, userId, "N3w-passw0rd"))
+
+	// changing the password ends the sessions, the personal access tokens and the access tokens
+	// issued so far while the ones issued afterwards work
+	_, err := store.RotateRefreshToken(ctx, prefix+"session", prefix+"next", expiresAt)
+	require.ErrorIs(t, err, appdb.ErrRefreshTokenReused)
+	require.ErrorIs(t, usePAT("before-change"), appdb.ErrInvalidAccessToken)
+	require.True(t, isRevoked(issuedAt))
+	require.False(t, isRevoked(time.Now().Add(time.Second).Truncate(time.Second)))
+	createPAT("before-reset")
+
+	created, err := store.CreatePasswordReset(ctx, login+"x", prefix+"nobody", expiresAt)
+	require.NoError(t, err)
+	require.False(t, created)
+	created, err = store.CreatePasswordReset(ctx, login, prefix+"reset1", expiresAt)
+	require.NoError(t, err)
+	require.True(t, created)
+	_, err = store.CreatePasswordReset(ctx, login, prefix+"reset2", expiresAt)
+	require.NoError(t, err)
+	_, err = store.CreatePasswordReset(ctx, login, prefix+"expired", time.Now().Add(-time.Minute))
+	require.NoError(t, err)
+
+	require.ErrorIs(t, store.ResetPassword(ctx, prefix+"expired", "R3set-passw0rd", expiresAt), appdb.ErrInvalidResetToken)
+	require.NoError(t, usePAT("before-reset"))
+	require.NoError(t, store.ResetPassword(ctx, prefix+"reset1", "R3set-passw0rd", expiresAt))
+	require.NoError(t, store.VerifyPassword(ctx, userId, "R3set-passw0rd"))
+	require.ErrorIs(t, usePAT("before-reset"), appdb.ErrInvalidAccessToken)
+	require.ErrorIs(t, store.ResetPassword(ctx, prefix+"reset1", "Oth3r-passw0rd", expiresAt), appdb.ErrInvalidResetToken)
+	require.ErrorIs(t, store.ResetPassword(ctx, prefix+"reset2", "Oth3r-passw0rd", expiresAt), appdb.ErrInvalidResetToken)
+
+	id, err := store.Login(ctx, &models.LoginRequest{Login: &login, Password: stringPtr("R3set-passw0rd")})
+	require.NoError(t, err)
+	require.Equal(t, userId, *id)
+}
+
+func checkLegacyPassword(t *testing.T, store appdb.Store) {
+	ctx := context.Background()
+	userId, login := register(t, store)
+	legacy := md5.Sum([]byte("salt_" + password + "_salt"))
+	legacyHash := hex.EncodeToString(legacy[:])
+	require.NoError(t, appdb.SetPasswordHash(store, userId, legacyHash))
+
+	_, err := store.Login(ctx, &models.LoginRequest{Login: &login, Password: stringPtr("wrong" + password)})
+	require.Error(t, err)
+	hash, err := appdb.PasswordHash(store, userId)
+	require.NoError(t, err)
+	require.Equal(t, legacyHash, hash)
+
+	// the legacy hash is replaced on the first successful login
+	id, err := store.Login(ctx, &models.LoginRequest{Login: &login, Password: stringPtr(password)})
+	require.NoError(t, err)
+	require.Equal(t, userId, *id)
+	hash, err = appdb.PasswordHash(store, userId)
+	require.NoError(t, err)
+	require.True(t, strings.HasPrefix(hash, "$argon2id$"), hash)
+	ok, rehash, err := tools.VerifyPassword(password, hash)
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.False(t, rehash)
+
+	id, err = store.Login(ctx, &models.LoginRequest{Login: &login, Password: stringPtr(password)})
+	require.NoError(t, err)
+	require.Equal(t, userId, *id)
+	_, err = store.Login(ctx, &models.LoginRequest{Login: &login, Password: stringPtr("wrong" + password)})
+	require.Error(t, err)
+}
+
+func checkTwoFactor(t *testing.T, store appdb.Store) {
+	ctx := context.Background()
+	userId, login := register(t, store)
+
+	enabled, err := store.TwoFactorEnabled(ctx, userId)
+	require.NoError(t, err)
+	require.False(t, enabled)
+	require.ErrorIs(t, store.ConfirmTOTPEnrollment(ctx, userId, "123456", nil), appdb.ErrNoTwoFactorPending)
+	require.ErrorIs(t, store.VerifySecondFactor(ctx, userId, "123456"), appdb.ErrTwoFactorNotEnabled)
+
+	secret, err := tools.NewTOTPSecret()
+	require.NoError(t, err)
+	account, err := store.StartTOTPEnrollment(ctx, userId, secret)
+	require.NoError(t, err)
+	require.Equal(t, login, account)
+
+	// the confirmation code was already used, the next one is a period later
+	now := time.Now()
+	code, err := tools.TOTPCode(secret, now)
+	require.NoError(t, err)
+	recovery := "abcd-efgh"
+	hashes := []string{tools.HashToken(tools.NormalizeRecoveryCode(recovery))}
+	require.ErrorIs(t, store.ConfirmTOTPEnrollment(ctx, userId, "000000x", hashes), appdb.ErrWrongCode)
+	require.NoError(t, store.ConfirmTOTPEnrollment(ctx, userId, code, hashes))
+	_, err = store.StartTOTPEnrollment(ctx, userId, secret)
+	require.ErrorIs(t, err, appdb.ErrTwoFactorEnabled)
+	enabled, err = store.TwoFactorEnabled(ctx, userId)
+	require.NoError(t, err)
+	require.True(t, enabled)
+
+	require.ErrorIs(t, store.VerifySecondFactor(ctx, userId, code), appdb.ErrWrongCode)
+	next, err := tools.TOTPCode(secret, now.Add(30*time.Second))
+	require.NoError(t, err)
+	require.NoError(t, store.VerifySecondFactor(ctx, userId, next))
+	require.ErrorIs(t, store.VerifySecondFactor(ctx, userId, next), appdb.ErrWrongCode)
+
+	require.NoError(t, store.VerifySecondFactor(ctx, userId, strings.ToUpper(recovery)))
+	require.ErrorIs(t, store.VerifySecondFactor(ctx, userId, recovery), appdb.ErrWrongCode)
+
+	replaced := "ijkl-mnop"
+	require.NoError(t, store.ReplaceRecoveryCodes(ctx, userId, []string{tools.HashToken(tools.NormalizeRecoveryCode(replaced))}))
+	require.NoError(t, store.VerifySecondFactor(ctx, userId, replaced))
+
+	require.NoError(t, store.DisableTwoFactor(ctx, userId))
+	enabled, err = store.TwoFactorEnabled(ctx, userId)
+	require.NoError(t, err)
+	require.False(t, enabled)
+	require.ErrorIs(t, store.VerifySecondFactor(ctx, userId, replaced), appdb.ErrTwoFactorNotEnabled)
+}
+
+func checkAccessTokens(t *testing.T, store appdb.Store) {
+	ctx := context.Background()
+	userId, _ := register(t, store)
+	otherId, _ := register(t, store)
+	prefix := fmt.Sprintf("access-%d-", userId)
+
+	scope := "todos:read"
+	readToken, err := store.CreateAccessToken(ctx, &models.CreateAccessTokenRequest{Name: stringPtr("ci"), Scope: &scope}, prefix+"read", userId)
+	require.NoError(t, err)
+	require.Equal(t, "ci", readToken.Name)
+	require.Nil(t, readToken.ExpiresAt)
+	require.Nil(t, readToken.LastUsedAt)
+
+	past := time.Now().Add(-time.Minute)
+	_, err = store.CreateAccessToken(ctx, &models.CreateAccessTokenRequest{Name: stringPtr("old"), Scope: &scope, ExpiresAt: &past}, prefix+"expired", userId)
+	require.NoError(t, err)
+
+	tokenUser, tokenScope, err := store.UseAccessToken(ctx, prefix+"read")
+	require.NoError(t, err)
+	require.Equal(t, userId, tokenUser)
+	require.Equal(t, scope, tokenScope)
+	_, _, err = store.UseAccessToken(ctx, prefix+"expired")
+	require.ErrorIs(t, err, appdb.ErrInvalidAccessToken)
+
+	tokens, err := store.ListAccessTokens(ctx, userId)
+	require.NoError(t, err)
+	require.Len(t, tokens, 2)
+	require.Equal(t, readToken.Id, tokens[0].Id)
+	require.NotNil(t, tokens[0].LastUsedAt)
+	require.NotNil(t, tokens[1].ExpiresAt)
+
+	require.Error(t, store.RevokeAccessToken(ctx, readToken.Id, otherId))
+	require.NoError(t, store.RevokeAccessToken(ctx, readToken.Id, userId))
+	require.Error(t, store.RevokeAccessToken(ctx, readToken.Id, userId))
+	_, _, err = store.UseAccessToken(ctx, prefix+"read")
+	require.ErrorIs(t, err, appdb.ErrInvalidAccessToken)
+}
+
+func checkRevocation(t *testing.T, store appdb.Store) {
+	ctx := context.Background()
+	userId, _ := register(t, store)
+	jti := fmt.Sprintf("jti-%d", userId)
+
+	issuedAt := time.Now().Add(-time.Minute)
+
+	revoked, err := store.IsTokenRevoked(ctx, jti, userId, issuedAt)
+	require.NoError(t, err)
+	require.False(t, revoked)
+
+	require.NoError(t, store.RevokeToken(ctx, jti, time.Now().Add(-time.Minute)))
+	require.NoError(t, store.RevokeToken(ctx, jti, time.Now().Add(-time.Minute)))
+	revoked, err = store.IsTokenRevoked(ctx, jti, userId, issuedAt)
+	require.NoError(t, err)
+	require.True(t, revoked)
+
+	require.NoError(t, store.RevokeUserTokens(ctx, userId, issuedAt.Add(time.Second), time.Now().Add(time.Hour)))
+	require.NoError(t, store.RevokeUserTokens(ctx, userId, issuedAt.Add(-time.Hour), time.Now().Add(-time.Hour)))
+	pruned, err := store.PruneRevokedTokens(ctx, time.Now())
+	require.NoError(t, err)
+	require.GreaterOrEqual(t, pruned, 1)
+
+	// the user stays revoked until the latest expiry, for the tokens issued before the latest cutoff
+	revoked, err = store.IsTokenRevoked(ctx, "another-"+jti, userId, issuedAt)
+	require.NoError(t, err)
+	require.True(t, revoked)
+	revoked, err = store.IsTokenRevoked(ctx, "another-"+jti, userId, issuedAt.Add(time.Second))
+	require.NoError(t, err)
+	require.False(t, revoked)
+	revoked, err = store.IsTokenRevoked(ctx, jti, userId+1000000, issuedAt)
+	require.NoError(t, err)
+	require.False(t, revoked)
+}
+
+func checkAttempts(t *testing.T, store appdb.Store) {
+	ctx := context.Background()
+	key := fmt.Sprintf("login:attempts%d", time.Now().UnixNano())
+	policy := tools.AttemptPolicy{FreeAttempts: 2, BaseDelay: time.Minute, MaxDelay: time.Hour, Window: time.Hour}
+
+	for i := 0; i < 2; i++ {
+		blockedUntil, err := store.RecordFailedAttempt(ctx, key, policy)
+		require.NoError(t, err)
+		require.True(t, blockedUntil.IsZero())
+	}
+	blockedUntil, err := store.RecordFailedAttempt(ctx, key, policy)
+	require.NoError(t, err)
+	require.WithinDuration(t, time.Now().Add(time.Minute), blockedUntil, 5*time.Second)
+
+	until, err := store.AttemptBlockedUntil(ctx, key)
+	require.NoError(t, err)
+	require.WithinDuration(t, blockedUntil, until, time.Millisecond)
+
+	// a blocked key is not pruned
+	_, err = store.PruneAttempts(ctx, time.Now().Add(time.Minute))
+	require.NoError(t, err)
+	until, err = store.AttemptBlockedUntil(ctx, key)
+	require.NoError(t, err)
+	require.False(t, until.IsZero())
+
+	require.NoError(t, store.ResetAttempts(ctx, key))
+	until, err = store.AttemptBlockedUntil(ctx, key)
+	require.NoError(t, err)
+	require.True(t, until.IsZero())
+
+	blockedUntil, err = store.RecordFailedAttempt(ctx, key, policy)
+	require.NoError(t, err)
+	require.True(t, blockedUntil.IsZero())
+	pruned, err := store.PruneAttempts(ctx, time.Now().Add(time.Minute))
+	require.NoError(t, err)
+	require.GreaterOrEqual(t, pruned, 1)
+}
+
+func checkDeleteUser(t *testing.T, store appdb.Store) {
+	ctx := context.Background()
+	userId, login := register(t, store)
+	prefix := fmt.Sprintf("delete-%d-", userId)
+
+	addTodo(t, store, userId, "doomed todo", withTags("doomed"))
+	_, err := store.AddList(ctx, &models.AddListRequest{Name: stringPtr("doomed")}, userId)
+	require.NoError(t, err)
+	require.NoError(t, store.CreateRefreshToken(ctx, userId, prefix+"refresh", time.Now().Add(time.Hour)))
+	scope := "todos:write"
+	_, err = store.CreateAccessToken(ctx, &models.CreateAccessTokenRequest{Name: stringPtr("ci"), Scope: &scope}, prefix+"access", userId)
+	require.NoError(t, err)
+
+	require.ErrorIs(t, store.DeleteUser(ctx, userId, "wrong-password", time.Now().Add(time.Hour)), appdb.ErrWrongPassword)
+	require.NoError(t, store.DeleteUser(ctx, userId, password, time.Now().Add(time.Hour)))
+
+	_, err = store.Login(ctx, &models.LoginRequest{Login: &login, Password: stringPtr(password)})
+	require.Error(t, err)
+	require.Empty(t, listTodos(t, store, userId, nil).List)
+	lists, err := store.ListLists(ctx, userId)
+	require.NoError(t, err)
+	require.Empty(t, lists)
+	_, err = store.RotateRefreshToken(ctx, prefix+"refresh", prefix+"next", time.Now().Add(time.Hour))
+	require.ErrorIs(t, err, appdb.ErrInvalidRefreshToken)
+	_, _, err = store.UseAccessToken(ctx, prefix+"access")
+	require.ErrorIs(t, err, appdb.ErrInvalidAccessToken)
+	revoked, err := store.IsTokenRevoked(ctx, "any", userId, time.Now())
+	require.NoError(t, err)
+	require.True(t, revoked)
+
+	// the login is free again
+	reused := login
+	_, err = store.Register(ctx, &models.RegisterRequest{LoginRequest: models.LoginRequest{Login: &reused, Password: stringPtr(password)}})
+	require.NoError(t, err)
+}
+
+func checkTransactions(t *testing.T, store appdb.Store) {
+	ctx := context.Background()
+	failure := errors.New("failure")
+	newLogin := func() string {
+		return fmt.Sprintf("tx%d%d", time.Now().UnixNano()%1e9, atomic.AddInt64(&lastLogin, 1))
+	}
+	registerIn := func(tx appdb.Tx, login string) int {
+		userId, err := tx.Register(ctx, &models.RegisterRequest{LoginRequest: models.LoginRequest{Login: &login, Password: stringPtr(password)}})
+		require.NoError(t, err)
+		return userId
+	}
+
+	// the writes of a failed unit of work are rolled back together
+	rolledBack := newLogin()
+	err := store.InTx(ctx, func(tx appdb.Tx) error {
+		userId := registerIn(tx, rolledBack)
+		_, err := tx.Add(ctx, &models.AddTodoRequest{Text: stringPtr("never kept"), Completed: new(bool)}, userId)
+		require.NoError(t, err)
+		require.Len(t, listTodos(t, tx, userId, nil).List, 1)
+		return failure
+	})
+	require.ErrorIs(t, err, failure)
+	_, err = store.Login(ctx, &models.LoginRequest{Login: &rolledBack, Password: stringPtr(password)})
+	require.Error(t, err)
+
+	committed := newLogin()
+	var userId int
+	err = store.InTx(ctx, func(tx appdb.Tx) error {
+		userId = registerIn(tx, committed)
+		zone := "Europe/Berlin"
+		if _, err := tx.UpdateProfile(ctx, &models.UpdateProfileRequest{TimeZone: &zone}, userId); err != nil {
+			return err
+		}
+		if err := tx.CreateRefreshToken(ctx, userId, fmt.Sprintf("tx-%d", userId), time.Now().Add(time.Hour)); err != nil {
+			return err
+		}
+
+		// a failed nested unit of work only undoes its own writes
+		err := tx.InTx(ctx, func(tx appdb.Tx) error {
+			if _, err := tx.Add(ctx, &models.AddTodoRequest{Text: stringPtr("nested todo"), Completed: new(bool)}, userId); err != nil {
+				return err
+			}
+			return failure
+		})
+		require.ErrorIs(t, err, failure)
+
+		// the multi-step writes nest too
+		res, err := tx.Batch(ctx, &models.Batch{Operations: []models.BatchOperation{
+			{Op: models.BatchAdd, Todo: &models.Todo{AddTodoRequest: models.AddTodoRequest{Text: stringPtr("batch todo"), Completed: new(bool)}}},
+			{Op: models.BatchDelete, Id: new(int)},
+		}, Indexes: []int{0, 1}}, userId)
+		require.NoError(t, err)
+		require.False(t, res.Committed)
+
+		_, err = tx.Add(ctx, &models.AddTodoRequest{Text: stringPtr("kept todo"), Completed: new(bool)}, userId)
+		return err
+	})
+	require.NoError(t, err)
+
+	loggedIn, err := store.Login(ctx, &models.LoginRequest{Login: &committed, Password: stringPtr(password)})
+	require.NoError(t, err)
+	require.Equal(t, userId, *loggedIn)
+	require.Equal(t, []string{"kept todo"}, texts(listTodos(t, store, userId, nil).List))
+	timeZone, err := store.UserTimeZone(ctx, userId)
+	require.NoError(t, err)
+	require.Equal(t, "Europe/Berlin", timeZone)
+	_, err = store.RotateRefreshToken(ctx, fmt.Sprintf("tx-%d", userId), fmt.Sprintf("tx-%d-next", userId), time.Now().Add(time.Hour))
+	require.NoError(t, err)
+
+	// a failed unit of work leaves the writes of a method running their own transaction undone
+	err = store.InTx(ctx, func(tx appdb.Tx) error {
+		if err := tx.DeleteUser(ctx, userId, password, time.Now().Add(time.Hour)); err != nil {
+			return err
+		}
+		return failure
+	})
+	require.ErrorIs(t, err, failure)
+	require.NoError(t, store.VerifyPassword(ctx, userId, password))
+	require.Len(t, listTodos(t, store, userId, nil).List, 1)
+
+	// and so are the changes to the records that were there before
+	kept := listTodos(t, store, userId, nil).List[0]
+	err = store.InTx(ctx, func(tx appdb.Tx) error {
+		zone := "Asia/Tokyo"
+		if _, err := tx.UpdateProfile(ctx, &models.UpdateProfileRequest{TimeZone: &zone}, userId); err != nil {
+			return err
+		}
+		if _, err := tx.Update(ctx, &models.Todo{Id: kept.Id, AddTodoRequest: models.AddTodoRequest{Text: stringPtr("changed todo"), Completed: new(bool)}}, userId); err != nil {
+			return err
+		}
+		if err := tx.ChangePassword(ctx, userId, password, "N3w-passw0rd", time.Now().Add(time.Hour)); err != nil {
+			return err
+		}
+		if _, err := tx.CreateAccessToken(ctx, &models.CreateAccessTokenRequest{Name: stringPtr("script"), Scope: stringPtr(models.ScopeTodosRead)}, fmt.Sprintf("tx-access-%d", userId), userId); err != nil {
+			return err
+		}
+		return failure
+	})
+	require.ErrorIs(t, err, failure)
+	timeZone, err = store.UserTimeZone(ctx, userId)
+	require.NoError(t, err)
+	require.Equal(t, "Europe/Berlin", timeZone)
+	require.Equal(t, []string{"kept todo"}, texts(listTodos(t, store, userId, nil).List))
+	require.NoError(t, store.VerifyPassword(ctx, userId, password))
+	tokens, err := store.ListAccessTokens(ctx, userId)
+	require.NoError(t, err)
+	require.Empty(t, tokens)
+	_, _, err = store.UseAccessToken(ctx, fmt.Sprintf("tx-access-%d", userId))
+	require.ErrorIs(t, err, appdb.ErrInvalidAccessToken)
+	_, err = store.RotateRefreshToken(ctx, fmt.Sprintf("tx-%d-next", userId), fmt.Sprintf("tx-%d-last", userId), time.Now().Add(time.Hour))
+	require.NoError(t, err)
+}
+
+func checkCancel(t *testing.T, store appdb.Store) {
+	userId, _ := register(t, store)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, err := store.List(ctx, 0, 10, nil, userId)
+	require.True(t, errors.Is(err, context.Canceled), "%v", err)
+	_, err = store.Add(ctx, &models.AddTodoRequest{Text: stringPtr("never added"), Completed: new(bool)}, userId)
+	require.Error(t, err)
+	require.Empty(t, listTodos(t, store, userId, nil).List)
+}
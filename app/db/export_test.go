@@ -0,0 +1,52 @@
+package db
+
+import (
+	"context"
+	"fmt"
+)
+
+// PasswordHash returns the stored password hash of the user, for the checks of the rehashing
+func PasswordHash(store Store, userId int) (string, error) {
+	var hash string
+	switch store := store.(type) {
+	case *memoryDB:
+		user, err := store.user(userId)
+		if err != nil {
+			return "", err
+		}
+		hash = user.passwordHash
+	case *postgresDB:
+		err := store.sql.QueryRowContext(context.Background(), "SELECT passwordhash FROM users WHERE id=$1;", userId).Scan(&hash)
+		if err != nil {
+			return "", err
+		}
+	case *sqliteDB:
+		err := store.sql.QueryRowContext(context.Background(), "SELECT passwordhash FROM users WHERE id=$1;", userId).Scan(&hash)
+		if err != nil {
+			return "", err
+		}
+	default:
+		return "", fmt.Errorf("unknown store %T", store)
+	}
+	return hash, nil
+}
+
+// SetPasswordHash replaces the stored password hash of the user, e.g. with a legacy one
+func SetPasswordHash(store Store, userId int, hash string) error {
+	switch store := store.(type) {
+	case *memoryDB:
+		user, err := store.user(userId)
+		if err != nil {
+			return err
+		}
+		user.passwordHash = hash
+		return nil
+	case *postgresDB:
+		_, err := store.sql.ExecContext(context.Background(), "UPDATE users SET passwordhash=$1 WHERE id=$2;", hash, userId)
+		return err
+	case *sqliteDB:
+		_, err := store.sql.ExecContext(context.Background(), "UPDATE users SET passwordhash=$1 WHERE id=$2;", hash, userId)
+		return err
+	}
+	return fmt.Errorf("unknown store %T", store)
+}
@@ -0,0 +1,76 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/ann-96/todo-go-backend/app/tools"
+)
+
+func (db *postgresDB) AttemptBlockedUntil(ctx context.Context, key string) (time.Time, error) {
+	row := db.sql.QueryRowContext(ctx, "SELECT blocked_until FROM login_attempts WHERE key=$1 AND blocked_until > now();", key)
+	var blockedUntil time.Time
+	if err := row.Scan(&blockedUntil); err != nil {
+		if err == sql.ErrNoRows {
+			return time.Time{}, nil
+		}
+		return time.Time{}, err
+	}
+	return blockedUntil, nil
+}
+
+func (db *postgresDB) RecordFailedAttempt(ctx context.Context, key string, policy tools.AttemptPolicy) (time.Time, error) {
+	tx, err := db.sql.BeginTx(ctx, nil)
+	if err != nil {
+		return time.Time{}, err
+	}
+	defer tx.Rollback()
+
+	// the failures older than the window start over, concurrent failures of the key wait for each other
+	row := tx.QueryRowContext(ctx, `
+		INSERT INTO login_attempts(key, failures, last_failure_at)
+		VALUES ($1, 1, now())
+		ON CONFLICT (key) DO UPDATE SET
+			failures = CASE WHEN login_attempts.last_failure_at < now() - $2::bigint * interval '1 microsecond'
+				THEN 1 ELSE login_attempts.failures + 1 END,
+			last_failure_at = now()
+		RETURNING failures, blocked_until, now();`, key, policy.Window.Microseconds())
+	var failures int
+	var blockedUntil sql.NullTime
+	var now time.Time
+	if err := row.Scan(&failures, &blockedUntil, &now); err != nil {
+		return time.Time{}, err
+	}
+
+	if delay := policy.BlockFor(failures); delay > 0 && (!blockedUntil.Valid || blockedUntil.Time.Before(now.Add(delay))) {
+		blockedUntil = sql.NullTime{Time: now.Add(delay), Valid: true}
+		if _, err := tx.ExecContext(ctx, "UPDATE login_attempts SET blocked_until=$1 WHERE key=$2;", blockedUntil.Time, key); err != nil {
+			return time.Time{}, err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return time.Time{}, err
+	}
+
+	if blockedUntil.Valid && blockedUntil.Time.After(now) {
+		return blockedUntil.Time, nil
+	}
+	return time.Time{}, nil
+}
+
+func (db *postgresDB) ResetAttempts(ctx context.Context, key string) error {
+	_, err := db.sql.ExecContext(ctx, "DELETE FROM login_attempts WHERE key=$1;", key)
+	return err
+}
+
+func (db *postgresDB) PruneAttempts(ctx context.Context, before time.Time) (int, error) {
+	res, err := db.sql.ExecContext(ctx, `
+		DELETE FROM login_attempts
+		WHERE last_failure_at < $1 AND (blocked_until IS NULL OR blocked_until < now());`, before)
+	if err != nil {
+		return 0, err
+	}
+	pruned, err := res.RowsAffected()
+	return int(pruned), err
+}
@@ -0,0 +1,77 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/ann-96/todo-go-backend/app/tools"
+)
+
+func (db *sqliteDB) AttemptBlockedUntil(ctx context.Context, key string) (time.Time, error) {
+	row := db.sql.QueryRowContext(ctx, "SELECT blocked_until FROM login_attempts WHERE key=$1 AND blocked_until > $2;", key, sqliteNow())
+	var blockedUntil sqliteTime
+	if err := row.Scan(&blockedUntil); err != nil {
+		if err == sql.ErrNoRows {
+			return time.Time{}, nil
+		}
+		return time.Time{}, err
+	}
+	return blockedUntil.Time, nil
+}
+
+func (db *sqliteDB) RecordFailedAttempt(ctx context.Context, key string, policy tools.AttemptPolicy) (time.Time, error) {
+	tx, err := db.sql.BeginTx(ctx, nil)
+	if err != nil {
+		return time.Time{}, err
+	}
+	defer tx.Rollback()
+
+	// the failures older than the window start over
+	now := sqliteNow()
+	row := tx.QueryRowContext(ctx, `
+		INSERT INTO login_attempts(key, failures, last_failure_at)
+		VALUES ($1, 1, $2)
+		ON CONFLICT (key) DO UPDATE SET
+			failures = CASE WHEN login_attempts.last_failure_at < $2 - $3
+				THEN 1 ELSE login_attempts.failures + 1 END,
+			last_failure_at = $2
+		RETURNING failures, blocked_until;`, key, now, policy.Window.Microseconds())
+	var failures int
+	var blockedUntil sqliteTime
+	if err := row.Scan(&failures, &blockedUntil); err != nil {
+		return time.Time{}, err
+	}
+
+	at := time.UnixMicro(now)
+	if delay := policy.BlockFor(failures); delay > 0 && (!blockedUntil.Valid || blockedUntil.Time.Before(at.Add(delay))) {
+		blockedUntil = sqliteTime{Time: at.Add(delay), Valid: true}
+		if _, err := tx.ExecContext(ctx, "UPDATE login_attempts SET blocked_until=$1 WHERE key=$2;", blockedUntil.Time.UnixMicro(), key); err != nil {
+			return time.Time{}, err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return time.Time{}, err
+	}
+
+	if blockedUntil.Valid && blockedUntil.Time.After(at) {
+		return blockedUntil.Time, nil
+	}
+	return time.Time{}, nil
+}
+
+func (db *sqliteDB) ResetAttempts(ctx context.Context, key string) error {
+	_, err := db.sql.ExecContext(ctx, "DELETE FROM login_attempts WHERE key=$1;", key)
+	return err
+}
+
+func (db *sqliteDB) PruneAttempts(ctx context.Context, before time.Time) (int, error) {
+	res, err := db.sql.ExecContext(ctx, `
+		DELETE FROM login_attempts
+		WHERE last_failure_at < $1 AND (blocked_until IS NULL OR blocked_until < $2);`, before.UnixMicro(), sqliteNow())
+	if err != nil {
+		return 0, err
+	}
+	pruned, err := res.RowsAffected()
+	return int(pruned), err
+}
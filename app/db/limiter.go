@@ -0,0 +1,92 @@
+package db
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/ann-96/todo-go-backend/app/tools"
+)
+
+// AttemptLimiter counts the failed attempts of keys like an IP or a login and blocks
+// the keys according to an AttemptPolicy
+type AttemptLimiter interface {
+	// AttemptBlockedUntil returns the end of the block of the key, the zero time when it isn't blocked
+	AttemptBlockedUntil(ctx context.Context, key string) (time.Time, error)
+	// RecordFailedAttempt counts a failure of the key and returns the end of its block
+	RecordFailedAttempt(ctx context.Context, key string, policy tools.AttemptPolicy) (time.Time, error)
+	// ResetAttempts forgets the failures of the key and lifts its block
+	ResetAttempts(ctx context.Context, key string) error
+	// PruneAttempts forgets the keys that failed last before the given time and aren't blocked
+	PruneAttempts(ctx context.Context, before time.Time) (int, error)
+}
+
+type memoryAttempts struct {
+	failures     int
+	lastFailure  time.Time
+	blockedUntil time.Time
+}
+
+type memoryAttemptLimiter struct {
+	mu       sync.Mutex
+	attempts map[string]*memoryAttempts
+}
+
+// NewMemoryAttemptLimiter returns an AttemptLimiter local to the process
+func NewMemoryAttemptLimiter() AttemptLimiter {
+	return &memoryAttemptLimiter{attempts: make(map[string]*memoryAttempts)}
+}
+
+func (l *memoryAttemptLimiter) AttemptBlockedUntil(ctx context.Context, key string) (time.Time, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if attempts, ok := l.attempts[key]; ok && attempts.blockedUntil.After(time.Now()) {
+		return attempts.blockedUntil, nil
+	}
+	return time.Time{}, nil
+}
+
+func (l *memoryAttemptLimiter) RecordFailedAttempt(ctx context.Context, key string, policy tools.AttemptPolicy) (time.Time, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	attempts, ok := l.attempts[key]
+	if !ok || attempts.lastFailure.Before(now.Add(-policy.Window)) {
+		attempts = &memoryAttempts{}
+		l.attempts[key] = attempts
+	}
+	attempts.failures++
+	attempts.lastFailure = now
+	if delay := policy.BlockFor(attempts.failures); delay > 0 {
+		attempts.blockedUntil = now.Add(delay)
+	}
+	if attempts.blockedUntil.After(now) {
+		return attempts.blockedUntil, nil
+	}
+	return time.Time{}, nil
+}
+
+func (l *memoryAttemptLimiter) ResetAttempts(ctx context.Context, key string) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	delete(l.attempts, key)
+	return nil
+}
+
+func (l *memoryAttemptLimiter) PruneAttempts(ctx context.Context, before time.Time) (int, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	pruned := 0
+	now := time.Now()
+	for key, attempts := range l.attempts {
+		if attempts.lastFailure.Before(before) && !attempts.blockedUntil.After(now) {
+			delete(l.attempts, key)
+			pruned++
+		}
+	}
+	return pruned, nil
+}
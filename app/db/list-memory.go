@@ -0,0 +1,135 @@
+package db
+
+import (
+	"context"
+	"sort"
+
+	"github.com/ann-96/todo-go-backend/app/models"
+)
+
+func (db *memoryDB) AddList(ctx context.Context, input *models.AddListRequest, userId int) (*models.List, error) {
+	if err := db.lock(ctx); err != nil {
+		return nil, err
+	}
+	defer db.unlock()
+
+	user, err := db.user(userId)
+	if err != nil {
+		return nil, err
+	}
+	db.changeData(user)
+
+	db.lastListId++
+	id := db.lastListId
+	user.data.lists[id] = *input.Name
+
+	return &models.List{
+		Id:             &id,
+		AddListRequest: *input,
+	}, nil
+}
+
+func (db *memoryDB) UpdateList(ctx context.Context, input *models.List, userId int) (*models.List, error) {
+	if err := db.lock(ctx); err != nil {
+		return nil, err
+	}
+	defer db.unlock()
+
+	user, ok := db.users[userId]
+	if !ok {
+		return nil, errListNotFound
+	}
+	if _, ok := user.data.lists[*input.Id]; !ok {
+		return nil, errListNotFound
+	}
+	db.changeData(user)
+	user.data.lists[*input.Id] = *input.Name
+
+	return input, nil
+}
+
+func (db *memoryDB) ListLists(ctx context.Context, userId int) ([]models.List, error) {
+	if err := db.rlock(ctx); err != nil {
+		return nil, err
+	}
+	defer db.runlock()
+
+	list := []models.List{}
+	if user, ok := db.users[userId]; ok {
+		for id, name := range user.data.lists {
+			id, name := id, name
+			list = append(list, models.List{
+				Id:             &id,
+				AddListRequest: models.AddListRequest{Name: &name},
+			})
+		}
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return *list[i].Id < *list[j].Id
+	})
+
+	return list, nil
+}
+
+func (db *memoryDB) DeleteList(ctx context.Context, input *models.DeleteListRequest, userId int) error {
+	if err := db.lock(ctx); err != nil {
+		return err
+	}
+	defer db.unlock()
+
+	user, ok := db.users[userId]
+	if !ok {
+		return errListNotFound
+	}
+	db.changeData(user)
+	data := user.data
+	if _, ok := data.lists[input.Id]; !ok {
+		return errListNotFound
+	}
+
+	// the todos of the list go to the trash like deleted todos, restored they land in the inbox
+	ids := []int{}
+	now := memoryNow()
+	for id, todo := range data.todos {
+		if todo.listId == nil || *todo.listId != input.Id {
+			continue
+		}
+		if input.Cascade && todo.deletedAt == nil {
+			ids = append(ids, id)
+		}
+		todo.listId = nil
+		todo.updatedAt = now
+	}
+	data.trash(ids, now)
+	delete(data.lists, input.Id)
+
+	return nil
+}
+
+func (db *memoryDB) MoveTodo(ctx context.Context, input *models.MoveTodoRequest, userId int) (*models.Todo, error) {
+	if err := db.lock(ctx); err != nil {
+		return nil, err
+	}
+	defer db.unlock()
+
+	user, ok := db.users[userId]
+	if !ok {
+		return nil, errTodoNotFound
+	}
+	db.changeData(user)
+	data := user.data
+	if input.ListId != nil {
+		if _, ok := data.lists[*input.ListId]; !ok {
+			return nil, errListNotFound
+		}
+	}
+	todo, err := data.liveTodo(*input.Id)
+	if err != nil {
+		return nil, err
+	}
+	todo.listId = copyInt(input.ListId)
+	todo.updatedAt = memoryNow()
+
+	res := data.todoModel(todo)
+	return &res, nil
+}
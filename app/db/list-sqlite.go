@@ -0,0 +1,117 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/ann-96/todo-go-backend/app/models"
+)
+
+func (db *sqliteDB) AddList(ctx context.Context, input *models.AddListRequest, userId int) (*models.List, error) {
+	res := &models.List{
+		AddListRequest: *input,
+	}
+
+	row := db.sql.QueryRowContext(ctx, "INSERT INTO lists(userid, name) VALUES ($1, $2) RETURNING id;", userId, input.Name)
+	if err := row.Scan(&res.Id); err != nil {
+		return nil, err
+	}
+
+	return res, nil
+}
+
+func (db *sqliteDB) UpdateList(ctx context.Context, input *models.List, userId int) (*models.List, error) {
+	row := db.sql.QueryRowContext(ctx, "UPDATE lists SET name=$1 WHERE id=$2 AND userid=$3 RETURNING id;", input.Name, input.Id, userId)
+	var id int
+	if err := row.Scan(&id); err != nil {
+		if err == sql.ErrNoRows {
+			err = errListNotFound
+		}
+		return nil, err
+	}
+
+	return input, nil
+}
+
+func (db *sqliteDB) ListLists(ctx context.Context, userId int) ([]models.List, error) {
+	rows, err := db.sql.QueryContext(ctx, "SELECT id, name FROM lists WHERE userid=$1 ORDER BY id ASC;", userId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	list := []models.List{}
+	for rows.Next() {
+		var id int
+		var name string
+		if err := rows.Scan(&id, &name); err != nil {
+			return nil, err
+		}
+
+		list = append(list, models.List{
+			Id:             &id,
+			AddListRequest: models.AddListRequest{Name: &name},
+		})
+	}
+
+	return list, rows.Err()
+}
+
+func (db *sqliteDB) DeleteList(ctx context.Context, input *models.DeleteListRequest, userId int) error {
+	tx, err := db.sql.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := checkListOwner(ctx, tx, input.Id, userId); err != nil {
+		return err
+	}
+
+	// the todos of the list go to the trash like deleted todos, restored they land in the inbox
+	now := sqliteNow()
+	if input.Cascade {
+		if _, err := sqliteTrashMatching(ctx, tx, "list_id=$1 AND userid=$2 AND deleted_at IS NULL", []interface{}{input.Id, userId}, userId, now); err != nil {
+			return err
+		}
+	}
+	if _, err := tx.ExecContext(ctx, "UPDATE todos SET list_id=NULL, updated_at=$3 WHERE list_id=$1 AND userid=$2;", input.Id, userId, now); err != nil {
+		return err
+	}
+
+	if _, err := tx.ExecContext(ctx, "DELETE FROM lists WHERE id=$1 AND userid=$2;", input.Id, userId); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (db *sqliteDB) MoveTodo(ctx context.Context, input *models.MoveTodoRequest, userId int) (*models.Todo, error) {
+	tx, err := db.sql.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	if input.ListId != nil {
+		if err := checkListOwner(ctx, tx, *input.ListId, userId); err != nil {
+			return nil, err
+		}
+	}
+
+	row := tx.QueryRowContext(ctx, "UPDATE todos SET list_id=$1, updated_at=$2 WHERE id=$3 AND userid=$4 AND deleted_at IS NULL RETURNING id;", input.ListId, sqliteNow(), input.Id, userId)
+	var id int
+	if err := row.Scan(&id); err != nil {
+		if err == sql.ErrNoRows {
+			err = errTodoNotFound
+		}
+		return nil, err
+	}
+
+	res, err := sqliteSelectTodo(ctx, tx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	return res, tx.Commit()
+}
@@ -0,0 +1,297 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/ann-96/todo-go-backend/app/models"
+)
+
+var errUserNotFound = errors.New("user not found")
+
+// memoryTodo is a todo of the memory store, its tags are tag ids
+type memoryTodo struct {
+	id        int
+	text      string
+	completed bool
+	due       *time.Time
+	listId    *int
+	parentId  *int
+	position  int
+	createdAt time.Time
+	updatedAt time.Time
+	deletedAt *time.Time
+	tags      []int
+}
+
+// memoryData holds the todos, tags and lists of a user. A Batch works on a clone that replaces
+// it once the batch went through, while InTx logs the data in the undo log of undo-memory.go
+// before its first change and puts it back when the unit of work fails
+type memoryData struct {
+	todos map[int]*memoryTodo
+	tags  map[int]string
+	lists map[int]string
+}
+
+func newMemoryData() *memoryData {
+	return &memoryData{
+		todos: make(map[int]*memoryTodo),
+		tags:  make(map[int]string),
+		lists: make(map[int]string),
+	}
+}
+
+// clone copies the todos, the times and slices they point at are never changed in place
+func (data *memoryData) clone() *memoryData {
+	res := &memoryData{
+		todos: make(map[int]*memoryTodo, len(data.todos)),
+		tags:  make(map[int]string, len(data.tags)),
+		lists: make(map[int]string, len(data.lists)),
+	}
+	for id, todo := range data.todos {
+		copied := *todo
+		res.todos[id] = &copied
+	}
+	for id, name := range data.tags {
+		res.tags[id] = name
+	}
+	for id, name := range data.lists {
+		res.lists[id] = name
+	}
+	return res
+}
+
+type memoryUser struct {
+	id           int
+	login        string
+	passwordHash string
+
+	displayName string
+	email       string
+	timeZone    string
+	locale      string
+	createdAt   time.Time
+	lastLoginAt *time.Time
+
+	// totpSecret is set from the start of the enrollment
+	totpSecret   string
+	totpEnabled  bool
+	totpLastStep int64
+	// recoveryCodes tell whether the code with the hash was used
+	recoveryCodes map[string]bool
+
+	accessTokens map[int]*memoryAccessToken
+
+	data *memoryData
+}
+
+type memoryDB struct {
+	TokenRevocationList
+	AttemptLimiter
+
+	mu *sync.RWMutex
+	// undo is set on the store handed to the unit of work of InTx, which holds mu already
+	undo *memoryUndo
+	*memoryState
+}
+
+// memoryState is shared by the store and the stores handed to the units of work of InTx
+type memoryState struct {
+	users  map[int]*memoryUser
+	logins map[string]*memoryUser
+	// the tokens are keyed by their hash
+	refreshTokens  map[string]*memoryRefreshToken
+	passwordResets map[string]*memoryPasswordReset
+	accessTokens   map[string]*memoryAccessToken
+
+	// the ids are never reused, like the serial columns of the SQL stores
+	lastUserId        int
+	lastTodoId        int
+	lastTagId         int
+	lastListId        int
+	lastAccessTokenId int
+}
+
+// NewMemoryDB returns a store keeping everything in the memory of the process,
+// it is lost on restart
+func NewMemoryDB() *memoryDB {
+	return &memoryDB{
+		TokenRevocationList: NewMemoryRevocationList(),
+		AttemptLimiter:      NewMemoryAttemptLimiter(),
+
+		mu: &sync.RWMutex{},
+		memoryState: &memoryState{
+			users:          make(map[int]*memoryUser),
+			logins:         make(map[string]*memoryUser),
+			refreshTokens:  make(map[string]*memoryRefreshToken),
+			passwordResets: make(map[string]*memoryPasswordReset),
+			accessTokens:   make(map[string]*memoryAccessToken),
+		},
+	}
+}
+
+// InTx runs fn on the store locked for the whole unit of work and undoes its changes when fn
+// fails, the revocations and the attempts are kept apart and stay
+func (db *memoryDB) InTx(ctx context.Context, fn func(tx Tx) error) error {
+	if err := db.lock(ctx); err != nil {
+		return err
+	}
+	defer db.unlock()
+
+	tx := *db
+	tx.undo = newMemoryUndo()
+	if err := fn(&tx); err != nil {
+		tx.undo.rollback()
+		return err
+	}
+	// the changes of a nested unit of work are undone with the enclosing one
+	if db.undo != nil {
+		db.undo.steps = append(db.undo.steps, tx.undo.steps...)
+	}
+	return nil
+}
+
+// lock takes the store for a change unless the context is already done
+func (db *memoryDB) lock(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if db.undo == nil {
+		db.mu.Lock()
+	}
+	return nil
+}
+
+func (db *memoryDB) unlock() {
+	if db.undo == nil {
+		db.mu.Unlock()
+	}
+}
+
+// rlock takes the store for reading unless the context is already done
+func (db *memoryDB) rlock(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if db.undo == nil {
+		db.mu.RLock()
+	}
+	return nil
+}
+
+func (db *memoryDB) runlock() {
+	if db.undo == nil {
+		db.mu.RUnlock()
+	}
+}
+
+func (db *memoryDB) user(userId int) (*memoryUser, error) {
+	user, ok := db.users[userId]
+	if !ok {
+		return nil, errUserNotFound
+	}
+	return user, nil
+}
+
+// memoryNow is the current time at the microsecond precision of the SQL stores
+func memoryNow() time.Time {
+	return time.Now().Truncate(time.Microsecond)
+}
+
+// memoryTime copies the time at the precision of memoryNow
+func memoryTime(t *time.Time) *time.Time {
+	if t == nil {
+		return nil
+	}
+	res := t.Truncate(time.Microsecond)
+	return &res
+}
+
+func copyInt(i *int) *int {
+	if i == nil {
+		return nil
+	}
+	res := *i
+	return &res
+}
+
+// todoModel returns the todo as the SQL stores read it, with its sorted tag names
+func (data *memoryData) todoModel(todo *memoryTodo) models.Todo {
+	id, text, completed, position := todo.id, todo.text, todo.completed, todo.position
+	createdAt, updatedAt := todo.createdAt, todo.updatedAt
+	tags := []string{}
+	for _, tagId := range todo.tags {
+		if name, ok := data.tags[tagId]; ok {
+			tags = append(tags, name)
+		}
+	}
+	sort.Strings(tags)
+
+	return models.Todo{
+		Id:        &id,
+		Position:  &position,
+		CreatedAt: &createdAt,
+		UpdatedAt: &updatedAt,
+		AddTodoRequest: models.AddTodoRequest{
+			Text:      &text,
+			Completed: &completed,
+			Due:       memoryTime(todo.due),
+			Tags:      tags,
+			ListId:    copyInt(todo.listId),
+			ParentId:  copyInt(todo.parentId),
+		},
+	}
+}
+
+// liveTodo returns the todo of the user outside of the trash
+func (data *memoryData) liveTodo(id int) (*memoryTodo, error) {
+	todo, ok := data.todos[id]
+	if !ok || todo.deletedAt != nil {
+		return nil, errTodoNotFound
+	}
+	return todo, nil
+}
+
+// descendants returns the descendants of the todos in ids reachable through the todos
+// matching the condition, without the todos themselves
+func (data *memoryData) descendants(ids []int, matches func(todo *memoryTodo) bool) []*memoryTodo {
+	children := map[int][]*memoryTodo{}
+	for _, todo := range data.todos {
+		if todo.parentId != nil && matches(todo) {
+			children[*todo.parentId] = append(children[*todo.parentId], todo)
+		}
+	}
+
+	res := []*memoryTodo{}
+	queue := append([]int{}, ids...)
+	for len(queue) > 0 {
+		id := queue[0]
+		queue = queue[1:]
+		for _, child := range children[id] {
+			res = append(res, child)
+			queue = append(queue, child.id)
+		}
+	}
+	return res
+}
+
+// removeTodos deletes the todos in ids together with all of their descendants,
+// like the cascade of the parent_id foreign key, and returns how many of ids were deleted
+func (data *memoryData) removeTodos(ids []int) int {
+	removed := 0
+	for _, id := range ids {
+		if _, ok := data.todos[id]; ok {
+			removed++
+		}
+	}
+	for _, todo := range data.descendants(ids, func(*memoryTodo) bool { return true }) {
+		delete(data.todos, todo.id)
+	}
+	for _, id := range ids {
+		delete(data.todos, id)
+	}
+	return removed
+}
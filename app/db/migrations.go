@@ -0,0 +1,157 @@
+package db
+
+import (
+	"errors"
+	"io/fs"
+
+	"github.com/ann-96/todo-go-backend/migrations"
+	"github.com/golang-migrate/migrate/v4"
+	"github.com/golang-migrate/migrate/v4/database"
+	"github.com/golang-migrate/migrate/v4/source/iofs"
+)
+
+// ErrNoMigrations is returned by the memory store, which has no schema to migrate
+var ErrNoMigrations = errors.New("the memory store has no migrations")
+
+// MigrationStatus tells where the schema of a store stands
+type MigrationStatus struct {
+	// Version is the last applied migration, zero before the first one
+	Version uint
+	// Dirty is set when the migration of Version failed halfway, it has to be forced
+	Dirty bool
+	// Latest is the last migration embedded in the binary
+	Latest uint
+}
+
+// Migrator changes the schema of a store with the migrations embedded in the binary
+type Migrator interface {
+	// Migrate applies every migration not applied yet
+	Migrate() error
+	// MigrateSteps applies the next n migrations, or rolls back the last -n ones
+	MigrateSteps(n int) error
+	// MigrateTo applies or rolls back the migrations up to the version
+	MigrateTo(version uint) error
+	MigrationStatus() (*MigrationStatus, error)
+	// ForceMigration records the version as cleanly applied without running anything,
+	// -1 records no version at all
+	ForceMigration(version int) error
+}
+
+// sqlMigrations run the migrations in the dir of migrations.FS on a SQL store
+type sqlMigrations struct {
+	dir  string
+	name string
+	// driver returns the database driver of golang-migrate with what releases it
+	driver func() (database.Driver, func(), error)
+}
+
+func (m sqlMigrations) run(fn func(m *migrate.Migrate) error) error {
+	source, err := iofs.New(migrations.FS, m.dir)
+	if err != nil {
+		return err
+	}
+	defer source.Close()
+	driver, release, err := m.driver()
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	instance, err := migrate.NewWithInstance("iofs", source, m.name, driver)
+	if err != nil {
+		return err
+	}
+	if err := fn(instance); err != nil && err != migrate.ErrNoChange {
+		return err
+	}
+	return nil
+}
+
+func (m sqlMigrations) Migrate() error {
+	return m.run(func(instance *migrate.Migrate) error {
+		return instance.Up()
+	})
+}
+
+func (m sqlMigrations) MigrateSteps(n int) error {
+	return m.run(func(instance *migrate.Migrate) error {
+		return instance.Steps(n)
+	})
+}
+
+func (m sqlMigrations) MigrateTo(version uint) error {
+	return m.run(func(instance *migrate.Migrate) error {
+		return instance.Migrate(version)
+	})
+}
+
+func (m sqlMigrations) ForceMigration(version int) error {
+	return m.run(func(instance *migrate.Migrate) error {
+		return instance.Force(version)
+	})
+}
+
+func (m sqlMigrations) MigrationStatus() (*MigrationStatus, error) {
+	res := &MigrationStatus{}
+	latest, err := latestMigration(m.dir)
+	if err != nil {
+		return nil, err
+	}
+	res.Latest = latest
+
+	err = m.run(func(instance *migrate.Migrate) error {
+		res.Version, res.Dirty, err = instance.Version()
+		if err == migrate.ErrNilVersion {
+			return nil
+		}
+		return err
+	})
+	return res, err
+}
+
+// latestMigration returns the version of the last migration in the dir of migrations.FS
+func latestMigration(dir string) (uint, error) {
+	source, err := iofs.New(migrations.FS, dir)
+	if err != nil {
+		return 0, err
+	}
+	defer source.Close()
+
+	version, err := source.First()
+	for err == nil {
+		var next uint
+		if next, err = source.Next(version); err == nil {
+			version = next
+		}
+	}
+	if !errors.Is(err, fs.ErrNotExist) {
+		return 0, err
+	}
+	return version, nil
+}
+
+// Migrate has nothing to do, the memory store starts out with the latest schema
+func (db *memoryDB) Migrate() error {
+	return nil
+}
+
+func (db *memoryDB) MigrateSteps(n int) error {
+	return ErrNoMigrations
+}
+
+func (db *memoryDB) MigrateTo(version uint) error {
+	return ErrNoMigrations
+}
+
+func (db *memoryDB) MigrationStatus() (*MigrationStatus, error) {
+	return nil, ErrNoMigrations
+}
+
+func (db *memoryDB) ForceMigration(version int) error {
+	return ErrNoMigrations
+}
+
+// Close has nothing to release, the data of the memory store stays usable
+func (db *memoryDB) Close() error {
+	return nil
+}
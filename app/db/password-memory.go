@@ -0,0 +1,111 @@
+package db
+
+import (
+	"context"
+	"time"
+
+	"github.com/ann-96/todo-go-backend/app/tools"
+)
+
+type memoryPasswordReset struct {
+	userId    int
+	expiresAt time.Time
+	used      bool
+}
+
+func (db *memoryDB) ChangePassword(ctx context.Context, userId int, oldPassword string, newPassword string, tokensExpireAt time.Time) error {
+	hash, err := db.checkPassword(ctx, userId, oldPassword)
+	if err != nil {
+		return err
+	}
+	newHash, err := tools.HashPassword(newPassword)
+	if err != nil {
+		return err
+	}
+
+	if err := db.lock(ctx); err != nil {
+		return err
+	}
+	defer db.unlock()
+
+	user, err := db.checkedUser(userId, hash)
+	if err != nil {
+		return err
+	}
+	db.setPassword(user, newHash)
+	return db.RevokeUserTokens(ctx, userId, time.Now().Truncate(time.Second), tokensExpireAt)
+}
+
+func (db *memoryDB) VerifyPassword(ctx context.Context, userId int, password string) error {
+	_, err := db.checkPassword(ctx, userId, password)
+	return err
+}
+
+func (db *memoryDB) CreatePasswordReset(ctx context.Context, login string, tokenHash string, expiresAt time.Time) (bool, error) {
+	if err := db.lock(ctx); err != nil {
+		return false, err
+	}
+	defer db.unlock()
+
+	user, ok := db.logins[login]
+	if !ok {
+		return false, nil
+	}
+
+	// the resets that can't be redeemed anymore are dropped, nothing else cleans them up
+	now := time.Now()
+	for hash, reset := range db.passwordResets {
+		if reset.used || !reset.expiresAt.After(now) {
+			db.changePasswordReset(hash)
+			delete(db.passwordResets, hash)
+		}
+	}
+	db.changePasswordReset(tokenHash)
+	db.passwordResets[tokenHash] = &memoryPasswordReset{userId: user.id, expiresAt: expiresAt}
+	return true, nil
+}
+
+func (db *memoryDB) ResetPassword(ctx context.Context, tokenHash string, newPassword string, tokensExpireAt time.Time) error {
+	newHash, err := tools.HashPassword(newPassword)
+	if err != nil {
+		return err
+	}
+
+	if err := db.lock(ctx); err != nil {
+		return err
+	}
+	defer db.unlock()
+
+	reset, ok := db.passwordResets[tokenHash]
+	if !ok || reset.used || !reset.expiresAt.After(time.Now()) {
+		return ErrInvalidResetToken
+	}
+	user, ok := db.users[reset.userId]
+	if !ok {
+		return ErrInvalidResetToken
+	}
+
+	// every outstanding reset token of the user is spent along with this one
+	for hash, other := range db.passwordResets {
+		if other.userId == user.id {
+			db.changePasswordReset(hash)
+			other.used = true
+		}
+	}
+	db.setPassword(user, newHash)
+	return db.RevokeUserTokens(ctx, user.id, time.Now().Truncate(time.Second), tokensExpireAt)
+}
+
+// setPassword replaces the password hash of the user, ends all of their sessions and drops
+// their personal access tokens, the callers revoke the access tokens issued so far
+func (db *memoryDB) setPassword(user *memoryUser, hash string) {
+	db.changeUser(user)
+	user.passwordHash = hash
+	for tokenHash, token := range db.refreshTokens {
+		if token.userId == user.id {
+			db.changeRefreshToken(tokenHash)
+			token.family.revoked = true
+		}
+	}
+	db.removeAccessTokens(user)
+}
@@ -0,0 +1,124 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/ann-96/todo-go-backend/app/tools"
+)
+
+var (
+	ErrWrongPassword     = errors.New("the password is wrong")
+	ErrInvalidResetToken = errors.New("the reset token is invalid or expired")
+)
+
+func (db *postgresDB) ChangePassword(ctx context.Context, userId int, oldPassword string, newPassword string, tokensExpireAt time.Time) error {
+	tx, err := db.sql.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	row := tx.QueryRowContext(ctx, "SELECT passwordhash FROM users WHERE id=$1 FOR UPDATE;", userId)
+	var hash string
+	if err := row.Scan(&hash); err != nil {
+		if err == sql.ErrNoRows {
+			err = ErrWrongPassword
+		}
+		return err
+	}
+	ok, _, err := tools.VerifyPassword(oldPassword, hash)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return ErrWrongPassword
+	}
+
+	if err := setPassword(ctx, tx, userId, newPassword, tokensExpireAt); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (db *postgresDB) VerifyPassword(ctx context.Context, userId int, password string) error {
+	row := db.sql.QueryRowContext(ctx, "SELECT passwordhash FROM users WHERE id=$1;", userId)
+	var hash string
+	if err := row.Scan(&hash); err != nil {
+		if err == sql.ErrNoRows {
+			err = ErrWrongPassword
+		}
+		return err
+	}
+	ok, _, err := tools.VerifyPassword(password, hash)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return ErrWrongPassword
+	}
+	return nil
+}
+
+func (db *postgresDB) CreatePasswordReset(ctx context.Context, login string, tokenHash string, expiresAt time.Time) (bool, error) {
+	res, err := db.sql.ExecContext(ctx, `
+		INSERT INTO password_resets(userid, token_hash, expires_at)
+		SELECT id, $2, $3 FROM users WHERE login=$1;`, login, tokenHash, expiresAt)
+	if err != nil {
+		return false, err
+	}
+	created, err := res.RowsAffected()
+	return created > 0, err
+}
+
+func (db *postgresDB) ResetPassword(ctx context.Context, tokenHash string, newPassword string, tokensExpireAt time.Time) error {
+	tx, err := db.sql.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	row := tx.QueryRowContext(ctx, `
+		SELECT userid FROM password_resets
+		WHERE token_hash=$1 AND used_at IS NULL AND expires_at > now()
+		FOR UPDATE;`, tokenHash)
+	var userId int
+	if err := row.Scan(&userId); err != nil {
+		if err == sql.ErrNoRows {
+			err = ErrInvalidResetToken
+		}
+		return err
+	}
+
+	// every outstanding reset token of the user is spent along with this one
+	if _, err := tx.ExecContext(ctx, "UPDATE password_resets SET used_at=now() WHERE userid=$1 AND used_at IS NULL;", userId); err != nil {
+		return err
+	}
+	if err := setPassword(ctx, tx, userId, newPassword, tokensExpireAt); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// setPassword replaces the password of the user, ends all of their sessions, drops their personal
+// access tokens and revokes the access tokens issued before the current second
+func setPassword(ctx context.Context, tx *sqlTx, userId int, password string, tokensExpireAt time.Time) error {
+	hash, err := tools.HashPassword(password)
+	if err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, "UPDATE users SET passwordhash=$1 WHERE id=$2;", hash, userId); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, "UPDATE refresh_tokens SET revoked_at=now() WHERE userid=$1 AND revoked_at IS NULL;", userId); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, "DELETE FROM access_tokens WHERE userid=$1;", userId); err != nil {
+		return err
+	}
+	return revokeUserTokens(ctx, tx, userId, time.Now().Truncate(time.Second), tokensExpireAt)
+}
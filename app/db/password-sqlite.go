@@ -0,0 +1,117 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/ann-96/todo-go-backend/app/tools"
+)
+
+func (db *sqliteDB) ChangePassword(ctx context.Context, userId int, oldPassword string, newPassword string, tokensExpireAt time.Time) error {
+	tx, err := db.sql.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := sqliteCheckPassword(ctx, tx, userId, oldPassword); err != nil {
+		return err
+	}
+	if err := sqliteSetPassword(ctx, tx, userId, newPassword, tokensExpireAt); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (db *sqliteDB) VerifyPassword(ctx context.Context, userId int, password string) error {
+	row := db.sql.QueryRowContext(ctx, "SELECT passwordhash FROM users WHERE id=$1;", userId)
+	return verifyPasswordRow(row, password)
+}
+
+// sqliteCheckPassword verifies the password of the user within the transaction
+func sqliteCheckPassword(ctx context.Context, tx *sqlTx, userId int, password string) error {
+	row := tx.QueryRowContext(ctx, "SELECT passwordhash FROM users WHERE id=$1;", userId)
+	return verifyPasswordRow(row, password)
+}
+
+// verifyPasswordRow verifies the password against the scanned hash, a missing user
+// has a wrong password
+func verifyPasswordRow(row rowScanner, password string) error {
+	var hash string
+	if err := row.Scan(&hash); err != nil {
+		if err == sql.ErrNoRows {
+			err = ErrWrongPassword
+		}
+		return err
+	}
+	ok, _, err := tools.VerifyPassword(password, hash)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return ErrWrongPassword
+	}
+	return nil
+}
+
+func (db *sqliteDB) CreatePasswordReset(ctx context.Context, login string, tokenHash string, expiresAt time.Time) (bool, error) {
+	res, err := db.sql.ExecContext(ctx, `
+		INSERT INTO password_resets(userid, token_hash, expires_at, created_at)
+		SELECT id, $2, $3, $4 FROM users WHERE login=$1;`, login, tokenHash, expiresAt.UnixMicro(), sqliteNow())
+	if err != nil {
+		return false, err
+	}
+	created, err := res.RowsAffected()
+	return created > 0, err
+}
+
+func (db *sqliteDB) ResetPassword(ctx context.Context, tokenHash string, newPassword string, tokensExpireAt time.Time) error {
+	tx, err := db.sql.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	now := sqliteNow()
+	row := tx.QueryRowContext(ctx, `
+		SELECT userid FROM password_resets
+		WHERE token_hash=$1 AND used_at IS NULL AND expires_at > $2;`, tokenHash, now)
+	var userId int
+	if err := row.Scan(&userId); err != nil {
+		if err == sql.ErrNoRows {
+			err = ErrInvalidResetToken
+		}
+		return err
+	}
+
+	// every outstanding reset token of the user is spent along with this one
+	if _, err := tx.ExecContext(ctx, "UPDATE password_resets SET used_at=$1 WHERE userid=$2 AND used_at IS NULL;", now, userId); err != nil {
+		return err
+	}
+	if err := sqliteSetPassword(ctx, tx, userId, newPassword, tokensExpireAt); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// sqliteSetPassword replaces the password of the user, ends all of their sessions, drops their
+// personal access tokens and revokes the access tokens issued before the current second
+func sqliteSetPassword(ctx context.Context, tx *sqlTx, userId int, password string, tokensExpireAt time.Time) error {
+	hash, err := tools.HashPassword(password)
+	if err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, "UPDATE users SET passwordhash=$1 WHERE id=$2;", hash, userId); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, "UPDATE refresh_tokens SET revoked_at=$1 WHERE userid=$2 AND revoked_at IS NULL;", sqliteNow(), userId); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, "DELETE FROM access_tokens WHERE userid=$1;", userId); err != nil {
+		return err
+	}
+	return sqliteRevokeUserTokens(ctx, tx, userId, time.Now().Truncate(time.Second), tokensExpireAt)
+}
@@ -0,0 +1,76 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"log"
+	"time"
+)
+
+const (
+	// pingTimeout bounds every ping of connect
+	pingTimeout           = 5 * time.Second
+	defaultConnectBackoff = time.Second
+	maxConnectBackoff     = 30 * time.Second
+)
+
+// Pool is implemented by the stores keeping a connection pool
+type Pool interface {
+	Stats() sql.DBStats
+}
+
+// configurePool applies the pool limits of the settings, zero keeps the database/sql defaults
+func configurePool(pool *sql.DB, settings Settings) {
+	if settings.MaxOpenConns > 0 {
+		pool.SetMaxOpenConns(settings.MaxOpenConns)
+	}
+	if settings.MaxIdleConns > 0 {
+		pool.SetMaxIdleConns(settings.MaxIdleConns)
+	}
+	if settings.ConnMaxLifetime > 0 {
+		pool.SetConnMaxLifetime(settings.ConnMaxLifetime)
+	}
+	if settings.ConnMaxIdleTime > 0 {
+		pool.SetConnMaxIdleTime(settings.ConnMaxIdleTime)
+	}
+}
+
+// connect pings the database until it answers, up to ConnectRetries more times with a backoff
+// doubling from ConnectBackoff
+func connect(pool *sql.DB, settings Settings) error {
+	backoff := settings.ConnectBackoff
+	if backoff <= 0 {
+		backoff = defaultConnectBackoff
+	}
+
+	for attempt := 0; ; attempt++ {
+		ctx, cancel := context.WithTimeout(context.Background(), pingTimeout)
+		err := pool.PingContext(ctx)
+		cancel()
+		if err == nil || attempt >= settings.ConnectRetries {
+			return err
+		}
+
+		log.Printf("The database is unreachable, retrying in %v: %v", backoff, err)
+		time.Sleep(backoff)
+		if backoff *= 2; backoff > maxConnectBackoff {
+			backoff = maxConnectBackoff
+		}
+	}
+}
+
+func (db *postgresDB) Stats() sql.DBStats {
+	return db.sql.Stats()
+}
+
+func (db *sqliteDB) Stats() sql.DBStats {
+	return db.sql.Stats()
+}
+
+func (db *postgresDB) Close() error {
+	return db.sql.Close()
+}
+
+func (db *sqliteDB) Close() error {
+	return db.sql.Close()
+}
@@ -0,0 +1,67 @@
+package db
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestPostgresDSN(t *testing.T) {
+	cases := []struct {
+		settings Settings
+		dsn      string
+	}{
+		{
+			Settings{IP: "localhost", Port: "5432", User: "postgres", Password: "it's a \\ secret", Name: "todos"},
+			`host='localhost' port='5432' user='postgres' password='it\'s a \\ secret' dbname='todos' sslmode='disable'`,
+		},
+		{
+			Settings{IP: "db", Port: "5432", User: "postgres", Name: "todos", SSLMode: "verify-full", SSLRootCert: "/certs/ca.pem"},
+			`host='db' port='5432' user='postgres' password='' dbname='todos' sslmode='verify-full' sslrootcert='/certs/ca.pem'`,
+		},
+		{
+			Settings{DSN: "host=db dbname=todos sslmode=require", SSLCert: "/certs/client.pem", SSLKey: "/certs/client.key", IP: "ignored"},
+			`host=db dbname=todos sslmode=require sslcert='/certs/client.pem' sslkey='/certs/client.key'`,
+		},
+		{
+			Settings{DSN: "postgres://user:pass@db:5432/todos?sslmode=disable&application_name=todos", SSLMode: "verify-ca"},
+			`postgres://user:pass@db:5432/todos?application_name=todos&sslmode=verify-ca`,
+		},
+		{
+			Settings{DSN: "postgresql://db/todos"},
+			`postgresql://db/todos`,
+		},
+	}
+	for _, c := range cases {
+		dsn, err := c.settings.postgresDSN()
+		require.NoError(t, err)
+		require.Equal(t, c.dsn, dsn)
+	}
+
+	_, err := Settings{DSN: "postgres://db:port/todos"}.postgresDSN()
+	require.Error(t, err)
+}
+
+func TestConnectRetries(t *testing.T) {
+	started := time.Now()
+	_, err := CreatePostgresDB(Settings{IP: "127.0.0.1", Port: "1", User: "postgres", Name: "postgres",
+		ConnectRetries: 2, ConnectBackoff: 10 * time.Millisecond})
+	require.Error(t, err)
+	require.GreaterOrEqual(t, time.Since(started), 30*time.Millisecond)
+}
+
+func TestPoolSettings(t *testing.T) {
+	store, err := Open(Settings{Driver: DriverSQLite, Path: filepath.Join(t.TempDir(), "todos.db"), MaxOpenConns: 3, ConnMaxLifetime: time.Minute})
+	require.NoError(t, err)
+	pool, ok := store.(Pool)
+	require.True(t, ok)
+	require.Equal(t, 3, pool.Stats().MaxOpenConnections)
+	require.Equal(t, 1, pool.Stats().OpenConnections)
+
+	store, err = Open(Settings{Driver: DriverMemory})
+	require.NoError(t, err)
+	_, ok = store.(Pool)
+	require.False(t, ok)
+}
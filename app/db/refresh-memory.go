@@ -0,0 +1,89 @@
+package db
+
+import (
+	"context"
+	"time"
+)
+
+type memoryRefreshToken struct {
+	userId    int
+	family    *memoryRefreshFamily
+	expiresAt time.Time
+	used      bool
+}
+
+// memoryRefreshFamily is shared by the tokens rotated from the same login
+type memoryRefreshFamily struct {
+	revoked bool
+}
+
+func (db *memoryDB) CreateRefreshToken(ctx context.Context, userId int, tokenHash string, expiresAt time.Time) error {
+	if err := db.lock(ctx); err != nil {
+		return err
+	}
+	defer db.unlock()
+
+	if _, err := db.user(userId); err != nil {
+		return err
+	}
+	db.changeRefreshToken(tokenHash)
+	db.refreshTokens[tokenHash] = &memoryRefreshToken{userId: userId, family: &memoryRefreshFamily{}, expiresAt: expiresAt}
+	return nil
+}
+
+func (db *memoryDB) RotateRefreshToken(ctx context.Context, oldHash string, newHash string, expiresAt time.Time) (int, error) {
+	if err := db.lock(ctx); err != nil {
+		return 0, err
+	}
+	defer db.unlock()
+
+	token, ok := db.refreshTokens[oldHash]
+	if !ok {
+		return 0, ErrInvalidRefreshToken
+	}
+	db.changeRefreshToken(oldHash)
+
+	// a spent token presented again means it leaked, so the whole family goes
+	if token.used || token.family.revoked {
+		token.family.revoked = true
+		return 0, ErrRefreshTokenReused
+	}
+	if token.expiresAt.Before(time.Now()) {
+		return 0, ErrInvalidRefreshToken
+	}
+
+	token.used = true
+	db.changeRefreshToken(newHash)
+	db.refreshTokens[newHash] = &memoryRefreshToken{userId: token.userId, family: token.family, expiresAt: expiresAt}
+	return token.userId, nil
+}
+
+func (db *memoryDB) RevokeRefreshToken(ctx context.Context, tokenHash string) error {
+	if err := db.lock(ctx); err != nil {
+		return err
+	}
+	defer db.unlock()
+
+	if token, ok := db.refreshTokens[tokenHash]; ok {
+		db.changeRefreshToken(tokenHash)
+		token.family.revoked = true
+	}
+	return nil
+}
+
+func (db *memoryDB) PruneRefreshTokens(ctx context.Context, before time.Time) (int, error) {
+	if err := db.lock(ctx); err != nil {
+		return 0, err
+	}
+	defer db.unlock()
+
+	pruned := 0
+	for hash, token := range db.refreshTokens {
+		if token.expiresAt.Before(before) {
+			db.changeRefreshToken(hash)
+			delete(db.refreshTokens, hash)
+			pruned++
+		}
+	}
+	return pruned, nil
+}
@@ -0,0 +1,83 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+var (
+	ErrInvalidRefreshToken = errors.New("the refresh token is invalid or expired")
+	ErrRefreshTokenReused  = errors.New("the refresh token was already used, all the tokens of its session are revoked")
+)
+
+func (db *postgresDB) CreateRefreshToken(ctx context.Context, userId int, tokenHash string, expiresAt time.Time) error {
+	_, err := db.sql.ExecContext(ctx, "INSERT INTO refresh_tokens(userid, family_id, token_hash, expires_at) VALUES ($1, $2, $3, $4);",
+		userId, uuid.New().String(), tokenHash, expiresAt)
+	return err
+}
+
+func (db *postgresDB) RotateRefreshToken(ctx context.Context, oldHash string, newHash string, expiresAt time.Time) (int, error) {
+	tx, err := db.sql.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	row := tx.QueryRowContext(ctx, `
+		SELECT userid, family_id, expires_at, used_at IS NOT NULL OR revoked_at IS NOT NULL
+		FROM refresh_tokens WHERE token_hash=$1 FOR UPDATE;`, oldHash)
+	var userId int
+	var familyId string
+	var oldExpiresAt time.Time
+	var spent bool
+	if err := row.Scan(&userId, &familyId, &oldExpiresAt, &spent); err != nil {
+		if err == sql.ErrNoRows {
+			err = ErrInvalidRefreshToken
+		}
+		return 0, err
+	}
+
+	// a spent token presented again means it leaked, so the whole family goes
+	if spent {
+		if _, err := tx.ExecContext(ctx, "UPDATE refresh_tokens SET revoked_at=now() WHERE family_id=$1 AND revoked_at IS NULL;", familyId); err != nil {
+			return 0, err
+		}
+		if err := tx.Commit(); err != nil {
+			return 0, err
+		}
+		return 0, ErrRefreshTokenReused
+	}
+	if oldExpiresAt.Before(time.Now()) {
+		return 0, ErrInvalidRefreshToken
+	}
+
+	if _, err := tx.ExecContext(ctx, "UPDATE refresh_tokens SET used_at=now() WHERE token_hash=$1;", oldHash); err != nil {
+		return 0, err
+	}
+	if _, err := tx.ExecContext(ctx, "INSERT INTO refresh_tokens(userid, family_id, token_hash, expires_at) VALUES ($1, $2, $3, $4);",
+		userId, familyId, newHash, expiresAt); err != nil {
+		return 0, err
+	}
+
+	return userId, tx.Commit()
+}
+
+func (db *postgresDB) RevokeRefreshToken(ctx context.Context, tokenHash string) error {
+	_, err := db.sql.ExecContext(ctx, `
+		UPDATE refresh_tokens SET revoked_at=now()
+		WHERE family_id=(SELECT family_id FROM refresh_tokens WHERE token_hash=$1) AND revoked_at IS NULL;`, tokenHash)
+	return err
+}
+
+func (db *postgresDB) PruneRefreshTokens(ctx context.Context, before time.Time) (int, error) {
+	res, err := db.sql.ExecContext(ctx, "DELETE FROM refresh_tokens WHERE expires_at < $1;", before)
+	if err != nil {
+		return 0, err
+	}
+	pruned, err := res.RowsAffected()
+	return int(pruned), err
+}
@@ -0,0 +1,78 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func (db *sqliteDB) CreateRefreshToken(ctx context.Context, userId int, tokenHash string, expiresAt time.Time) error {
+	_, err := db.sql.ExecContext(ctx, "INSERT INTO refresh_tokens(userid, family_id, token_hash, expires_at, created_at) VALUES ($1, $2, $3, $4, $5);",
+		userId, uuid.New().String(), tokenHash, expiresAt.UnixMicro(), sqliteNow())
+	return err
+}
+
+func (db *sqliteDB) RotateRefreshToken(ctx context.Context, oldHash string, newHash string, expiresAt time.Time) (int, error) {
+	tx, err := db.sql.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	row := tx.QueryRowContext(ctx, `
+		SELECT userid, family_id, expires_at, used_at IS NOT NULL OR revoked_at IS NOT NULL
+		FROM refresh_tokens WHERE token_hash=$1;`, oldHash)
+	var userId int
+	var familyId string
+	var oldExpiresAt sqliteTime
+	var spent bool
+	if err := row.Scan(&userId, &familyId, &oldExpiresAt, &spent); err != nil {
+		if err == sql.ErrNoRows {
+			err = ErrInvalidRefreshToken
+		}
+		return 0, err
+	}
+
+	now := sqliteNow()
+	// a spent token presented again means it leaked, so the whole family goes
+	if spent {
+		if _, err := tx.ExecContext(ctx, "UPDATE refresh_tokens SET revoked_at=$1 WHERE family_id=$2 AND revoked_at IS NULL;", now, familyId); err != nil {
+			return 0, err
+		}
+		if err := tx.Commit(); err != nil {
+			return 0, err
+		}
+		return 0, ErrRefreshTokenReused
+	}
+	if oldExpiresAt.Time.Before(time.Now()) {
+		return 0, ErrInvalidRefreshToken
+	}
+
+	if _, err := tx.ExecContext(ctx, "UPDATE refresh_tokens SET used_at=$1 WHERE token_hash=$2;", now, oldHash); err != nil {
+		return 0, err
+	}
+	if _, err := tx.ExecContext(ctx, "INSERT INTO refresh_tokens(userid, family_id, token_hash, expires_at, created_at) VALUES ($1, $2, $3, $4, $5);",
+		userId, familyId, newHash, expiresAt.UnixMicro(), now); err != nil {
+		return 0, err
+	}
+
+	return userId, tx.Commit()
+}
+
+func (db *sqliteDB) RevokeRefreshToken(ctx context.Context, tokenHash string) error {
+	_, err := db.sql.ExecContext(ctx, `
+		UPDATE refresh_tokens SET revoked_at=$2
+		WHERE family_id=(SELECT family_id FROM refresh_tokens WHERE token_hash=$1) AND revoked_at IS NULL;`, tokenHash, sqliteNow())
+	return err
+}
+
+func (db *sqliteDB) PruneRefreshTokens(ctx context.Context, before time.Time) (int, error) {
+	res, err := db.sql.ExecContext(ctx, "DELETE FROM refresh_tokens WHERE expires_at < $1;", before.UnixMicro())
+	if err != nil {
+		return 0, err
+	}
+	pruned, err := res.RowsAffected()
+	return int(pruned), err
+}
@@ -0,0 +1,62 @@
+package db
+
+import (
+	"context"
+	"time"
+)
+
+func (db *postgresDB) RevokeToken(ctx context.Context, jti string, expiresAt time.Time) error {
+	_, err := db.sql.ExecContext(ctx, "INSERT INTO revoked_tokens(jti, expires_at) VALUES ($1, $2) ON CONFLICT (jti) DO NOTHING;", jti, expiresAt)
+	return err
+}
+
+func (db *postgresDB) RevokeUserTokens(ctx context.Context, userId int, issuedBefore time.Time, expiresAt time.Time) error {
+	tx, err := db.sql.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := revokeUserTokens(ctx, tx, userId, issuedBefore, expiresAt); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func revokeUserTokens(ctx context.Context, tx *sqlTx, userId int, issuedBefore time.Time, expiresAt time.Time) error {
+	_, err := tx.ExecContext(ctx, `
+		INSERT INTO revoked_users(userid, revoked_before, expires_at) VALUES ($1, $2, $3)
+		ON CONFLICT (userid) DO UPDATE SET
+			revoked_before=GREATEST(revoked_users.revoked_before, EXCLUDED.revoked_before),
+			expires_at=GREATEST(revoked_users.expires_at, EXCLUDED.expires_at);`, userId, issuedBefore, expiresAt)
+	return err
+}
+
+func (db *postgresDB) IsTokenRevoked(ctx context.Context, jti string, userId int, issuedAt time.Time) (bool, error) {
+	row := db.sql.QueryRowContext(ctx, `
+		SELECT EXISTS(SELECT 1 FROM revoked_tokens WHERE jti=$1)
+			OR EXISTS(SELECT 1 FROM revoked_users WHERE userid=$2 AND revoked_before > $3);`, jti, userId, issuedAt)
+	var revoked bool
+	if err := row.Scan(&revoked); err != nil {
+		return false, err
+	}
+	return revoked, nil
+}
+
+func (db *postgresDB) PruneRevokedTokens(ctx context.Context, before time.Time) (int, error) {
+	res, err := db.sql.ExecContext(ctx, "DELETE FROM revoked_tokens WHERE expires_at < $1;", before)
+	if err != nil {
+		return 0, err
+	}
+	pruned, err := res.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+
+	res, err = db.sql.ExecContext(ctx, "DELETE FROM revoked_users WHERE expires_at < $1;", before)
+	if err != nil {
+		return 0, err
+	}
+	prunedUsers, err := res.RowsAffected()
+	return int(pruned + prunedUsers), err
+}
@@ -0,0 +1,89 @@
+package db
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// TokenRevocationList holds the ids of the revoked tokens and the users whose tokens issued
+// before a cutoff are revoked until the tokens expire
+type TokenRevocationList interface {
+	RevokeToken(ctx context.Context, jti string, expiresAt time.Time) error
+	// RevokeUserTokens revokes the tokens of the user issued before issuedBefore, they all expire
+	// before expiresAt. The issue times have a second precision, so a cutoff in the middle of a
+	// second spares the tokens issued earlier in that second
+	RevokeUserTokens(ctx context.Context, userId int, issuedBefore time.Time, expiresAt time.Time) error
+	// IsTokenRevoked tells whether the token is revoked or was issued before the cutoff of its user
+	IsTokenRevoked(ctx context.Context, jti string, userId int, issuedAt time.Time) (bool, error)
+	// PruneRevokedTokens forgets the tokens expired before the given time
+	PruneRevokedTokens(ctx context.Context, before time.Time) (int, error)
+}
+
+type memoryRevocationList struct {
+	mu      sync.Mutex
+	revoked map[string]time.Time
+	users   map[int]revokedUser
+}
+
+type revokedUser struct {
+	issuedBefore time.Time
+	expiresAt    time.Time
+}
+
+// NewMemoryRevocationList returns a TokenRevocationList local to the process
+func NewMemoryRevocationList() TokenRevocationList {
+	return &memoryRevocationList{revoked: make(map[string]time.Time), users: make(map[int]revokedUser)}
+}
+
+func (l *memoryRevocationList) RevokeToken(ctx context.Context, jti string, expiresAt time.Time) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.revoked[jti] = expiresAt
+	return nil
+}
+
+func (l *memoryRevocationList) RevokeUserTokens(ctx context.Context, userId int, issuedBefore time.Time, expiresAt time.Time) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	user := l.users[userId]
+	if issuedBefore.After(user.issuedBefore) {
+		user.issuedBefore = issuedBefore
+	}
+	if expiresAt.After(user.expiresAt) {
+		user.expiresAt = expiresAt
+	}
+	l.users[userId] = user
+	return nil
+}
+
+func (l *memoryRevocationList) IsTokenRevoked(ctx context.Context, jti string, userId int, issuedAt time.Time) (bool, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	_, ok := l.revoked[jti]
+	user, userRevoked := l.users[userId]
+	return ok || (userRevoked && issuedAt.Before(user.issuedBefore)), nil
+}
+
+func (l *memoryRevocationList) PruneRevokedTokens(ctx context.Context, before time.Time) (int, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	pruned := 0
+	for jti, expiresAt := range l.revoked {
+		if expiresAt.Before(before) {
+			delete(l.revoked, jti)
+			pruned++
+		}
+	}
+	for userId, user := range l.users {
+		if user.expiresAt.Before(before) {
+			delete(l.users, userId)
+			pruned++
+		}
+	}
+	return pruned, nil
+}
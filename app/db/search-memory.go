@@ -0,0 +1,116 @@
+package db
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/ann-96/todo-go-backend/app/models"
+)
+
+// searchWord is a word of a todo text, start and end are byte offsets
+type searchWord struct {
+	word       string
+	start, end int
+}
+
+// searchWords splits the text into lower case words like tools.SearchTerms splits a query
+func searchWords(text string) []searchWord {
+	res := []searchWord{}
+	start := -1
+	for i, r := range text {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			if start < 0 {
+				start = i
+			}
+			continue
+		}
+		if start >= 0 {
+			res = append(res, searchWord{word: strings.ToLower(text[start:i]), start: start, end: i})
+			start = -1
+		}
+	}
+	if start >= 0 {
+		res = append(res, searchWord{word: strings.ToLower(text[start:]), start: start, end: len(text)})
+	}
+	return res
+}
+
+// searchTodo tells whether every term starts a word of the text, the rank is the share of
+// the words matching a term and the snippet marks them
+func searchTodo(text string, terms []string) (bool, float64, string) {
+	words := searchWords(text)
+	matched := make([]bool, len(words))
+	for _, term := range terms {
+		found := false
+		for i, word := range words {
+			if strings.HasPrefix(word.word, term) {
+				matched[i], found = true, true
+			}
+		}
+		if !found {
+			return false, 0, ""
+		}
+	}
+
+	var snippet strings.Builder
+	hits, last := 0, 0
+	for i, word := range words {
+		if !matched[i] {
+			continue
+		}
+		hits++
+		snippet.WriteString(text[last:word.start])
+		snippet.WriteString(snippetStart + text[word.start:word.end] + snippetStop)
+		last = word.end
+	}
+	snippet.WriteString(text[last:])
+
+	return true, float64(hits) / float64(len(words)), markSnippet(snippet.String())
+}
+
+func (db *memoryDB) Search(ctx context.Context, terms []string, count int, userId int) (*models.SearchResult, error) {
+	if err := db.rlock(ctx); err != nil {
+		return nil, err
+	}
+	defer db.runlock()
+
+	res := &models.SearchResult{
+		List: []models.SearchHit{},
+	}
+	user, ok := db.users[userId]
+	if !ok || len(terms) == 0 {
+		return res, nil
+	}
+	lowered := make([]string, 0, len(terms))
+	for _, term := range terms {
+		lowered = append(lowered, strings.ToLower(term))
+	}
+
+	for _, todo := range user.data.todos {
+		if todo.deletedAt != nil {
+			continue
+		}
+		ok, rank, snippet := searchTodo(todo.text, lowered)
+		if !ok {
+			continue
+		}
+		res.List = append(res.List, models.SearchHit{
+			Todo:    user.data.todoModel(todo),
+			Rank:    rank,
+			Snippet: snippet,
+		})
+	}
+	sort.Slice(res.List, func(i, j int) bool {
+		if res.List[i].Rank != res.List[j].Rank {
+			return res.List[i].Rank > res.List[j].Rank
+		}
+		return *res.List[i].Id > *res.List[j].Id
+	})
+	if len(res.List) > count {
+		res.List = res.List[:count]
+	}
+
+	return res, nil
+}
@@ -0,0 +1,49 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/ann-96/todo-go-backend/app/models"
+)
+
+func (db *postgresDB) Search(ctx context.Context, terms []string, count int, userId int) (*models.SearchResult, error) {
+	prefixes := make([]string, 0, len(terms))
+	for _, term := range terms {
+		prefixes = append(prefixes, term+":*")
+	}
+
+	stm := fmt.Sprintf(`
+		SELECT %s,
+			ts_rank(search, query) AS rank,
+			ts_headline('simple', task, query, $4)
+		FROM todos, to_tsquery('simple', $2) query
+		WHERE userid=$1 AND deleted_at IS NULL AND search @@ query
+		ORDER BY rank DESC, id DESC
+		LIMIT $3;
+		`, todoColumns)
+	headlineOptions := fmt.Sprintf("StartSel=%s, StopSel=%s, MaxFragments=2", snippetStart, snippetStop)
+	rows, err := db.sql.QueryContext(ctx, stm, userId, strings.Join(prefixes, " & "), count, headlineOptions)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	res := &models.SearchResult{
+		List: []models.SearchHit{},
+	}
+	for rows.Next() {
+		hit := models.SearchHit{}
+		todo, err := scanTodo(rows, &hit.Rank, &hit.Snippet)
+		if err != nil {
+			return nil, err
+		}
+		hit.Todo = *todo
+		hit.Snippet = markSnippet(hit.Snippet)
+
+		res.List = append(res.List, hit)
+	}
+
+	return res, rows.Err()
+}
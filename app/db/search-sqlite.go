@@ -0,0 +1,57 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/ann-96/todo-go-backend/app/models"
+)
+
+func (db *sqliteDB) Search(ctx context.Context, terms []string, count int, userId int) (*models.SearchResult, error) {
+	res := &models.SearchResult{
+		List: []models.SearchHit{},
+	}
+	if len(terms) == 0 {
+		return res, nil
+	}
+
+	// every term is a quoted prefix query, the terms are only letters and digits anyway
+	prefixes := make([]string, 0, len(terms))
+	for _, term := range terms {
+		prefixes = append(prefixes, `"`+strings.ReplaceAll(term, `"`, `""`)+`"*`)
+	}
+
+	stm := fmt.Sprintf(`
+		SELECT %s, hits.hit_rank, hits.snippet
+		FROM todos JOIN (
+			SELECT rowid,
+				-bm25(todos_fts) AS hit_rank,
+				highlight(todos_fts, 0, $4, $5) AS snippet
+			FROM todos_fts
+			WHERE todos_fts MATCH $2
+		) AS hits ON hits.rowid = todos.id
+		WHERE userid=$1 AND deleted_at IS NULL
+		ORDER BY hits.hit_rank DESC, id DESC
+		LIMIT $3;
+		`, sqliteTodoColumns)
+	rows, err := db.sql.QueryContext(ctx, stm, userId, strings.Join(prefixes, " AND "), count, snippetStart, snippetStop)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		hit := models.SearchHit{}
+		todo, err := scanSQLiteTodo(rows, &hit.Rank, &hit.Snippet)
+		if err != nil {
+			return nil, err
+		}
+		hit.Todo = *todo
+		hit.Snippet = markSnippet(hit.Snippet)
+
+		res.List = append(res.List, hit)
+	}
+
+	return res, rows.Err()
+}
@@ -0,0 +1,20 @@
+package db
+
+import (
+	"html"
+	"strings"
+)
+
+// the stores delimit the matches of a snippet with control characters, the snippet is HTML
+// escaped before they become <mark> tags, so no markup of the todo text gets through
+const (
+	snippetStart = "\x01"
+	snippetStop  = "\x02"
+)
+
+var snippetMarks = strings.NewReplacer(snippetStart, "<mark>", snippetStop, "</mark>")
+
+// markSnippet HTML escapes the snippet and wraps its delimited matches in <mark> tags
+func markSnippet(snippet string) string {
+	return snippetMarks.Replace(html.EscapeString(snippet))
+}
@@ -0,0 +1,124 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+)
+
+// sqlConn is the pool of a SQL store, or the transaction of InTx once the store is bound to one
+type sqlConn struct {
+	*sql.DB
+
+	tx *sql.Tx
+	// savepoints numbers the savepoints of tx, the stores nested in the same transaction share it
+	savepoints *int
+}
+
+func newSQLConn(pool *sql.DB) *sqlConn {
+	return &sqlConn{DB: pool}
+}
+
+// bound returns the connection running everything on tx
+func (conn *sqlConn) bound(tx *sqlTx) *sqlConn {
+	if conn.tx != nil {
+		return conn
+	}
+	return &sqlConn{DB: conn.DB, tx: tx.Tx, savepoints: new(int)}
+}
+
+func (conn *sqlConn) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	if conn.tx != nil {
+		return conn.tx.ExecContext(ctx, query, args...)
+	}
+	return conn.DB.ExecContext(ctx, query, args...)
+}
+
+func (conn *sqlConn) QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	if conn.tx != nil {
+		return conn.tx.QueryContext(ctx, query, args...)
+	}
+	return conn.DB.QueryContext(ctx, query, args...)
+}
+
+func (conn *sqlConn) QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row {
+	if conn.tx != nil {
+		return conn.tx.QueryRowContext(ctx, query, args...)
+	}
+	return conn.DB.QueryRowContext(ctx, query, args...)
+}
+
+func (conn *sqlConn) PrepareContext(ctx context.Context, query string) (*sql.Stmt, error) {
+	if conn.tx != nil {
+		return conn.tx.PrepareContext(ctx, query)
+	}
+	return conn.DB.PrepareContext(ctx, query)
+}
+
+// BeginTx starts a transaction, or a savepoint when the connection is bound to one already
+func (conn *sqlConn) BeginTx(ctx context.Context, opts *sql.TxOptions) (*sqlTx, error) {
+	if conn.tx == nil {
+		tx, err := conn.DB.BeginTx(ctx, opts)
+		if err != nil {
+			return nil, err
+		}
+		return &sqlTx{Tx: tx}, nil
+	}
+
+	*conn.savepoints++
+	savepoint := fmt.Sprintf("savepoint_%d", *conn.savepoints)
+	if _, err := conn.tx.ExecContext(ctx, "SAVEPOINT "+savepoint); err != nil {
+		return nil, err
+	}
+	return &sqlTx{Tx: conn.tx, savepoint: savepoint}, nil
+}
+
+// sqlTx is a transaction of sqlConn.BeginTx, committing or rolling back a savepoint only
+// releases it or undoes what was done since
+type sqlTx struct {
+	*sql.Tx
+
+	savepoint string
+	done      bool
+}
+
+func (tx *sqlTx) Commit() error {
+	if tx.savepoint == "" {
+		return tx.Tx.Commit()
+	}
+	if tx.done {
+		return sql.ErrTxDone
+	}
+	tx.done = true
+	_, err := tx.Tx.Exec("RELEASE SAVEPOINT " + tx.savepoint)
+	return err
+}
+
+func (tx *sqlTx) Rollback() error {
+	if tx.savepoint == "" {
+		return tx.Tx.Rollback()
+	}
+	if tx.done {
+		return sql.ErrTxDone
+	}
+	tx.done = true
+	if _, err := tx.Tx.Exec("ROLLBACK TO SAVEPOINT " + tx.savepoint); err != nil {
+		return err
+	}
+	_, err := tx.Tx.Exec("RELEASE SAVEPOINT " + tx.savepoint)
+	return err
+}
+
+// inTx runs fn on a connection bound to a transaction and commits it when fn returns nil
+func (conn *sqlConn) inTx(ctx context.Context, fn func(conn *sqlConn) error) error {
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := fn(conn.bound(tx)); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,34 @@
+package db
+
+import (
+	"errors"
+	"fmt"
+)
+
+// the storage drivers of Settings.Driver
+const (
+	DriverPostgres = "postgres"
+	DriverSQLite   = "sqlite"
+	DriverMemory   = "memory"
+)
+
+// Open returns the store of the driver in the settings, it isn't migrated yet
+func Open(settings Settings) (Store, error) {
+	switch settings.Driver {
+	case DriverPostgres, "":
+		return CreatePostgresDB(settings)
+	case DriverSQLite:
+		return CreateSQLiteDB(settings)
+	case DriverMemory:
+		return NewMemoryDB(), nil
+	}
+	return nil, fmt.Errorf("unknown storage driver %q", settings.Driver)
+}
+
+// the errors shared by the memory and sqlite stores, worded like the postgres ones
+var (
+	errTodoNotFound        = errors.New("entry not found for the user")
+	errTrashedTodoNotFound = errors.New("entry not found in the trash")
+	errListNotFound        = errors.New("list not found")
+	errTagNotFound         = errors.New("tag not found")
+)
@@ -0,0 +1,136 @@
+package db
+
+import (
+	"context"
+	"sort"
+
+	"github.com/ann-96/todo-go-backend/app/models"
+)
+
+// tagIds returns the ids of the tags with the names, tags that don't exist yet are created
+func (db *memoryDB) tagIds(data *memoryData, names []string) []int {
+	ids := map[string]int{}
+	for id, name := range data.tags {
+		ids[name] = id
+	}
+
+	res := []int{}
+	for _, name := range uniqueStrings(names) {
+		id, ok := ids[name]
+		if !ok {
+			db.lastTagId++
+			id = db.lastTagId
+			data.tags[id] = name
+		}
+		res = append(res, id)
+	}
+	return res
+}
+
+func (data *memoryData) hasTag(name string, exceptId int) bool {
+	for id, tag := range data.tags {
+		if tag == name && id != exceptId {
+			return true
+		}
+	}
+	return false
+}
+
+func (db *memoryDB) AddTag(ctx context.Context, input *models.AddTagRequest, userId int) (*models.Tag, error) {
+	if err := db.lock(ctx); err != nil {
+		return nil, err
+	}
+	defer db.unlock()
+
+	user, err := db.user(userId)
+	if err != nil {
+		return nil, err
+	}
+	if user.data.hasTag(*input.Name, 0) {
+		return nil, ErrTagExists
+	}
+	db.changeData(user)
+
+	db.lastTagId++
+	id := db.lastTagId
+	user.data.tags[id] = *input.Name
+
+	return &models.Tag{
+		Id:            &id,
+		AddTagRequest: *input,
+	}, nil
+}
+
+func (db *memoryDB) UpdateTag(ctx context.Context, input *models.Tag, userId int) (*models.Tag, error) {
+	if err := db.lock(ctx); err != nil {
+		return nil, err
+	}
+	defer db.unlock()
+
+	user, ok := db.users[userId]
+	if !ok {
+		return nil, errTagNotFound
+	}
+	if _, ok := user.data.tags[*input.Id]; !ok {
+		return nil, errTagNotFound
+	}
+	if user.data.hasTag(*input.Name, *input.Id) {
+		return nil, ErrTagExists
+	}
+	db.changeData(user)
+	user.data.tags[*input.Id] = *input.Name
+
+	return input, nil
+}
+
+func (db *memoryDB) ListTags(ctx context.Context, userId int) ([]models.Tag, error) {
+	if err := db.rlock(ctx); err != nil {
+		return nil, err
+	}
+	defer db.runlock()
+
+	list := []models.Tag{}
+	if user, ok := db.users[userId]; ok {
+		for id, name := range user.data.tags {
+			id, name := id, name
+			list = append(list, models.Tag{
+				Id:            &id,
+				AddTagRequest: models.AddTagRequest{Name: &name},
+			})
+		}
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return *list[i].Name < *list[j].Name
+	})
+
+	return list, nil
+}
+
+func (db *memoryDB) DeleteTag(ctx context.Context, id int, userId int) error {
+	if err := db.lock(ctx); err != nil {
+		return err
+	}
+	defer db.unlock()
+
+	user, ok := db.users[userId]
+	if !ok {
+		return errTagNotFound
+	}
+	if _, ok := user.data.tags[id]; !ok {
+		return errTagNotFound
+	}
+	db.changeData(user)
+	delete(user.data.tags, id)
+
+	// the tag slices are shared with the clones of a batch, so they are replaced
+	for _, todo := range user.data.todos {
+		tags := make([]int, 0, len(todo.tags))
+		for _, tagId := range todo.tags {
+			if tagId != id {
+				tags = append(tags, tagId)
+			}
+		}
+		todo.tags = tags
+	}
+	return nil
+}
@@ -0,0 +1,124 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/ann-96/todo-go-backend/app/models"
+	"github.com/lib/pq"
+)
+
+// todoTagsColumn selects the sorted tag names of a todo as an array
+const todoTagsColumn = `
+	ARRAY(
+		SELECT t.name FROM todo_tags tt JOIN tags t ON t.id = tt.tagid
+		WHERE tt.todoid = todos.id ORDER BY t.name
+	) AS tags`
+
+func (db *postgresDB) AddTag(ctx context.Context, input *models.AddTagRequest, userId int) (*models.Tag, error) {
+	res := &models.Tag{
+		AddTagRequest: *input,
+	}
+
+	row := db.sql.QueryRowContext(ctx, "INSERT INTO tags(userid, name) VALUES ($1, $2) RETURNING id;", userId, input.Name)
+	if err := row.Scan(&res.Id); err != nil {
+		if isUniqueViolation(err, "tags_userid_name_key") {
+			err = ErrTagExists
+		}
+		return nil, err
+	}
+
+	return res, nil
+}
+
+func (db *postgresDB) UpdateTag(ctx context.Context, input *models.Tag, userId int) (*models.Tag, error) {
+	row := db.sql.QueryRowContext(ctx, "UPDATE tags SET name=$1 WHERE id=$2 AND userid=$3 RETURNING id;", input.Name, input.Id, userId)
+	var id int
+	if err := row.Scan(&id); err != nil {
+		if err == sql.ErrNoRows {
+			err = fmt.Errorf("tag not found")
+		} else if isUniqueViolation(err, "tags_userid_name_key") {
+			err = ErrTagExists
+		}
+		return nil, err
+	}
+
+	return input, nil
+}
+
+func (db *postgresDB) ListTags(ctx context.Context, userId int) ([]models.Tag, error) {
+	rows, err := db.sql.QueryContext(ctx, "SELECT id, name FROM tags WHERE userid=$1 ORDER BY name ASC;", userId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	list := []models.Tag{}
+	for rows.Next() {
+		var id int
+		var name string
+		if err := rows.Scan(&id, &name); err != nil {
+			return nil, err
+		}
+
+		list = append(list, models.Tag{
+			Id:            &id,
+			AddTagRequest: models.AddTagRequest{Name: &name},
+		})
+	}
+
+	return list, rows.Err()
+}
+
+func (db *postgresDB) DeleteTag(ctx context.Context, id int, userId int) error {
+	res, err := db.sql.ExecContext(ctx, "DELETE FROM tags WHERE id=$1 AND userid=$2;", id, userId)
+	if err != nil {
+		return err
+	}
+	if deleted, err := res.RowsAffected(); err != nil {
+		return err
+	} else if deleted == 0 {
+		return errTagNotFound
+	}
+	return nil
+}
+
+// setTodoTags replaces the tags of a todo, tags that don't exist yet are created
+func setTodoTags(ctx context.Context, tx *sqlTx, todoId int, tags []string, userId int) error {
+	tags = uniqueStrings(tags)
+
+	if _, err := tx.ExecContext(ctx, "DELETE FROM todo_tags WHERE todoid=$1;", todoId); err != nil {
+		return err
+	}
+	if len(tags) == 0 {
+		return nil
+	}
+
+	insertTags := `
+		INSERT INTO tags(userid, name)
+		SELECT $1, unnest($2::text[])
+		ON CONFLICT (userid, name) DO NOTHING;`
+	if _, err := tx.ExecContext(ctx, insertTags, userId, pq.Array(tags)); err != nil {
+		return err
+	}
+
+	attachTags := `
+		INSERT INTO todo_tags(todoid, tagid)
+		SELECT $1, id FROM tags WHERE userid=$2 AND name = ANY($3);`
+	_, err := tx.ExecContext(ctx, attachTags, todoId, userId, pq.Array(tags))
+	return err
+}
+
+func uniqueStrings(in []string) []string {
+	seen := make(map[string]struct{}, len(in))
+	res := make([]string, 0, len(in))
+	for _, s := range in {
+		if _, ok := seen[s]; ok {
+			continue
+		}
+		seen[s] = struct{}{}
+		res = append(res, s)
+	}
+	return res
+}
@@ -0,0 +1,109 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/ann-96/todo-go-backend/app/models"
+)
+
+// sqliteTodoTagsColumn selects the tag names of a todo as a JSON array, scanSQLiteTodo sorts them
+const sqliteTodoTagsColumn = `
+	(
+		SELECT json_group_array(t.name) FROM todo_tags tt JOIN tags t ON t.id = tt.tagid
+		WHERE tt.todoid = todos.id
+	) AS tags`
+
+func (db *sqliteDB) AddTag(ctx context.Context, input *models.AddTagRequest, userId int) (*models.Tag, error) {
+	res := &models.Tag{
+		AddTagRequest: *input,
+	}
+
+	row := db.sql.QueryRowContext(ctx, "INSERT INTO tags(userid, name) VALUES ($1, $2) RETURNING id;", userId, input.Name)
+	if err := row.Scan(&res.Id); err != nil {
+		if isSQLiteUniqueViolation(err, "tags.userid, tags.name") {
+			err = ErrTagExists
+		}
+		return nil, err
+	}
+
+	return res, nil
+}
+
+func (db *sqliteDB) UpdateTag(ctx context.Context, input *models.Tag, userId int) (*models.Tag, error) {
+	row := db.sql.QueryRowContext(ctx, "UPDATE tags SET name=$1 WHERE id=$2 AND userid=$3 RETURNING id;", input.Name, input.Id, userId)
+	var id int
+	if err := row.Scan(&id); err != nil {
+		if err == sql.ErrNoRows {
+			err = errTagNotFound
+		} else if isSQLiteUniqueViolation(err, "tags.userid, tags.name") {
+			err = ErrTagExists
+		}
+		return nil, err
+	}
+
+	return input, nil
+}
+
+func (db *sqliteDB) ListTags(ctx context.Context, userId int) ([]models.Tag, error) {
+	rows, err := db.sql.QueryContext(ctx, "SELECT id, name FROM tags WHERE userid=$1 ORDER BY name ASC;", userId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	list := []models.Tag{}
+	for rows.Next() {
+		var id int
+		var name string
+		if err := rows.Scan(&id, &name); err != nil {
+			return nil, err
+		}
+
+		list = append(list, models.Tag{
+			Id:            &id,
+			AddTagRequest: models.AddTagRequest{Name: &name},
+		})
+	}
+
+	return list, rows.Err()
+}
+
+func (db *sqliteDB) DeleteTag(ctx context.Context, id int, userId int) error {
+	res, err := db.sql.ExecContext(ctx, "DELETE FROM tags WHERE id=$1 AND userid=$2;", id, userId)
+	if err != nil {
+		return err
+	}
+	if deleted, err := res.RowsAffected(); err != nil {
+		return err
+	} else if deleted == 0 {
+		return errTagNotFound
+	}
+	return nil
+}
+
+// sqliteSetTodoTags replaces the tags of a todo, tags that don't exist yet are created
+func sqliteSetTodoTags(ctx context.Context, tx *sqlTx, todoId int, tags []string, userId int) error {
+	tags = uniqueStrings(tags)
+
+	if _, err := tx.ExecContext(ctx, "DELETE FROM todo_tags WHERE todoid=$1;", todoId); err != nil {
+		return err
+	}
+	if len(tags) == 0 {
+		return nil
+	}
+
+	insertTags := `
+		INSERT INTO tags(userid, name)
+		SELECT $1, value FROM json_each($2) WHERE true
+		ON CONFLICT (userid, name) DO NOTHING;`
+	if _, err := tx.ExecContext(ctx, insertTags, userId, sqliteStrings(tags)); err != nil {
+		return err
+	}
+
+	attachTags := `
+		INSERT INTO todo_tags(todoid, tagid)
+		SELECT $1, id FROM tags WHERE userid=$2 AND name IN (SELECT value FROM json_each($3));`
+	_, err := tx.ExecContext(ctx, attachTags, todoId, userId, sqliteStrings(tags))
+	return err
+}
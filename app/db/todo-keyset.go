@@ -0,0 +1,32 @@
+package db
+
+import "github.com/ann-96/todo-go-backend/app/models"
+
+// keysetPage drops the extra row fetched to detect another page, restores the order of a
+// backward page and returns the cursors of the neighbouring pages
+func keysetPage(rows []models.Todo, count int, filter *models.TodoFilter) (page []models.Todo, next string, prev string) {
+	cursor := filter.Cursor
+	backward := cursor != nil && cursor.Before
+	more := len(rows) > count
+	if more {
+		rows = rows[:count]
+	}
+	if backward {
+		for i, j := 0, len(rows)-1; i < j; i, j = i+1, j-1 {
+			rows[i], rows[j] = rows[j], rows[i]
+		}
+	}
+	if len(rows) == 0 {
+		return rows, "", ""
+	}
+
+	// a backward page always has the page it was requested from after it
+	if more || backward {
+		next = models.CursorFor(&rows[len(rows)-1], filter.Sort, filter.Desc, false).Encode()
+	}
+	if (more && backward) || (cursor != nil && !backward) {
+		prev = models.CursorFor(&rows[0], filter.Sort, filter.Desc, true).Encode()
+	}
+
+	return rows, next, prev
+}
@@ -0,0 +1,380 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ann-96/todo-go-backend/app/models"
+)
+
+func (db *memoryDB) Update(ctx context.Context, input *models.Todo, userId int) (*models.Todo, error) {
+	if err := db.lock(ctx); err != nil {
+		return nil, err
+	}
+	defer db.unlock()
+
+	user, ok := db.users[userId]
+	if !ok {
+		return nil, errTodoNotFound
+	}
+	db.changeData(user)
+	return db.updateTodo(user, input)
+}
+
+func (db *memoryDB) updateTodo(user *memoryUser, input *models.Todo) (*models.Todo, error) {
+	data := user.data
+	if input.ListId != nil {
+		if _, ok := data.lists[*input.ListId]; !ok {
+			return nil, errListNotFound
+		}
+	}
+	todo, err := data.liveTodo(*input.Id)
+	if err != nil {
+		return nil, err
+	}
+
+	now := memoryNow()
+	todo.text = *input.Text
+	todo.completed = *input.Completed
+	todo.due = memoryTime(input.Due)
+	if input.ListId != nil {
+		todo.listId = copyInt(input.ListId)
+	}
+	todo.updatedAt = now
+	if input.Tags != nil {
+		todo.tags = db.tagIds(data, input.Tags)
+	}
+
+	if *input.Completed && input.CompleteChildren {
+		for _, child := range data.descendants([]int{todo.id}, isLive) {
+			child.completed = true
+			child.updatedAt = now
+		}
+	}
+
+	res := data.todoModel(todo)
+	return &res, nil
+}
+
+func isLive(todo *memoryTodo) bool {
+	return todo.deletedAt == nil
+}
+
+func (db *memoryDB) List(ctx context.Context, start int, count int, filter *models.TodoFilter, userId int) (*models.TodoList, error) {
+	if err := db.rlock(ctx); err != nil {
+		return nil, err
+	}
+	defer db.runlock()
+
+	res := &models.TodoList{
+		List: []models.Todo{},
+	}
+	user, ok := db.users[userId]
+	if !ok {
+		return res, nil
+	}
+	data := user.data
+
+	now := memoryNow()
+	matching := []*memoryTodo{}
+	for _, todo := range data.todos {
+		if todo.deletedAt != nil || !data.matches(todo, filter, now) {
+			continue
+		}
+		matching = append(matching, todo)
+
+		res.Count++
+		if todo.completed {
+			res.CompletedCount++
+		} else if todo.due != nil && todo.due.Before(now) {
+			res.OverdueCount++
+		}
+	}
+
+	keyset := filter != nil && filter.Keyset
+	page, err := orderTodos(matching, filter)
+	if err != nil {
+		return nil, err
+	}
+	limit := count
+	if keyset {
+		// one more todo tells whether there is a next page
+		start, limit = 0, count+1
+	}
+	if start > len(page) {
+		start = len(page)
+	}
+	page = page[start:]
+	if len(page) > limit {
+		page = page[:limit]
+	}
+	for _, todo := range page {
+		res.List = append(res.List, data.todoModel(todo))
+	}
+
+	if keyset {
+		res.List, res.NextCursor, res.PrevCursor = keysetPage(res.List, count, filter)
+	}
+
+	if filter != nil && filter.View != "" {
+		ids := make([]int, 0, len(res.List))
+		for _, todo := range res.List {
+			ids = append(ids, *todo.Id)
+		}
+		descendants := data.descendants(ids, isLive)
+		sort.Slice(descendants, func(i, j int) bool {
+			return compareTodos(descendants[i], descendants[j], models.SortPosition) < 0
+		})
+		list := make([]models.Todo, 0, len(descendants))
+		for _, todo := range descendants {
+			list = append(list, data.todoModel(todo))
+		}
+		res.List = nestTodos(res.List, list, filter.View == models.ViewFlat)
+	}
+
+	return res, nil
+}
+
+// matches tells whether the todo passes the filter, like the conditions of todoFilterConditions
+func (data *memoryData) matches(todo *memoryTodo, filter *models.TodoFilter, now time.Time) bool {
+	if filter == nil {
+		return true
+	}
+
+	if filter.Overdue && (todo.due == nil || !todo.due.Before(now) || todo.completed) {
+		return false
+	}
+	if filter.DueFrom != nil && (todo.due == nil || todo.due.Before(*memoryTime(filter.DueFrom))) {
+		return false
+	}
+	if filter.DueTo != nil && (todo.due == nil || !todo.due.Before(*memoryTime(filter.DueTo))) {
+		return false
+	}
+	if filter.View != "" && todo.parentId != nil {
+		return false
+	}
+	if filter.Completed != nil && todo.completed != *filter.Completed {
+		return false
+	}
+	if filter.Query != "" && !strings.Contains(strings.ToLower(todo.text), strings.ToLower(filter.Query)) {
+		return false
+	}
+	if filter.Inbox {
+		if todo.listId != nil {
+			return false
+		}
+	} else if filter.ListId != nil && (todo.listId == nil || *todo.listId != *filter.ListId) {
+		return false
+	}
+	if len(filter.Tags) > 0 {
+		names := map[string]bool{}
+		for _, tagId := range todo.tags {
+			if name, ok := data.tags[tagId]; ok {
+				names[name] = true
+			}
+		}
+		tags := uniqueStrings(filter.Tags)
+		matched := 0
+		for _, tag := range tags {
+			if names[tag] {
+				matched++
+			}
+		}
+		if (filter.AllTags && matched != len(tags)) || matched == 0 {
+			return false
+		}
+	}
+
+	return true
+}
+
+// orderTodos sorts the todos like todoOrder and, when paging from a cursor, drops the todos
+// up to the cursor
+func orderTodos(todos []*memoryTodo, filter *models.TodoFilter) ([]*memoryTodo, error) {
+	sortField, desc := models.SortPosition, false
+	if filter != nil {
+		if filter.Sort != "" {
+			sortField = filter.Sort
+		}
+		desc = filter.Desc
+	}
+	if _, ok := todoSortColumns[sortField]; !ok {
+		return nil, fmt.Errorf("unknown sort field %q", sortField)
+	}
+
+	var cursor *models.Cursor
+	if filter != nil && filter.Keyset {
+		cursor = filter.Cursor
+	}
+	backward := cursor != nil && cursor.Before
+	descending := desc != backward
+
+	sort.Slice(todos, func(i, j int) bool {
+		if descending {
+			return compareTodos(todos[i], todos[j], sortField) > 0
+		}
+		return compareTodos(todos[i], todos[j], sortField) < 0
+	})
+	if cursor == nil {
+		return todos, nil
+	}
+
+	at, err := cursorTodo(cursor, sortField)
+	if err != nil {
+		return nil, err
+	}
+	res := []*memoryTodo{}
+	for _, todo := range todos {
+		order := compareTodos(todo, at, sortField)
+		if (descending && order < 0) || (!descending && order > 0) {
+			res = append(res, todo)
+		}
+	}
+	return res, nil
+}
+
+// compareTodos compares the sort keys of the todos, the id breaks ties
+func compareTodos(a, b *memoryTodo, sortField string) int {
+	order := 0
+	switch sortField {
+	case models.SortText:
+		order = strings.Compare(a.text, b.text)
+	case models.SortCreated:
+		order = compareTimes(a.createdAt, b.createdAt)
+	case models.SortUpdated:
+		order = compareTimes(a.updatedAt, b.updatedAt)
+	case models.SortCompleted:
+		if a.completed != b.completed {
+			order = 1
+			if b.completed {
+				order = -1
+			}
+		}
+	case models.SortPosition:
+		order = a.position - b.position
+	}
+	if order == 0 {
+		order = a.id - b.id
+	}
+	if order < 0 {
+		return -1
+	} else if order > 0 {
+		return 1
+	}
+	return 0
+}
+
+func compareTimes(a, b time.Time) int {
+	if a.Before(b) {
+		return -1
+	} else if a.After(b) {
+		return 1
+	}
+	return 0
+}
+
+// cursorTodo returns a todo with the sort key and the id of the cursor
+func cursorTodo(cursor *models.Cursor, sortField string) (*memoryTodo, error) {
+	res := &memoryTodo{id: cursor.Id}
+	var err error
+	switch sortField {
+	case models.SortText:
+		res.text = cursor.Value
+	case models.SortCreated:
+		res.createdAt, err = time.Parse(time.RFC3339Nano, cursor.Value)
+	case models.SortUpdated:
+		res.updatedAt, err = time.Parse(time.RFC3339Nano, cursor.Value)
+	case models.SortCompleted:
+		res.completed, err = strconv.ParseBool(cursor.Value)
+	case models.SortPosition:
+		res.position, err = strconv.Atoi(cursor.Value)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid cursor value %q", cursor.Value)
+	}
+	return res, nil
+}
+
+func (db *memoryDB) Add(ctx context.Context, input *models.AddTodoRequest, userId int) (*models.Todo, error) {
+	if err := db.lock(ctx); err != nil {
+		return nil, err
+	}
+	defer db.unlock()
+
+	user, err := db.user(userId)
+	if err != nil {
+		return nil, err
+	}
+	db.changeData(user)
+	return db.addTodo(user, input)
+}
+
+func (db *memoryDB) addTodo(user *memoryUser, input *models.AddTodoRequest) (*models.Todo, error) {
+	data := user.data
+	if input.ListId != nil {
+		if _, ok := data.lists[*input.ListId]; !ok {
+			return nil, errListNotFound
+		}
+	}
+	if input.ParentId != nil {
+		if _, err := data.liveTodo(*input.ParentId); err != nil {
+			return nil, err
+		}
+	}
+
+	// new todos go to the end of the manual order
+	position := 0
+	for _, todo := range data.todos {
+		if todo.position > position {
+			position = todo.position
+		}
+	}
+
+	db.lastTodoId++
+	now := memoryNow()
+	todo := &memoryTodo{
+		id:        db.lastTodoId,
+		text:      *input.Text,
+		completed: *input.Completed,
+		due:       memoryTime(input.Due),
+		listId:    copyInt(input.ListId),
+		parentId:  copyInt(input.ParentId),
+		position:  position + positionGap,
+		createdAt: now,
+		updatedAt: now,
+	}
+	if len(input.Tags) > 0 {
+		todo.tags = db.tagIds(data, input.Tags)
+	}
+	data.todos[todo.id] = todo
+
+	res := data.todoModel(todo)
+	return &res, nil
+}
+
+func (db *memoryDB) Delete(ctx context.Context, id int, userId int) error {
+	if err := db.lock(ctx); err != nil {
+		return err
+	}
+	defer db.unlock()
+
+	user, ok := db.users[userId]
+	if !ok {
+		return errTodoNotFound
+	}
+	db.changeData(user)
+	return deleteMemoryTodo(user.data, id)
+}
+
+// deleteMemoryTodo moves the todo with its subtasks to the trash
+func deleteMemoryTodo(data *memoryData, id int) error {
+	if _, err := data.liveTodo(id); err != nil {
+		return err
+	}
+	data.trash([]int{id}, memoryNow())
+	return nil
+}
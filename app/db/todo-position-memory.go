@@ -0,0 +1,95 @@
+package db
+
+import (
+	"context"
+	"sort"
+
+	"github.com/ann-96/todo-go-backend/app/models"
+)
+
+func (db *memoryDB) ReorderTodo(ctx context.Context, input *models.ReorderTodoRequest, userId int) (*models.Todo, error) {
+	if err := db.lock(ctx); err != nil {
+		return nil, err
+	}
+	defer db.unlock()
+
+	user, ok := db.users[userId]
+	if !ok {
+		return nil, errTodoNotFound
+	}
+	db.changeData(user)
+	data := user.data
+	todo, err := data.liveTodo(*input.Id)
+	if err != nil {
+		return nil, err
+	}
+
+	position, ok, err := data.positionNextTo(input)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		data.rebalancePositions()
+		if position, _, err = data.positionNextTo(input); err != nil {
+			return nil, err
+		}
+	}
+	todo.position = position
+	todo.updatedAt = memoryNow()
+
+	res := data.todoModel(todo)
+	return &res, nil
+}
+
+// positionNextTo returns the middle of the gap before or after the anchor todo,
+// ok is false when the gap is too small and the positions need a rebalance
+func (data *memoryData) positionNextTo(input *models.ReorderTodoRequest) (int, bool, error) {
+	anchorId, before, step := input.After, false, positionGap
+	if input.Before != nil {
+		anchorId, before, step = input.Before, true, -positionGap
+	}
+
+	anchor, err := data.liveTodo(*anchorId)
+	if err != nil {
+		return 0, false, err
+	}
+
+	var neighbour *memoryTodo
+	for _, todo := range data.todos {
+		if todo.id == *input.Id || todo.deletedAt != nil {
+			continue
+		}
+		if before && todo.position < anchor.position && (neighbour == nil || todo.position > neighbour.position) {
+			neighbour = todo
+		}
+		if !before && todo.position > anchor.position && (neighbour == nil || todo.position < neighbour.position) {
+			neighbour = todo
+		}
+	}
+	if neighbour == nil {
+		return anchor.position + step, true, nil
+	}
+
+	gap := neighbour.position - anchor.position
+	if gap < 0 {
+		gap = -gap
+	}
+	if gap < 2 {
+		return 0, false, nil
+	}
+	return anchor.position + (neighbour.position-anchor.position)/2, true, nil
+}
+
+// rebalancePositions spreads the todos of the user evenly, keeping their order
+func (data *memoryData) rebalancePositions() {
+	todos := make([]*memoryTodo, 0, len(data.todos))
+	for _, todo := range data.todos {
+		todos = append(todos, todo)
+	}
+	sort.Slice(todos, func(i, j int) bool {
+		return compareTodos(todos[i], todos[j], models.SortPosition) < 0
+	})
+	for i, todo := range todos {
+		todo.position = (i + 1) * positionGap
+	}
+}
@@ -0,0 +1,58 @@
+package db
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/ann-96/todo-go-backend/app/models"
+)
+
+func (db *sqliteDB) ReorderTodo(ctx context.Context, input *models.ReorderTodoRequest, userId int) (*models.Todo, error) {
+	// the immediate transaction already keeps concurrent moves apart
+	tx, err := db.sql.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	if err := checkTodoOwner(ctx, tx, *input.Id, userId); err != nil {
+		return nil, err
+	}
+
+	position, ok, err := positionNextTo(ctx, tx, input, userId)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		if err := sqliteRebalancePositions(ctx, tx, userId); err != nil {
+			return nil, err
+		}
+		if position, _, err = positionNextTo(ctx, tx, input, userId); err != nil {
+			return nil, err
+		}
+	}
+
+	if _, err := tx.ExecContext(ctx, "UPDATE todos SET position=$1, updated_at=$2 WHERE id=$3;", position, sqliteNow(), input.Id); err != nil {
+		return nil, err
+	}
+
+	res, err := sqliteSelectTodo(ctx, tx, *input.Id)
+	if err != nil {
+		return nil, err
+	}
+
+	return res, tx.Commit()
+}
+
+// sqliteRebalancePositions spreads the todos of the user evenly, keeping their order
+func sqliteRebalancePositions(ctx context.Context, tx *sqlTx, userId int) error {
+	rebalanceStmt := fmt.Sprintf(`
+		UPDATE todos SET position = ranked.rank * %d
+		FROM (
+			SELECT id, row_number() OVER (ORDER BY position, id) AS rank
+			FROM todos WHERE userid=$1
+		) ranked
+		WHERE todos.id = ranked.id;`, positionGap)
+	_, err := tx.ExecContext(ctx, rebalanceStmt, userId)
+	return err
+}
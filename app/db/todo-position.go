@@ -0,0 +1,107 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/ann-96/todo-go-backend/app/models"
+)
+
+// positionGap is the distance between neighbouring todos after a rebalance,
+// a todo can be moved between two neighbours as long as their gap is at least 2
+const positionGap = 1024
+
+func (db *postgresDB) ReorderTodo(ctx context.Context, input *models.ReorderTodoRequest, userId int) (*models.Todo, error) {
+	tx, err := db.sql.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	// concurrent moves of the same user could both take the last free position in a gap
+	if _, err := tx.ExecContext(ctx, "SELECT id FROM users WHERE id=$1 FOR UPDATE;", userId); err != nil {
+		return nil, err
+	}
+	if err := checkTodoOwner(ctx, tx, *input.Id, userId); err != nil {
+		return nil, err
+	}
+
+	position, ok, err := positionNextTo(ctx, tx, input, userId)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		if err := rebalancePositions(ctx, tx, userId); err != nil {
+			return nil, err
+		}
+		if position, _, err = positionNextTo(ctx, tx, input, userId); err != nil {
+			return nil, err
+		}
+	}
+
+	if _, err := tx.ExecContext(ctx, "UPDATE todos SET position=$1, updated_at=now() WHERE id=$2;", position, input.Id); err != nil {
+		return nil, err
+	}
+
+	res, err := selectTodo(ctx, tx, *input.Id)
+	if err != nil {
+		return nil, err
+	}
+
+	return res, tx.Commit()
+}
+
+// positionNextTo returns the middle of the gap before or after the anchor todo,
+// ok is false when the gap is too small and the positions need a rebalance
+func positionNextTo(ctx context.Context, tx *sqlTx, input *models.ReorderTodoRequest, userId int) (int, bool, error) {
+	anchorId, operator, order, step := input.After, ">", "ASC", positionGap
+	if input.Before != nil {
+		anchorId, operator, order, step = input.Before, "<", "DESC", -positionGap
+	}
+
+	row := tx.QueryRowContext(ctx, "SELECT position FROM todos WHERE id=$1 AND userid=$2 AND deleted_at IS NULL;", anchorId, userId)
+	var anchor int
+	if err := row.Scan(&anchor); err != nil {
+		if err == sql.ErrNoRows {
+			err = fmt.Errorf("entry not found for the user")
+		}
+		return 0, false, err
+	}
+
+	neighbourStmt := fmt.Sprintf(`
+		SELECT position FROM todos
+		WHERE userid=$1 AND id<>$2 AND deleted_at IS NULL AND position %s $3
+		ORDER BY position %s
+		LIMIT 1;`, operator, order)
+	row = tx.QueryRowContext(ctx, neighbourStmt, userId, input.Id, anchor)
+	var neighbour int
+	if err := row.Scan(&neighbour); err != nil {
+		if err == sql.ErrNoRows {
+			return anchor + step, true, nil
+		}
+		return 0, false, err
+	}
+
+	gap := neighbour - anchor
+	if gap < 0 {
+		gap = -gap
+	}
+	if gap < 2 {
+		return 0, false, nil
+	}
+	return anchor + (neighbour-anchor)/2, true, nil
+}
+
+// rebalancePositions spreads the todos of the user evenly, keeping their order
+func rebalancePositions(ctx context.Context, tx *sqlTx, userId int) error {
+	rebalanceStmt := fmt.Sprintf(`
+		UPDATE todos SET position = ranked.rank * %d
+		FROM (
+			SELECT id, row_number() OVER (ORDER BY position, id) AS rank
+			FROM todos WHERE userid=$1
+		) ranked
+		WHERE todos.id = ranked.id;`, positionGap)
+	_, err := tx.ExecContext(ctx, rebalanceStmt, userId)
+	return err
+}
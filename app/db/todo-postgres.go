@@ -1,186 +1,563 @@
 package db
 
 import (
-	"crypto/md5"
+	"context"
 	"database/sql"
-	"encoding/hex"
+	"errors"
 	"fmt"
+	"net/url"
+	"strings"
+	"time"
 
-	_ "github.com/lib/pq"
+	"github.com/lib/pq"
 
 	"github.com/ann-96/todo-go-backend/app/models"
-	"github.com/golang-migrate/migrate/v4"
+	"github.com/ann-96/todo-go-backend/app/tools"
+	"github.com/golang-migrate/migrate/v4/database"
 	"github.com/golang-migrate/migrate/v4/database/postgres"
-	_ "github.com/golang-migrate/migrate/v4/source/file"
 )
 
 type Settings struct {
+	// Driver is one of the Driver constants, postgres when empty
+	Driver string
+
 	IP       string
 	Port     string
 	User     string
 	Password string
 	Name     string
+	// DSN is a postgres connection string or URL used instead of the fields above
+	DSN string
+	// SSLMode is the sslmode of the postgres connections, the DSN decides when it is empty and
+	// disable without a DSN; SSLRootCert is the CA file checking the server, SSLCert and SSLKey
+	// the client certificate files
+	SSLMode     string
+	SSLRootCert string
+	SSLCert     string
+	SSLKey      string
+
+	// the limits of the connection pool, zero keeps the database/sql defaults
+	MaxOpenConns    int
+	MaxIdleConns    int
+	ConnMaxLifetime time.Duration
+	ConnMaxIdleTime time.Duration
+	// ConnectRetries is how many more times the database is pinged at startup when it is
+	// unreachable, waiting ConnectBackoff at first and twice as long after each try
+	ConnectRetries int
+	ConnectBackoff time.Duration
+
+	// Path is the database file of the sqlite driver
+	Path string
 }
 
 type postgresDB struct {
-	sql *sql.DB
+	sqlMigrations
+
+	sql *sqlConn
 }
 
+// CreatePostgresDB opens the connection pool and fails unless the database answers
 func CreatePostgresDB(settings Settings) (*postgresDB, error) {
 	res := &postgresDB{}
-	psqlconn := fmt.Sprintf("host=%s port=%s user=%s password=%s dbname=%s sslmode=disable", settings.IP, settings.Port, settings.User, settings.Password, settings.Name)
+	psqlconn, err := settings.postgresDSN()
+	if err != nil {
+		return nil, err
+	}
 
 	db, err := sql.Open("postgres", psqlconn)
 	if err != nil {
 		return nil, err
 	}
+	configurePool(db, settings)
+	if err := connect(db, settings); err != nil {
+		db.Close()
+		return nil, err
+	}
 
-	res.sql = db
+	res.sql = newSQLConn(db)
+	res.sqlMigrations = sqlMigrations{dir: ".", name: "postgres", driver: func() (database.Driver, func(), error) {
+		// the driver gets a connection of its own, closing it leaves the pool open
+		conn, err := db.Conn(context.Background())
+		if err != nil {
+			return nil, nil, err
+		}
+		driver, err := postgres.WithConnection(context.Background(), conn, &postgres.Config{})
+		if err != nil {
+			conn.Close()
+			return nil, nil, err
+		}
+		return driver, func() { driver.Close() }, nil
+	}}
 	return res, nil
 }
 
-func (db *postgresDB) Migrate() error {
-	driver, err := postgres.WithInstance(db.sql, &postgres.Config{})
-	if err != nil {
-		return err
+// postgresDSN returns the DSN of the settings or builds one from their fields, the TLS
+// settings override the ones of the DSN
+func (settings Settings) postgresDSN() (string, error) {
+	params := [][2]string{
+		{"sslmode", settings.SSLMode},
+		{"sslrootcert", settings.SSLRootCert},
+		{"sslcert", settings.SSLCert},
+		{"sslkey", settings.SSLKey},
 	}
 
-	m, err := migrate.NewWithDatabaseInstance("file://./migrations", "postgres", driver)
+	if strings.HasPrefix(settings.DSN, "postgres://") || strings.HasPrefix(settings.DSN, "postgresql://") {
+		dsn, err := url.Parse(settings.DSN)
+		if err != nil {
+			return "", fmt.Errorf("invalid postgres URL: %w", err)
+		}
+		query := dsn.Query()
+		for _, param := range params {
+			if param[1] != "" {
+				query.Set(param[0], param[1])
+			}
+		}
+		dsn.RawQuery = query.Encode()
+		return dsn.String(), nil
+	}
+
+	dsn := settings.DSN
+	if dsn == "" {
+		dsn = fmt.Sprintf("host=%s port=%s user=%s password=%s dbname=%s",
+			quoteDSNValue(settings.IP), quoteDSNValue(settings.Port), quoteDSNValue(settings.User),
+			quoteDSNValue(settings.Password), quoteDSNValue(settings.Name))
+		if settings.SSLMode == "" {
+			params[0][1] = "disable"
+		}
+	}
+	// the later of repeated keys wins
+	for _, param := range params {
+		if param[1] != "" {
+			dsn += fmt.Sprintf(" %s=%s", param[0], quoteDSNValue(param[1]))
+		}
+	}
+	return dsn, nil
+}
+
+// quoteDSNValue quotes a value of a key=value DSN, so that it may be empty or hold spaces and quotes
+func quoteDSNValue(value string) string {
+	value = strings.ReplaceAll(value, `\`, `\\`)
+	return "'" + strings.ReplaceAll(value, "'", `\'`) + "'"
+}
+
+func (db *postgresDB) InTx(ctx context.Context, fn func(tx Tx) error) error {
+	return db.sql.inTx(ctx, func(conn *sqlConn) error {
+		return fn(&postgresDB{sql: conn, sqlMigrations: db.sqlMigrations})
+	})
+}
+
+func (db *postgresDB) Update(ctx context.Context, input *models.Todo, userId int) (*models.Todo, error) {
+	tx, err := db.sql.BeginTx(ctx, nil)
 	if err != nil {
-		return err
+		return nil, err
 	}
+	defer tx.Rollback()
 
-	err = m.Up()
-	if err != nil && err != migrate.ErrNoChange {
-		return err
+	res, err := updateTodo(ctx, tx, input, userId)
+	if err != nil {
+		return nil, err
 	}
 
-	return nil
+	return res, tx.Commit()
 }
 
-func (db *postgresDB) Update(input *models.Todo, userId int) (*models.Todo, error) {
-	updateStmt := "UPDATE todos SET task=$1, completed=$2 WHERE id=$3 AND userid=$4 RETURNING id;"
-	row := db.sql.QueryRow(updateStmt, input.Text, input.Completed, input.Id, userId)
+func updateTodo(ctx context.Context, tx *sqlTx, input *models.Todo, userId int) (*models.Todo, error) {
+	if input.ListId != nil {
+		if err := checkListOwner(ctx, tx, *input.ListId, userId); err != nil {
+			return nil, err
+		}
+	}
+
+	updateStmt := "UPDATE todos SET task=$1, completed=$2, due=$3, list_id=COALESCE($4, list_id), updated_at=now() WHERE id=$5 AND userid=$6 AND deleted_at IS NULL RETURNING id;"
+	row := tx.QueryRowContext(ctx, updateStmt, input.Text, input.Completed, input.Due, input.ListId, input.Id, userId)
 	var id int
 	if err := row.Scan(&id); err != nil {
+		if err == sql.ErrNoRows {
+			err = fmt.Errorf("entry not found for the user")
+		}
 		return nil, err
 	}
 
-	return input, nil
+	if input.Tags != nil {
+		if err := setTodoTags(ctx, tx, id, input.Tags, userId); err != nil {
+			return nil, err
+		}
+	}
+
+	if *input.Completed && input.CompleteChildren {
+		completeStmt := fmt.Sprintf("UPDATE todos SET completed=true, updated_at=now() WHERE id IN (%s);", descendantsQuery)
+		if _, err := tx.ExecContext(ctx, completeStmt, pq.Array([]int64{int64(id)}), userId); err != nil {
+			return nil, err
+		}
+	}
+
+	return selectTodo(ctx, tx, id)
 }
 
-func (db *postgresDB) List(start int, count int, userId int) (*models.TodoList, error) {
-	stm := `
-		SELECT id, task, completed FROM todos 
-		WHERE userid=$3
-		ORDER BY id ASC 
-		LIMIT $1 
-		OFFSET $2;
-		`
-	stmt, err := db.sql.Prepare(stm)
+func (db *postgresDB) List(ctx context.Context, start int, count int, filter *models.TodoFilter, userId int) (*models.TodoList, error) {
+	where, args := todoFilterConditions(filter, userId)
+
+	keyset := filter != nil && filter.Keyset
+	order, after, pageArgs, err := todoOrder(filter, args)
 	if err != nil {
 		return nil, err
 	}
-	rows, err := stmt.Query(count, start, userId)
+	pageWhere, limit := where, count
+	if after != "" {
+		pageWhere += " AND " + after
+	}
+	if keyset {
+		// one more row tells whether there is a next page
+		start, limit = 0, count+1
+	}
+
+	stm := fmt.Sprintf(`
+		SELECT %s FROM todos 
+		WHERE %s
+		ORDER BY %s 
+		LIMIT $%d 
+		OFFSET $%d;
+		`, todoColumns, pageWhere, order, len(pageArgs)+1, len(pageArgs)+2)
+	stmt, err := db.sql.PrepareContext(ctx, stm)
+	if err != nil {
+		return nil, err
+	}
+	defer stmt.Close()
+	rows, err := stmt.QueryContext(ctx, append(pageArgs, limit, start)...)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 
-	list := []models.Todo{}
+	res := &models.TodoList{
+		List: []models.Todo{},
+	}
 	for rows.Next() {
-		var id int
-		var text string
-		var completed bool
-		if err := rows.Scan(&id, &text, &completed); err != nil {
+		todo, err := scanTodo(rows)
+		if err != nil {
 			return nil, err
 		}
 
-		todo := models.Todo{
-			Id: &id,
-			AddTodoRequest: models.AddTodoRequest{
-				Text:      &text,
-				Completed: &completed,
-			},
-		}
+		res.List = append(res.List, *todo)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
 
-		list = append(list, todo)
+	if keyset {
+		res.List, res.NextCursor, res.PrevCursor = keysetPage(res.List, count, filter)
 	}
 
-	row := db.sql.QueryRow("SELECT COUNT(*) FROM todos WHERE userid=$1;", userId)
-	var totalCount int
-	if err := row.Scan(&totalCount); err != nil {
+	if filter != nil && filter.View != "" {
+		descendants, err := db.descendants(ctx, res.List, userId)
+		if err != nil {
+			return nil, err
+		}
+		res.List = nestTodos(res.List, descendants, filter.View == models.ViewFlat)
+	}
+
+	countStmt := fmt.Sprintf(`
+		SELECT
+			COUNT(*),
+			COUNT(*) FILTER (WHERE completed = true),
+			COUNT(*) FILTER (WHERE due < now() AND completed = false)
+		FROM todos
+		WHERE %s;
+		`, where)
+	row := db.sql.QueryRowContext(ctx, countStmt, args...)
+	if err := row.Scan(&res.Count, &res.CompletedCount, &res.OverdueCount); err != nil {
 		return nil, err
 	}
 
-	row = db.sql.QueryRow("SELECT COUNT(*) FROM todos WHERE completed = true AND userid=$1;", userId)
-	var completedCount int
-	if err := row.Scan(&completedCount); err != nil {
+	return res, nil
+}
+
+// todoFilterConditions builds a WHERE clause for the filter, values are always passed as arguments
+func todoFilterConditions(filter *models.TodoFilter, userId int) (string, []interface{}) {
+	conditions := []string{"userid=$1", "deleted_at IS NULL"}
+	args := []interface{}{userId}
+
+	if filter != nil {
+		if filter.Overdue {
+			conditions = append(conditions, "due < now()", "completed = false")
+		}
+		if filter.DueFrom != nil {
+			args = append(args, *filter.DueFrom)
+			conditions = append(conditions, fmt.Sprintf("due >= $%d", len(args)))
+		}
+		if filter.DueTo != nil {
+			args = append(args, *filter.DueTo)
+			conditions = append(conditions, fmt.Sprintf("due < $%d", len(args)))
+		}
+		if filter.View != "" {
+			conditions = append(conditions, "parent_id IS NULL")
+		}
+		if filter.Completed != nil {
+			args = append(args, *filter.Completed)
+			conditions = append(conditions, fmt.Sprintf("completed = $%d", len(args)))
+		}
+		if filter.Query != "" {
+			args = append(args, filter.Query)
+			conditions = append(conditions, fmt.Sprintf("strpos(lower(task), lower($%d)) > 0", len(args)))
+		}
+		if filter.Inbox {
+			conditions = append(conditions, "list_id IS NULL")
+		} else if filter.ListId != nil {
+			args = append(args, *filter.ListId)
+			conditions = append(conditions, fmt.Sprintf("list_id = $%d", len(args)))
+		}
+		if len(filter.Tags) > 0 {
+			tags := uniqueStrings(filter.Tags)
+			args = append(args, pq.Array(tags))
+			matching := fmt.Sprintf(`
+				SELECT %%s FROM todo_tags tt JOIN tags t ON t.id = tt.tagid
+				WHERE tt.todoid = todos.id AND t.name = ANY($%d)`, len(args))
+			if filter.AllTags {
+				args = append(args, len(tags))
+				conditions = append(conditions, fmt.Sprintf("(%s) = $%d", fmt.Sprintf(matching, "COUNT(*)"), len(args)))
+			} else {
+				conditions = append(conditions, fmt.Sprintf("EXISTS (%s)", fmt.Sprintf(matching, "1")))
+			}
+		}
+	}
+
+	return strings.Join(conditions, " AND "), args
+}
+
+// descendantsQuery selects the ids of every descendant of the todos in $1 outside of the trash
+var descendantsQuery = descendantsMatching("deleted_at IS NULL")
+
+// descendantsMatching selects the ids of the descendants of the todos in $1 reachable through
+// the todos matching the condition
+func descendantsMatching(condition string) string {
+	return fmt.Sprintf(`
+	WITH RECURSIVE descendants AS (
+		SELECT id FROM todos WHERE parent_id = ANY($1) AND userid=$2 AND %s
+		UNION ALL
+		SELECT t.id FROM todos t JOIN descendants d ON t.parent_id = d.id WHERE %s
+	)
+	SELECT id FROM descendants`, condition, condition)
+}
+
+func (db *postgresDB) descendants(ctx context.Context, parents []models.Todo, userId int) ([]models.Todo, error) {
+	ids := make([]int64, 0, len(parents))
+	for _, todo := range parents {
+		ids = append(ids, int64(*todo.Id))
+	}
+
+	query := fmt.Sprintf("SELECT %s FROM todos WHERE id IN (%s) ORDER BY position ASC, id ASC;", todoColumns, descendantsQuery)
+	rows, err := db.sql.QueryContext(ctx, query, pq.Array(ids), userId)
+	if err != nil {
 		return nil, err
 	}
+	defer rows.Close()
 
-	return &models.TodoList{
-		List:           list,
-		Count:          totalCount,
-		CompletedCount: completedCount,
-	}, nil
+	list := []models.Todo{}
+	for rows.Next() {
+		todo, err := scanTodo(rows)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, *todo)
+	}
+
+	return list, rows.Err()
 }
 
-func (db *postgresDB) Add(input *models.AddTodoRequest, userId int) (*models.Todo, error) {
-	stmnt, err := db.sql.Prepare("INSERT INTO todos(task, completed, userid) VALUES ($1, $2, $3) RETURNING id;")
+func (db *postgresDB) Add(ctx context.Context, input *models.AddTodoRequest, userId int) (*models.Todo, error) {
+	tx, err := db.sql.BeginTx(ctx, nil)
 	if err != nil {
 		return nil, err
 	}
+	defer tx.Rollback()
 
-	res := &models.Todo{
-		AddTodoRequest: *input,
+	res, err := addTodo(ctx, tx, input, userId)
+	if err != nil {
+		return nil, err
 	}
 
-	row := stmnt.QueryRow(input.Text, input.Completed, userId)
-	if err := row.Scan(&res.Id); err != nil {
+	return res, tx.Commit()
+}
+
+func addTodo(ctx context.Context, tx *sqlTx, input *models.AddTodoRequest, userId int) (*models.Todo, error) {
+	if input.ListId != nil {
+		if err := checkListOwner(ctx, tx, *input.ListId, userId); err != nil {
+			return nil, err
+		}
+	}
+	if input.ParentId != nil {
+		if err := checkTodoOwner(ctx, tx, *input.ParentId, userId); err != nil {
+			return nil, err
+		}
+	}
+
+	// new todos go to the end of the manual order
+	insertStmt := fmt.Sprintf(`
+		INSERT INTO todos(task, completed, due, list_id, parent_id, userid, position)
+		VALUES ($1, $2, $3, $4, $5, $6, (SELECT COALESCE(MAX(position), 0) + %d FROM todos WHERE userid=$6))
+		RETURNING id;`, positionGap)
+	row := tx.QueryRowContext(ctx, insertStmt, input.Text, input.Completed, input.Due, input.ListId, input.ParentId, userId)
+	var id int
+	if err := row.Scan(&id); err != nil {
 		return nil, err
 	}
 
-	return res, nil
+	if len(input.Tags) > 0 {
+		if err := setTodoTags(ctx, tx, id, input.Tags, userId); err != nil {
+			return nil, err
+		}
+	}
+
+	return selectTodo(ctx, tx, id)
 }
 
-func (db *postgresDB) Delete(id int, userId int) error {
-	updateStmt := "DELETE FROM todos WHERE id=$1 AND userid=$2;"
-	_, err := db.sql.Exec(updateStmt, id, userId)
+// todoColumns are the columns read by scanTodo
+const todoColumns = "id, task, completed, due, list_id, parent_id, position, created_at, updated_at, " + todoTagsColumn
+
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// scanTodo reads todoColumns followed by the extra columns
+func scanTodo(row rowScanner, extra ...interface{}) (*models.Todo, error) {
+	var id int
+	var text string
+	var completed bool
+	var due sql.NullTime
+	var listId sql.NullInt64
+	var parentId sql.NullInt64
+	var position int
+	var createdAt, updatedAt time.Time
+	var tags []string
+	dest := []interface{}{&id, &text, &completed, &due, &listId, &parentId, &position, &createdAt, &updatedAt, pq.Array(&tags)}
+	if err := row.Scan(append(dest, extra...)...); err != nil {
+		return nil, err
+	}
+
+	todo := &models.Todo{
+		Id:        &id,
+		Position:  &position,
+		CreatedAt: &createdAt,
+		UpdatedAt: &updatedAt,
+		AddTodoRequest: models.AddTodoRequest{
+			Text:      &text,
+			Completed: &completed,
+			Tags:      tags,
+		},
+	}
+	if due.Valid {
+		todo.Due = &due.Time
+	}
+	if listId.Valid {
+		list := int(listId.Int64)
+		todo.ListId = &list
+	}
+	if parentId.Valid {
+		parent := int(parentId.Int64)
+		todo.ParentId = &parent
+	}
+
+	return todo, nil
+}
+
+func checkTodoOwner(ctx context.Context, tx *sqlTx, todoId int, userId int) error {
+	row := tx.QueryRowContext(ctx, "SELECT id FROM todos WHERE id=$1 AND userid=$2 AND deleted_at IS NULL;", todoId, userId)
+	var id int
+	if err := row.Scan(&id); err != nil {
+		if err == sql.ErrNoRows {
+			err = fmt.Errorf("entry not found for the user")
+		}
+		return err
+	}
+	return nil
+}
+
+func selectTodo(ctx context.Context, tx *sqlTx, id int) (*models.Todo, error) {
+	return scanTodo(tx.QueryRowContext(ctx, fmt.Sprintf("SELECT %s FROM todos WHERE id=$1;", todoColumns), id))
+}
+
+func (db *postgresDB) Delete(ctx context.Context, id int, userId int) error {
+	tx, err := db.sql.BeginTx(ctx, nil)
 	if err != nil {
 		return err
 	}
+	defer tx.Rollback()
 
-	return nil
+	if err := deleteTodo(ctx, tx, id, userId); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// deleteTodo moves the todo with its subtasks to the trash
+func deleteTodo(ctx context.Context, tx *sqlTx, id int, userId int) error {
+	if err := checkTodoOwner(ctx, tx, id, userId); err != nil {
+		return err
+	}
+
+	_, err := trashTodos(ctx, tx, []int64{int64(id)}, userId)
+	return err
 }
 
-func (db *postgresDB) Register(input *models.RegisterRequest) error {
+func (db *postgresDB) Register(ctx context.Context, input *models.RegisterRequest) (int, error) {
+	hash, err := tools.HashPassword(*input.Password)
+	if err != nil {
+		return 0, err
+	}
+
 	query := "INSERT INTO users(login, passwordhash) values($1, $2) RETURNING id;"
-	row := db.sql.QueryRow(query, input.Login, db.hash(*input.Password))
+	row := db.sql.QueryRowContext(ctx, query, input.Login, hash)
 	var id int
 	if err := row.Scan(&id); err != nil {
-		return err
+		if isUniqueViolation(err, "users_login_key") {
+			err = ErrUserExists
+		}
+		return 0, err
 	}
 
-	return nil
+	return id, nil
 }
 
-func (db *postgresDB) Login(input *models.LoginRequest) (*int, error) {
-	query := "SELECT id FROM users WHERE login=$1 AND passwordhash=$2;"
-	row := db.sql.QueryRow(query, input.Login, db.hash(*input.Password))
+// isUniqueViolation tells whether err is a violation of the unique constraint
+func isUniqueViolation(err error, constraint string) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == "23505" && pqErr.Constraint == constraint
+}
+
+// dummyPasswordHash is verified for unknown logins so that they take as long as known ones
+const dummyPasswordHash = "$argon2id$v=19$m=65536,t=3,p=2$PwGJN0nCkzQPHXLlvIgnEw$m/7zuHtn8KkJgo+b6DB31PaPAtyzkvrkRbp8/dZQzkY"
+
+func (db *postgresDB) Login(ctx context.Context, input *models.LoginRequest) (*int, error) {
+	query := "SELECT id, passwordhash FROM users WHERE login=$1;"
+	row := db.sql.QueryRowContext(ctx, query, input.Login)
 	var id int
-	if err := row.Scan(&id); err != nil {
-		if err == sql.ErrNoRows {
-			err = fmt.Errorf("user or password is invalid")
+	var hash string
+	if err := row.Scan(&id, &hash); err != nil {
+		if err != sql.ErrNoRows {
+			return nil, err
 		}
+		hash = dummyPasswordHash
+	}
+
+	ok, rehash, err := tools.VerifyPassword(*input.Password, hash)
+	if err != nil {
 		return nil, err
 	}
+	if !ok || hash == dummyPasswordHash {
+		return nil, fmt.Errorf("user or password is invalid")
+	}
 
-	return &id, nil
-}
+	// legacy and outdated hashes are replaced while the password is at hand
+	if rehash {
+		newHash, err := tools.HashPassword(*input.Password)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := db.sql.ExecContext(ctx, "UPDATE users SET passwordhash=$1 WHERE id=$2 AND passwordhash=$3;", newHash, id, hash); err != nil {
+			return nil, err
+		}
+	}
 
-func (db *postgresDB) hash(in string) string {
-	input := fmt.Sprintf("salt_%s_salt", in)
-	res := md5.Sum([]byte(input))
-	return hex.EncodeToString(res[:])
+	return &id, nil
 }
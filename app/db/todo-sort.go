@@ -0,0 +1,65 @@
+package db
+
+import (
+	"fmt"
+
+	"github.com/ann-96/todo-go-backend/app/models"
+)
+
+type sortColumn struct {
+	column string
+	cast   string
+}
+
+// todoSortColumns is the allow-list of sort fields, nothing else ends up in an ORDER BY
+var todoSortColumns = map[string]sortColumn{
+	models.SortId:        {column: "id", cast: "integer"},
+	models.SortText:      {column: "task", cast: "text"},
+	models.SortCreated:   {column: "created_at", cast: "timestamptz"},
+	models.SortUpdated:   {column: "updated_at", cast: "timestamptz"},
+	models.SortCompleted: {column: "completed", cast: "boolean"},
+	models.SortPosition:  {column: "position", cast: "bigint"},
+}
+
+// todoOrder returns the ORDER BY clause of the filter and, when paging from a cursor, the
+// condition selecting the todos past it, the id is the tie breaker for equal sort keys
+func todoOrder(filter *models.TodoFilter, args []interface{}) (string, string, []interface{}, error) {
+	sort, desc := models.SortPosition, false
+	if filter != nil {
+		if filter.Sort != "" {
+			sort = filter.Sort
+		}
+		desc = filter.Desc
+	}
+	column, ok := todoSortColumns[sort]
+	if !ok {
+		return "", "", nil, fmt.Errorf("unknown sort field %q", sort)
+	}
+
+	var cursor *models.Cursor
+	if filter != nil && filter.Keyset {
+		cursor = filter.Cursor
+	}
+	backward := cursor != nil && cursor.Before
+
+	direction := "ASC"
+	if desc != backward {
+		direction = "DESC"
+	}
+	order := fmt.Sprintf("%s %s, id %s", column.column, direction, direction)
+	if column.column == "id" {
+		order = fmt.Sprintf("id %s", direction)
+	}
+	if cursor == nil {
+		return order, "", args, nil
+	}
+
+	operator := ">"
+	if direction == "DESC" {
+		operator = "<"
+	}
+	args = append(append([]interface{}{}, args...), cursor.Value, cursor.Id)
+	condition := fmt.Sprintf("(%s, id) %s ($%d::%s, $%d)", column.column, operator, len(args)-1, column.cast, len(args))
+
+	return order, condition, args, nil
+}
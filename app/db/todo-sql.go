@@ -1,15 +1,136 @@
 package db
 
-import "github.com/ann-96/todo-go-backend/app/models"
+import (
+	"context"
+	"errors"
+	"time"
 
-type TodoSqlDB interface {
-	Update(input *models.Todo, userId int) (*models.Todo, error)
-	List(start int, count int, userId int) (*models.TodoList, error)
-	Add(input *models.AddTodoRequest, userId int) (*models.Todo, error)
-	Delete(id int, userId int) error
+	"github.com/ann-96/todo-go-backend/app/models"
+)
 
-	Register(input *models.RegisterRequest) error
-	Login(input *models.LoginRequest) (*int, error)
+var (
+	// ErrUserExists is returned by Register when the login is taken
+	ErrUserExists = errors.New("the user already exists")
+	// ErrTagExists is returned when the user already has a tag with the name
+	ErrTagExists = errors.New("the tag already exists")
+)
 
-	Migrate() error
+// Transactor runs a unit of work in one transaction
+type Transactor interface {
+	// InTx runs fn with the stores bound to a transaction that is committed when fn returns nil
+	// and rolled back otherwise, the writes of the stores nest into it
+	InTx(ctx context.Context, fn func(tx Tx) error) error
+}
+
+// TodoStore keeps the todos of the users with their tags and lists
+type TodoStore interface {
+	Transactor
+
+	Update(ctx context.Context, input *models.Todo, userId int) (*models.Todo, error)
+	List(ctx context.Context, start int, count int, filter *models.TodoFilter, userId int) (*models.TodoList, error)
+	Add(ctx context.Context, input *models.AddTodoRequest, userId int) (*models.Todo, error)
+	// Delete moves the todo with its subtasks to the trash
+	Delete(ctx context.Context, id int, userId int) error
+	// Search ranks the todos matching every term, a term matches words starting with it
+	Search(ctx context.Context, terms []string, count int, userId int) (*models.SearchResult, error)
+	// Batch runs the operations and the action in one transaction
+	Batch(ctx context.Context, input *models.Batch, userId int) (*models.BatchResult, error)
+	// ReorderTodo moves the todo right before or right after another one in the manual order
+	ReorderTodo(ctx context.Context, input *models.ReorderTodoRequest, userId int) (*models.Todo, error)
+
+	ListTrash(ctx context.Context, start int, count int, userId int) (*models.TodoList, error)
+	// RestoreTodo takes the todo out of the trash together with the subtasks trashed along
+	RestoreTodo(ctx context.Context, id int, userId int) (*models.Todo, error)
+	EmptyTrash(ctx context.Context, userId int) (int, error)
+	// PurgeTrash permanently deletes the todos of every user trashed before the given time
+	PurgeTrash(ctx context.Context, before time.Time) (int, error)
+
+	AddTag(ctx context.Context, input *models.AddTagRequest, userId int) (*models.Tag, error)
+	UpdateTag(ctx context.Context, input *models.Tag, userId int) (*models.Tag, error)
+	ListTags(ctx context.Context, userId int) ([]models.Tag, error)
+	DeleteTag(ctx context.Context, id int, userId int) error
+
+	AddList(ctx context.Context, input *models.AddListRequest, userId int) (*models.List, error)
+	UpdateList(ctx context.Context, input *models.List, userId int) (*models.List, error)
+	ListLists(ctx context.Context, userId int) ([]models.List, error)
+	DeleteList(ctx context.Context, input *models.DeleteListRequest, userId int) error
+	MoveTodo(ctx context.Context, input *models.MoveTodoRequest, userId int) (*models.Todo, error)
+
+	// ExportTodos calls fn with every todo of the user in id order, the trashed ones included
+	ExportTodos(ctx context.Context, userId int, fn func(todo *models.Todo) error) error
+}
+
+// UserStore keeps the users with their credentials, sessions and profiles
+type UserStore interface {
+	Transactor
+
+	// Register adds the user and returns their id
+	Register(ctx context.Context, input *models.RegisterRequest) (int, error)
+	Login(ctx context.Context, input *models.LoginRequest) (*int, error)
+
+	// CreateRefreshToken stores the hash of a refresh token starting a new token family
+	CreateRefreshToken(ctx context.Context, userId int, tokenHash string, expiresAt time.Time) error
+	// RotateRefreshToken replaces a refresh token with a new one of the same family and returns
+	// its user, presenting a spent token again revokes the whole family
+	RotateRefreshToken(ctx context.Context, oldHash string, newHash string, expiresAt time.Time) (int, error)
+	// RevokeRefreshToken revokes the family of the refresh token
+	RevokeRefreshToken(ctx context.Context, tokenHash string) error
+	PruneRefreshTokens(ctx context.Context, before time.Time) (int, error)
+
+	// ChangePassword replaces the password after checking the old one, ending every session and
+	// personal access token and revoking the tokens issued so far, they expire before tokensExpireAt
+	ChangePassword(ctx context.Context, userId int, oldPassword string, newPassword string, tokensExpireAt time.Time) error
+	// CreatePasswordReset stores a reset token for the user with the login, if there is one
+	CreatePasswordReset(ctx context.Context, login string, tokenHash string, expiresAt time.Time) (bool, error)
+	// ResetPassword redeems the reset token, spending every other reset token of the user, and
+	// ends their sessions and tokens like ChangePassword
+	ResetPassword(ctx context.Context, tokenHash string, newPassword string, tokensExpireAt time.Time) error
+
+	// VerifyPassword returns ErrWrongPassword unless the password is the one of the user
+	VerifyPassword(ctx context.Context, userId int, password string) error
+
+	// StartTOTPEnrollment stores a pending TOTP secret until ConfirmTOTPEnrollment enables it
+	// and returns the login of the user
+	StartTOTPEnrollment(ctx context.Context, userId int, secret string) (string, error)
+	ConfirmTOTPEnrollment(ctx context.Context, userId int, code string, recoveryCodeHashes []string) error
+	TwoFactorEnabled(ctx context.Context, userId int) (bool, error)
+	// VerifySecondFactor accepts each TOTP code and recovery code once
+	VerifySecondFactor(ctx context.Context, userId int, code string) error
+	DisableTwoFactor(ctx context.Context, userId int) error
+	ReplaceRecoveryCodes(ctx context.Context, userId int, recoveryCodeHashes []string) error
+
+	// CreateAccessToken stores the hash of a personal access token
+	CreateAccessToken(ctx context.Context, input *models.CreateAccessTokenRequest, tokenHash string, userId int) (*models.AccessToken, error)
+	ListAccessTokens(ctx context.Context, userId int) ([]models.AccessToken, error)
+	RevokeAccessToken(ctx context.Context, id int, userId int) error
+	// UseAccessToken returns the user and the scope of an unexpired personal access token
+	// and records that it was used
+	UseAccessToken(ctx context.Context, tokenHash string) (int, string, error)
+
+	UserProfile(ctx context.Context, userId int) (*models.UserProfile, error)
+	UpdateProfile(ctx context.Context, input *models.UpdateProfileRequest, userId int) (*models.UserProfile, error)
+	// UserTimeZone returns the time zone of the user, empty when the user has none
+	UserTimeZone(ctx context.Context, userId int) (string, error)
+	// RecordLogin sets the last login time of the user to now
+	RecordLogin(ctx context.Context, userId int) error
+	// DeleteUser removes the user with all their data after checking the password and
+	// revokes their tokens expiring before tokensExpireAt
+	DeleteUser(ctx context.Context, userId int, password string, tokensExpireAt time.Time) error
+
+	TokenRevocationList
+	AttemptLimiter
+}
+
+// Tx is what the unit of work of InTx runs on
+type Tx interface {
+	TodoStore
+	UserStore
+}
+
+// Store is a TodoStore and a UserStore sharing one connection pool
+type Store interface {
+	Tx
+	Migrator
+	// Close releases the connections of the store
+	Close() error
 }
@@ -0,0 +1,598 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/golang-migrate/migrate/v4/database"
+	migratesqlite "github.com/golang-migrate/migrate/v4/database/sqlite"
+	"modernc.org/sqlite"
+	sqlite3 "modernc.org/sqlite/lib"
+
+	"github.com/ann-96/todo-go-backend/app/models"
+	"github.com/ann-96/todo-go-backend/app/tools"
+)
+
+func init() {
+	// the lower of sqlite only folds ASCII letters
+	sqlite.MustRegisterDeterministicScalarFunction("unicode_lower", 1, func(ctx *sqlite.FunctionContext, args []driver.Value) (driver.Value, error) {
+		if text, ok := args[0].(string); ok {
+			return strings.ToLower(text), nil
+		}
+		return args[0], nil
+	})
+}
+
+type sqliteDB struct {
+	sqlMigrations
+
+	sql *sqlConn
+}
+
+// CreateSQLiteDB opens the database file in settings.Path, ":memory:" keeps the database
+// in a single connection
+func CreateSQLiteDB(settings Settings) (*sqliteDB, error) {
+	if settings.Path == "" {
+		return nil, fmt.Errorf("the sqlite driver needs a database path")
+	}
+	res := &sqliteDB{}
+
+	// writes take the database lock when their transaction starts rather than failing
+	// on their first statement
+	dsn := "file:" + settings.Path + "?_pragma=foreign_keys(1)&_pragma=busy_timeout(5000)&_txlock=immediate"
+	if settings.Path != ":memory:" {
+		dsn += "&_pragma=journal_mode(WAL)"
+	}
+	db, err := sql.Open("sqlite", dsn)
+	if err != nil {
+		return nil, err
+	}
+	// the database in memory lives as long as its only connection, so the pool limits are left out
+	if settings.Path == ":memory:" {
+		db.SetMaxOpenConns(1)
+	} else {
+		configurePool(db, settings)
+	}
+	if err := connect(db, settings); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	res.sql = newSQLConn(db)
+	res.sqlMigrations = sqlMigrations{dir: "sqlite", name: "sqlite", driver: func() (database.Driver, func(), error) {
+		// the driver works on the pool, closing it would close the pool
+		driver, err := migratesqlite.WithInstance(db, &migratesqlite.Config{})
+		return driver, func() {}, err
+	}}
+	return res, nil
+}
+
+func (db *sqliteDB) InTx(ctx context.Context, fn func(tx Tx) error) error {
+	return db.sql.inTx(ctx, func(conn *sqlConn) error {
+		return fn(&sqliteDB{sql: conn, sqlMigrations: db.sqlMigrations})
+	})
+}
+
+// sqliteNow is the current time as the sqlite store keeps times, in unix microseconds
+func sqliteNow() int64 {
+	return time.Now().UnixMicro()
+}
+
+// sqliteMicros converts an optional time for a query
+func sqliteMicros(t *time.Time) interface{} {
+	if t == nil {
+		return nil
+	}
+	return t.UnixMicro()
+}
+
+// sqliteTime scans a time kept in unix microseconds
+type sqliteTime struct {
+	Time  time.Time
+	Valid bool
+}
+
+func (t *sqliteTime) Scan(value interface{}) error {
+	switch v := value.(type) {
+	case nil:
+		*t = sqliteTime{}
+	case int64:
+		*t = sqliteTime{Time: time.UnixMicro(v), Valid: true}
+	default:
+		return fmt.Errorf("cannot scan %T into a time", value)
+	}
+	return nil
+}
+
+func (t sqliteTime) ptr() *time.Time {
+	if !t.Valid {
+		return nil
+	}
+	return &t.Time
+}
+
+// sqliteIds passes a list of ids to a query, it is read with json_each
+func sqliteIds(ids []int) string {
+	res, _ := json.Marshal(ids)
+	return string(res)
+}
+
+// sqliteStrings passes a list of strings to a query, it is read with json_each
+func sqliteStrings(in []string) string {
+	res, _ := json.Marshal(in)
+	return string(res)
+}
+
+// isSQLiteUniqueViolation tells whether err violates the unique constraint on the columns,
+// named like "users.login"
+func isSQLiteUniqueViolation(err error, columns string) bool {
+	var sqliteErr *sqlite.Error
+	return errors.As(err, &sqliteErr) && sqliteErr.Code() == sqlite3.SQLITE_CONSTRAINT_UNIQUE &&
+		strings.Contains(sqliteErr.Error(), columns)
+}
+
+func (db *sqliteDB) Update(ctx context.Context, input *models.Todo, userId int) (*models.Todo, error) {
+	tx, err := db.sql.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	res, err := sqliteUpdateTodo(ctx, tx, input, userId)
+	if err != nil {
+		return nil, err
+	}
+
+	return res, tx.Commit()
+}
+
+func sqliteUpdateTodo(ctx context.Context, tx *sqlTx, input *models.Todo, userId int) (*models.Todo, error) {
+	if input.ListId != nil {
+		if err := checkListOwner(ctx, tx, *input.ListId, userId); err != nil {
+			return nil, err
+		}
+	}
+
+	now := sqliteNow()
+	updateStmt := "UPDATE todos SET task=$1, completed=$2, due=$3, list_id=COALESCE($4, list_id), updated_at=$5 WHERE id=$6 AND userid=$7 AND deleted_at IS NULL RETURNING id;"
+	row := tx.QueryRowContext(ctx, updateStmt, input.Text, input.Completed, sqliteMicros(input.Due), input.ListId, now, input.Id, userId)
+	var id int
+	if err := row.Scan(&id); err != nil {
+		if err == sql.ErrNoRows {
+			err = errTodoNotFound
+		}
+		return nil, err
+	}
+
+	if input.Tags != nil {
+		if err := sqliteSetTodoTags(ctx, tx, id, input.Tags, userId); err != nil {
+			return nil, err
+		}
+	}
+
+	if *input.Completed && input.CompleteChildren {
+		completeStmt := fmt.Sprintf("UPDATE todos SET completed=1, updated_at=$3 WHERE id IN (%s);", sqliteDescendantsQuery)
+		if _, err := tx.ExecContext(ctx, completeStmt, sqliteIds([]int{id}), userId, now); err != nil {
+			return nil, err
+		}
+	}
+
+	return sqliteSelectTodo(ctx, tx, id)
+}
+
+func (db *sqliteDB) List(ctx context.Context, start int, count int, filter *models.TodoFilter, userId int) (*models.TodoList, error) {
+	now := sqliteNow()
+	where, args := sqliteTodoFilterConditions(filter, userId, now)
+
+	keyset := filter != nil && filter.Keyset
+	order, after, pageArgs, err := sqliteTodoOrder(filter, args)
+	if err != nil {
+		return nil, err
+	}
+	pageWhere, limit := where, count
+	if after != "" {
+		pageWhere += " AND " + after
+	}
+	if keyset {
+		// one more row tells whether there is a next page
+		start, limit = 0, count+1
+	}
+
+	stm := fmt.Sprintf(`
+		SELECT %s FROM todos
+		WHERE %s
+		ORDER BY %s
+		LIMIT $%d
+		OFFSET $%d;
+		`, sqliteTodoColumns, pageWhere, order, len(pageArgs)+1, len(pageArgs)+2)
+	rows, err := db.sql.QueryContext(ctx, stm, append(pageArgs, limit, start)...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	res := &models.TodoList{
+		List: []models.Todo{},
+	}
+	for rows.Next() {
+		todo, err := scanSQLiteTodo(rows)
+		if err != nil {
+			return nil, err
+		}
+
+		res.List = append(res.List, *todo)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if keyset {
+		res.List, res.NextCursor, res.PrevCursor = keysetPage(res.List, count, filter)
+	}
+
+	if filter != nil && filter.View != "" {
+		descendants, err := db.descendants(ctx, res.List, userId)
+		if err != nil {
+			return nil, err
+		}
+		res.List = nestTodos(res.List, descendants, filter.View == models.ViewFlat)
+	}
+
+	countStmt := fmt.Sprintf(`
+		SELECT
+			COUNT(*),
+			COUNT(*) FILTER (WHERE completed = 1),
+			COUNT(*) FILTER (WHERE due < $%d AND completed = 0)
+		FROM todos
+		WHERE %s;
+		`, len(args)+1, where)
+	row := db.sql.QueryRowContext(ctx, countStmt, append(args, now)...)
+	if err := row.Scan(&res.Count, &res.CompletedCount, &res.OverdueCount); err != nil {
+		return nil, err
+	}
+
+	return res, nil
+}
+
+// sqliteTodoFilterConditions builds a WHERE clause for the filter like todoFilterConditions,
+// now is the time overdue todos are due before
+func sqliteTodoFilterConditions(filter *models.TodoFilter, userId int, now int64) (string, []interface{}) {
+	conditions := []string{"userid=$1", "deleted_at IS NULL"}
+	args := []interface{}{userId}
+
+	if filter != nil {
+		if filter.Overdue {
+			args = append(args, now)
+			conditions = append(conditions, fmt.Sprintf("due < $%d", len(args)), "completed = 0")
+		}
+		if filter.DueFrom != nil {
+			args = append(args, filter.DueFrom.UnixMicro())
+			conditions = append(conditions, fmt.Sprintf("due >= $%d", len(args)))
+		}
+		if filter.DueTo != nil {
+			args = append(args, filter.DueTo.UnixMicro())
+			conditions = append(conditions, fmt.Sprintf("due < $%d", len(args)))
+		}
+		if filter.View != "" {
+			conditions = append(conditions, "parent_id IS NULL")
+		}
+		if filter.Completed != nil {
+			args = append(args, *filter.Completed)
+			conditions = append(conditions, fmt.Sprintf("completed = $%d", len(args)))
+		}
+		if filter.Query != "" {
+			args = append(args, filter.Query)
+			conditions = append(conditions, fmt.Sprintf("instr(unicode_lower(task), unicode_lower($%d)) > 0", len(args)))
+		}
+		if filter.Inbox {
+			conditions = append(conditions, "list_id IS NULL")
+		} else if filter.ListId != nil {
+			args = append(args, *filter.ListId)
+			conditions = append(conditions, fmt.Sprintf("list_id = $%d", len(args)))
+		}
+		if len(filter.Tags) > 0 {
+			tags := uniqueStrings(filter.Tags)
+			args = append(args, sqliteStrings(tags))
+			matching := fmt.Sprintf(`
+				SELECT %%s FROM todo_tags tt JOIN tags t ON t.id = tt.tagid
+				WHERE tt.todoid = todos.id AND t.name IN (SELECT value FROM json_each($%d))`, len(args))
+			if filter.AllTags {
+				args = append(args, len(tags))
+				conditions = append(conditions, fmt.Sprintf("(%s) = $%d", fmt.Sprintf(matching, "COUNT(*)"), len(args)))
+			} else {
+				conditions = append(conditions, fmt.Sprintf("EXISTS (%s)", fmt.Sprintf(matching, "1")))
+			}
+		}
+	}
+
+	return strings.Join(conditions, " AND "), args
+}
+
+// sqliteTodoOrder is todoOrder for sqlite, the cursor value is converted to the column type
+func sqliteTodoOrder(filter *models.TodoFilter, args []interface{}) (string, string, []interface{}, error) {
+	sort, desc := models.SortPosition, false
+	if filter != nil {
+		if filter.Sort != "" {
+			sort = filter.Sort
+		}
+		desc = filter.Desc
+	}
+	column, ok := todoSortColumns[sort]
+	if !ok {
+		return "", "", nil, fmt.Errorf("unknown sort field %q", sort)
+	}
+
+	var cursor *models.Cursor
+	if filter != nil && filter.Keyset {
+		cursor = filter.Cursor
+	}
+	backward := cursor != nil && cursor.Before
+
+	direction := "ASC"
+	if desc != backward {
+		direction = "DESC"
+	}
+	order := fmt.Sprintf("%s %s, id %s", column.column, direction, direction)
+	if column.column == "id" {
+		order = fmt.Sprintf("id %s", direction)
+	}
+	if cursor == nil {
+		return order, "", args, nil
+	}
+
+	value, err := sqliteCursorValue(cursor, sort)
+	if err != nil {
+		return "", "", nil, err
+	}
+	operator := ">"
+	if direction == "DESC" {
+		operator = "<"
+	}
+	args = append(append([]interface{}{}, args...), value, cursor.Id)
+	condition := fmt.Sprintf("(%s, id) %s ($%d, $%d)", column.column, operator, len(args)-1, len(args))
+
+	return order, condition, args, nil
+}
+
+func sqliteCursorValue(cursor *models.Cursor, sort string) (interface{}, error) {
+	var res interface{}
+	var err error
+	switch sort {
+	case models.SortText:
+		res = cursor.Value
+	case models.SortCreated, models.SortUpdated:
+		var t time.Time
+		t, err = time.Parse(time.RFC3339Nano, cursor.Value)
+		res = t.UnixMicro()
+	case models.SortCompleted:
+		res, err = strconv.ParseBool(cursor.Value)
+	default:
+		res, err = strconv.Atoi(cursor.Value)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid cursor value %q", cursor.Value)
+	}
+	return res, nil
+}
+
+// sqliteDescendantsQuery selects the ids of every descendant of the todos in $1 outside of the trash
+var sqliteDescendantsQuery = sqliteDescendantsMatching("deleted_at IS NULL")
+
+// sqliteDescendantsMatching selects the ids of the descendants of the todos in the JSON array $1
+// reachable through the todos matching the condition
+func sqliteDescendantsMatching(condition string) string {
+	return fmt.Sprintf(`
+	WITH RECURSIVE descendants AS (
+		SELECT id FROM todos WHERE parent_id IN (SELECT value FROM json_each($1)) AND userid=$2 AND %s
+		UNION ALL
+		SELECT t.id FROM todos t JOIN descendants d ON t.parent_id = d.id WHERE %s
+	)
+	SELECT id FROM descendants`, condition, condition)
+}
+
+func (db *sqliteDB) descendants(ctx context.Context, parents []models.Todo, userId int) ([]models.Todo, error) {
+	ids := make([]int, 0, len(parents))
+	for _, todo := range parents {
+		ids = append(ids, *todo.Id)
+	}
+
+	query := fmt.Sprintf("SELECT %s FROM todos WHERE id IN (%s) ORDER BY position ASC, id ASC;", sqliteTodoColumns, sqliteDescendantsQuery)
+	rows, err := db.sql.QueryContext(ctx, query, sqliteIds(ids), userId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	list := []models.Todo{}
+	for rows.Next() {
+		todo, err := scanSQLiteTodo(rows)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, *todo)
+	}
+
+	return list, rows.Err()
+}
+
+func (db *sqliteDB) Add(ctx context.Context, input *models.AddTodoRequest, userId int) (*models.Todo, error) {
+	tx, err := db.sql.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	res, err := sqliteAddTodo(ctx, tx, input, userId)
+	if err != nil {
+		return nil, err
+	}
+
+	return res, tx.Commit()
+}
+
+func sqliteAddTodo(ctx context.Context, tx *sqlTx, input *models.AddTodoRequest, userId int) (*models.Todo, error) {
+	if input.ListId != nil {
+		if err := checkListOwner(ctx, tx, *input.ListId, userId); err != nil {
+			return nil, err
+		}
+	}
+	if input.ParentId != nil {
+		if err := checkTodoOwner(ctx, tx, *input.ParentId, userId); err != nil {
+			return nil, err
+		}
+	}
+
+	// new todos go to the end of the manual order
+	insertStmt := fmt.Sprintf(`
+		INSERT INTO todos(task, completed, due, list_id, parent_id, userid, position, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, (SELECT COALESCE(MAX(position), 0) + %d FROM todos WHERE userid=$6), $7, $7)
+		RETURNING id;`, positionGap)
+	row := tx.QueryRowContext(ctx, insertStmt, input.Text, input.Completed, sqliteMicros(input.Due), input.ListId, input.ParentId, userId, sqliteNow())
+	var id int
+	if err := row.Scan(&id); err != nil {
+		return nil, err
+	}
+
+	if len(input.Tags) > 0 {
+		if err := sqliteSetTodoTags(ctx, tx, id, input.Tags, userId); err != nil {
+			return nil, err
+		}
+	}
+
+	return sqliteSelectTodo(ctx, tx, id)
+}
+
+// sqliteTodoColumns are the columns read by scanSQLiteTodo
+const sqliteTodoColumns = "id, task, completed, due, list_id, parent_id, position, created_at, updated_at, " + sqliteTodoTagsColumn
+
+// scanSQLiteTodo reads sqliteTodoColumns followed by the extra columns
+func scanSQLiteTodo(row rowScanner, extra ...interface{}) (*models.Todo, error) {
+	var id int
+	var text string
+	var completed bool
+	var due sqliteTime
+	var listId sql.NullInt64
+	var parentId sql.NullInt64
+	var position int
+	var createdAt, updatedAt sqliteTime
+	var tags string
+	dest := []interface{}{&id, &text, &completed, &due, &listId, &parentId, &position, &createdAt, &updatedAt, &tags}
+	if err := row.Scan(append(dest, extra...)...); err != nil {
+		return nil, err
+	}
+
+	todo := &models.Todo{
+		Id:        &id,
+		Position:  &position,
+		CreatedAt: &createdAt.Time,
+		UpdatedAt: &updatedAt.Time,
+		AddTodoRequest: models.AddTodoRequest{
+			Text:      &text,
+			Completed: &completed,
+			Due:       due.ptr(),
+		},
+	}
+	if err := json.Unmarshal([]byte(tags), &todo.Tags); err != nil {
+		return nil, err
+	}
+	sort.Strings(todo.Tags)
+	if listId.Valid {
+		list := int(listId.Int64)
+		todo.ListId = &list
+	}
+	if parentId.Valid {
+		parent := int(parentId.Int64)
+		todo.ParentId = &parent
+	}
+
+	return todo, nil
+}
+
+func sqliteSelectTodo(ctx context.Context, tx *sqlTx, id int) (*models.Todo, error) {
+	return scanSQLiteTodo(tx.QueryRowContext(ctx, fmt.Sprintf("SELECT %s FROM todos WHERE id=$1;", sqliteTodoColumns), id))
+}
+
+func (db *sqliteDB) Delete(ctx context.Context, id int, userId int) error {
+	tx, err := db.sql.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := sqliteDeleteTodo(ctx, tx, id, userId); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// sqliteDeleteTodo moves the todo with its subtasks to the trash
+func sqliteDeleteTodo(ctx context.Context, tx *sqlTx, id int, userId int) error {
+	if err := checkTodoOwner(ctx, tx, id, userId); err != nil {
+		return err
+	}
+
+	_, err := sqliteTrashTodos(ctx, tx, []int{id}, userId, sqliteNow())
+	return err
+}
+
+func (db *sqliteDB) Register(ctx context.Context, input *models.RegisterRequest) (int, error) {
+	hash, err := tools.HashPassword(*input.Password)
+	if err != nil {
+		return 0, err
+	}
+
+	query := "INSERT INTO users(login, passwordhash, created_at) values($1, $2, $3) RETURNING id;"
+	row := db.sql.QueryRowContext(ctx, query, input.Login, hash, sqliteNow())
+	var id int
+	if err := row.Scan(&id); err != nil {
+		if isSQLiteUniqueViolation(err, "users.login") {
+			err = ErrUserExists
+		}
+		return 0, err
+	}
+
+	return id, nil
+}
+
+func (db *sqliteDB) Login(ctx context.Context, input *models.LoginRequest) (*int, error) {
+	query := "SELECT id, passwordhash FROM users WHERE login=$1;"
+	row := db.sql.QueryRowContext(ctx, query, input.Login)
+	var id int
+	var hash string
+	if err := row.Scan(&id, &hash); err != nil {
+		if err != sql.ErrNoRows {
+			return nil, err
+		}
+		hash = dummyPasswordHash
+	}
+
+	ok, rehash, err := tools.VerifyPassword(*input.Password, hash)
+	if err != nil {
+		return nil, err
+	}
+	if !ok || hash == dummyPasswordHash {
+		return nil, fmt.Errorf("user or password is invalid")
+	}
+
+	// legacy and outdated hashes are replaced while the password is at hand
+	if rehash {
+		newHash, err := tools.HashPassword(*input.Password)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := db.sql.ExecContext(ctx, "UPDATE users SET passwordhash=$1 WHERE id=$2 AND passwordhash=$3;", newHash, id, hash); err != nil {
+			return nil, err
+		}
+	}
+
+	return &id, nil
+}
@@ -0,0 +1,52 @@
+package db
+
+import "github.com/ann-96/todo-go-backend/app/models"
+
+// nestTodos places the descendants of the roots under their parents, or right after them with
+// a depth for the flat view, every todo with descendants gets its progress
+func nestTodos(roots []models.Todo, descendants []models.Todo, flat bool) []models.Todo {
+	children := map[int][]models.Todo{}
+	for _, todo := range descendants {
+		children[*todo.ParentId] = append(children[*todo.ParentId], todo)
+	}
+
+	res := []models.Todo{}
+	var visit func(todo models.Todo, depth int) (models.Todo, int, int)
+	visit = func(todo models.Todo, depth int) (models.Todo, int, int) {
+		todo.Depth = &depth
+		index := len(res)
+		if flat {
+			res = append(res, todo)
+		}
+
+		done, total := 0, 0
+		for _, child := range children[*todo.Id] {
+			child, childDone, childTotal := visit(child, depth+1)
+			done += childDone
+			total += childTotal + 1
+			if *child.Completed {
+				done++
+			}
+			if !flat {
+				todo.Children = append(todo.Children, child)
+			}
+		}
+		if total > 0 {
+			todo.Progress = &models.Progress{Done: done, Total: total}
+		}
+
+		if flat {
+			res[index] = todo
+		}
+		return todo, done, total
+	}
+
+	for _, root := range roots {
+		root, _, _ := visit(root, 0)
+		if !flat {
+			res = append(res, root)
+		}
+	}
+
+	return res
+}
@@ -0,0 +1,162 @@
+package db
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/ann-96/todo-go-backend/app/models"
+)
+
+// trash moves the todos in ids with their subtasks to the trash, they all share the
+// time so that they are restored together, and returns how many todos were trashed
+func (data *memoryData) trash(ids []int, at time.Time) int {
+	todos := data.descendants(ids, isLive)
+	for _, id := range ids {
+		if todo, ok := data.todos[id]; ok {
+			todos = append(todos, todo)
+		}
+	}
+
+	trashed := 0
+	for _, todo := range todos {
+		if todo.deletedAt != nil {
+			continue
+		}
+		deletedAt := at
+		todo.deletedAt = &deletedAt
+		trashed++
+	}
+	return trashed
+}
+
+func (db *memoryDB) ListTrash(ctx context.Context, start int, count int, userId int) (*models.TodoList, error) {
+	if err := db.rlock(ctx); err != nil {
+		return nil, err
+	}
+	defer db.runlock()
+
+	res := &models.TodoList{
+		List: []models.Todo{},
+	}
+	user, ok := db.users[userId]
+	if !ok {
+		return res, nil
+	}
+	data := user.data
+
+	trashed := []*memoryTodo{}
+	for _, todo := range data.todos {
+		if todo.deletedAt == nil {
+			continue
+		}
+		trashed = append(trashed, todo)
+
+		res.Count++
+		if todo.completed {
+			res.CompletedCount++
+		}
+	}
+	sort.Slice(trashed, func(i, j int) bool {
+		if order := compareTimes(*trashed[i].deletedAt, *trashed[j].deletedAt); order != 0 {
+			return order > 0
+		}
+		return trashed[i].id > trashed[j].id
+	})
+
+	if start > len(trashed) {
+		start = len(trashed)
+	}
+	trashed = trashed[start:]
+	if len(trashed) > count {
+		trashed = trashed[:count]
+	}
+	for _, todo := range trashed {
+		item := data.todoModel(todo)
+		item.DeletedAt = memoryTime(todo.deletedAt)
+		res.List = append(res.List, item)
+	}
+
+	return res, nil
+}
+
+func (db *memoryDB) RestoreTodo(ctx context.Context, id int, userId int) (*models.Todo, error) {
+	if err := db.lock(ctx); err != nil {
+		return nil, err
+	}
+	defer db.unlock()
+
+	user, ok := db.users[userId]
+	if !ok {
+		return nil, errTrashedTodoNotFound
+	}
+	db.changeData(user)
+	data := user.data
+	todo, ok := data.todos[id]
+	if !ok || todo.deletedAt == nil {
+		return nil, errTrashedTodoNotFound
+	}
+
+	// the subtasks trashed together with the todo come back with it
+	deletedAt := *todo.deletedAt
+	trashedAlong := func(todo *memoryTodo) bool {
+		return todo.deletedAt != nil && todo.deletedAt.Equal(deletedAt)
+	}
+	now := memoryNow()
+	for _, restored := range append(data.descendants([]int{id}, trashedAlong), todo) {
+		restored.deletedAt = nil
+		restored.updatedAt = now
+	}
+
+	// a subtask of a todo that is still in the trash becomes a top level todo
+	if todo.parentId != nil {
+		if parent, ok := data.todos[*todo.parentId]; ok && parent.deletedAt != nil {
+			todo.parentId = nil
+		}
+	}
+
+	res := data.todoModel(todo)
+	return &res, nil
+}
+
+func (db *memoryDB) EmptyTrash(ctx context.Context, userId int) (int, error) {
+	if err := db.lock(ctx); err != nil {
+		return 0, err
+	}
+	defer db.unlock()
+
+	user, ok := db.users[userId]
+	if !ok {
+		return 0, nil
+	}
+	db.changeData(user)
+	return user.data.removeTodos(user.data.trashedBefore(nil)), nil
+}
+
+func (db *memoryDB) PurgeTrash(ctx context.Context, before time.Time) (int, error) {
+	if err := db.lock(ctx); err != nil {
+		return 0, err
+	}
+	defer db.unlock()
+
+	deleted := 0
+	for _, user := range db.users {
+		if ids := user.data.trashedBefore(&before); len(ids) > 0 {
+			db.changeData(user)
+			deleted += user.data.removeTodos(ids)
+		}
+	}
+	return deleted, nil
+}
+
+// trashedBefore returns the ids of the todos trashed before the time, or of every
+// trashed todo without one
+func (data *memoryData) trashedBefore(before *time.Time) []int {
+	ids := []int{}
+	for id, todo := range data.todos {
+		if todo.deletedAt != nil && (before == nil || todo.deletedAt.Before(*before)) {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
@@ -0,0 +1,157 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/ann-96/todo-go-backend/app/models"
+	"github.com/lib/pq"
+)
+
+// trashedDescendantsQuery selects the ids of the descendants of the todos in $1 trashed at $3,
+// that is together with them
+var trashedDescendantsQuery = descendantsMatching("deleted_at = $3")
+
+// trashTodos moves the todos in ids with their subtasks to the trash, they all share the
+// transaction time so that they are restored together
+func trashTodos(ctx context.Context, tx *sqlTx, ids []int64, userId int) (int, error) {
+	trashStmt := fmt.Sprintf(`
+		UPDATE todos SET deleted_at=now()
+		WHERE userid=$2 AND deleted_at IS NULL AND (id = ANY($1) OR id IN (%s));`, descendantsQuery)
+	res, err := tx.ExecContext(ctx, trashStmt, pq.Array(ids), userId)
+	if err != nil {
+		return 0, err
+	}
+	trashed, err := res.RowsAffected()
+	return int(trashed), err
+}
+
+// trashMatching moves the todos matching the WHERE clause to the trash and returns their number,
+// not counting the subtasks trashed along
+func trashMatching(ctx context.Context, tx *sqlTx, where string, args []interface{}, userId int) (int, error) {
+	rows, err := tx.QueryContext(ctx, fmt.Sprintf("SELECT id FROM todos WHERE %s;", where), args...)
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+
+	ids := []int64{}
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return 0, err
+		}
+		ids = append(ids, id)
+	}
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	if _, err := trashTodos(ctx, tx, ids, userId); err != nil {
+		return 0, err
+	}
+	return len(ids), nil
+}
+
+func (db *postgresDB) ListTrash(ctx context.Context, start int, count int, userId int) (*models.TodoList, error) {
+	stm := fmt.Sprintf(`
+		SELECT %s, deleted_at FROM todos
+		WHERE userid=$1 AND deleted_at IS NOT NULL
+		ORDER BY deleted_at DESC, id DESC
+		LIMIT $2
+		OFFSET $3;
+		`, todoColumns)
+	rows, err := db.sql.QueryContext(ctx, stm, userId, count, start)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	res := &models.TodoList{
+		List: []models.Todo{},
+	}
+	for rows.Next() {
+		var deletedAt time.Time
+		todo, err := scanTodo(rows, &deletedAt)
+		if err != nil {
+			return nil, err
+		}
+		todo.DeletedAt = &deletedAt
+
+		res.List = append(res.List, *todo)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	countStmt := `
+		SELECT
+			COUNT(*),
+			COUNT(*) FILTER (WHERE completed = true)
+		FROM todos
+		WHERE userid=$1 AND deleted_at IS NOT NULL;`
+	row := db.sql.QueryRowContext(ctx, countStmt, userId)
+	if err := row.Scan(&res.Count, &res.CompletedCount); err != nil {
+		return nil, err
+	}
+
+	return res, nil
+}
+
+func (db *postgresDB) RestoreTodo(ctx context.Context, id int, userId int) (*models.Todo, error) {
+	tx, err := db.sql.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	row := tx.QueryRowContext(ctx, "SELECT deleted_at FROM todos WHERE id=$1 AND userid=$2 AND deleted_at IS NOT NULL;", id, userId)
+	var deletedAt time.Time
+	if err := row.Scan(&deletedAt); err != nil {
+		if err == sql.ErrNoRows {
+			err = fmt.Errorf("entry not found in the trash")
+		}
+		return nil, err
+	}
+
+	// the subtasks trashed together with the todo come back with it
+	restoreStmt := fmt.Sprintf(`
+		UPDATE todos SET deleted_at=NULL, updated_at=now()
+		WHERE userid=$2 AND deleted_at=$3 AND (id = ANY($1) OR id IN (%s));`, trashedDescendantsQuery)
+	if _, err := tx.ExecContext(ctx, restoreStmt, pq.Array([]int64{int64(id)}), userId, deletedAt); err != nil {
+		return nil, err
+	}
+
+	// a subtask of a todo that is still in the trash becomes a top level todo
+	detachStmt := "UPDATE todos SET parent_id=NULL WHERE id=$1 AND parent_id IN (SELECT id FROM todos WHERE deleted_at IS NOT NULL);"
+	if _, err := tx.ExecContext(ctx, detachStmt, id); err != nil {
+		return nil, err
+	}
+
+	res, err := selectTodo(ctx, tx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	return res, tx.Commit()
+}
+
+func (db *postgresDB) EmptyTrash(ctx context.Context, userId int) (int, error) {
+	res, err := db.sql.ExecContext(ctx, "DELETE FROM todos WHERE userid=$1 AND deleted_at IS NOT NULL;", userId)
+	if err != nil {
+		return 0, err
+	}
+	deleted, err := res.RowsAffected()
+	return int(deleted), err
+}
+
+func (db *postgresDB) PurgeTrash(ctx context.Context, before time.Time) (int, error) {
+	res, err := db.sql.ExecContext(ctx, "DELETE FROM todos WHERE deleted_at < $1;", before)
+	if err != nil {
+		return 0, err
+	}
+	deleted, err := res.RowsAffected()
+	return int(deleted), err
+}
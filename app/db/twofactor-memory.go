@@ -0,0 +1,132 @@
+package db
+
+import (
+	"context"
+	"time"
+
+	"github.com/ann-96/todo-go-backend/app/tools"
+)
+
+func (db *memoryDB) StartTOTPEnrollment(ctx context.Context, userId int, secret string) (string, error) {
+	if err := db.lock(ctx); err != nil {
+		return "", err
+	}
+	defer db.unlock()
+
+	user, ok := db.users[userId]
+	if !ok || user.totpEnabled {
+		return "", ErrTwoFactorEnabled
+	}
+	db.changeUser(user)
+	user.totpSecret = secret
+	return user.login, nil
+}
+
+func (db *memoryDB) ConfirmTOTPEnrollment(ctx context.Context, userId int, code string, recoveryCodeHashes []string) error {
+	if err := db.lock(ctx); err != nil {
+		return err
+	}
+	defer db.unlock()
+
+	user, err := db.user(userId)
+	if err != nil {
+		return err
+	}
+	if user.totpEnabled {
+		return ErrTwoFactorEnabled
+	}
+	if user.totpSecret == "" {
+		return ErrNoTwoFactorPending
+	}
+	step, ok := tools.MatchTOTP(user.totpSecret, code, time.Now())
+	if !ok {
+		return ErrWrongCode
+	}
+
+	db.changeUser(user)
+	user.totpEnabled = true
+	user.totpLastStep = step
+	user.setRecoveryCodes(recoveryCodeHashes)
+	return nil
+}
+
+func (db *memoryDB) TwoFactorEnabled(ctx context.Context, userId int) (bool, error) {
+	if err := db.rlock(ctx); err != nil {
+		return false, err
+	}
+	defer db.runlock()
+
+	user, err := db.user(userId)
+	if err != nil {
+		return false, err
+	}
+	return user.totpEnabled, nil
+}
+
+func (db *memoryDB) VerifySecondFactor(ctx context.Context, userId int, code string) error {
+	if err := db.lock(ctx); err != nil {
+		return err
+	}
+	defer db.unlock()
+
+	user, err := db.user(userId)
+	if err != nil {
+		return err
+	}
+	if !user.totpEnabled {
+		return ErrTwoFactorNotEnabled
+	}
+
+	if tools.IsTOTPCode(code) {
+		step, ok := tools.MatchTOTP(user.totpSecret, code, time.Now())
+		if !ok || step <= user.totpLastStep {
+			return ErrWrongCode
+		}
+		db.changeUser(user)
+		user.totpLastStep = step
+		return nil
+	}
+
+	hash := tools.HashToken(tools.NormalizeRecoveryCode(code))
+	if used, ok := user.recoveryCodes[hash]; !ok || used {
+		return ErrWrongCode
+	}
+	db.changeUser(user)
+	user.recoveryCodes[hash] = true
+	return nil
+}
+
+func (db *memoryDB) DisableTwoFactor(ctx context.Context, userId int) error {
+	if err := db.lock(ctx); err != nil {
+		return err
+	}
+	defer db.unlock()
+
+	if user, ok := db.users[userId]; ok {
+		db.changeUser(user)
+		user.totpSecret = ""
+		user.totpEnabled = false
+		user.setRecoveryCodes(nil)
+	}
+	return nil
+}
+
+func (db *memoryDB) ReplaceRecoveryCodes(ctx context.Context, userId int, recoveryCodeHashes []string) error {
+	if err := db.lock(ctx); err != nil {
+		return err
+	}
+	defer db.unlock()
+
+	if user, ok := db.users[userId]; ok {
+		db.changeUser(user)
+		user.setRecoveryCodes(recoveryCodeHashes)
+	}
+	return nil
+}
+
+func (user *memoryUser) setRecoveryCodes(hashes []string) {
+	user.recoveryCodes = make(map[string]bool, len(hashes))
+	for _, hash := range hashes {
+		user.recoveryCodes[hash] = false
+	}
+}
@@ -0,0 +1,157 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/ann-96/todo-go-backend/app/tools"
+)
+
+var (
+	ErrTwoFactorEnabled    = errors.New("two-factor authentication is already enabled")
+	ErrTwoFactorNotEnabled = errors.New("two-factor authentication is not enabled")
+	ErrNoTwoFactorPending  = errors.New("there is no two-factor enrollment to confirm")
+	ErrWrongCode           = errors.New("the code is wrong")
+)
+
+func (db *postgresDB) StartTOTPEnrollment(ctx context.Context, userId int, secret string) (string, error) {
+	row := db.sql.QueryRowContext(ctx, "UPDATE users SET totp_secret=$1 WHERE id=$2 AND totp_enabled=false RETURNING login;", secret, userId)
+	var login string
+	if err := row.Scan(&login); err != nil {
+		if err == sql.ErrNoRows {
+			err = ErrTwoFactorEnabled
+		}
+		return "", err
+	}
+	return login, nil
+}
+
+func (db *postgresDB) ConfirmTOTPEnrollment(ctx context.Context, userId int, code string, recoveryCodeHashes []string) error {
+	tx, err := db.sql.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	row := tx.QueryRowContext(ctx, "SELECT totp_secret, totp_enabled FROM users WHERE id=$1 FOR UPDATE;", userId)
+	var secret sql.NullString
+	var enabled bool
+	if err := row.Scan(&secret, &enabled); err != nil {
+		return err
+	}
+	if enabled {
+		return ErrTwoFactorEnabled
+	}
+	if !secret.Valid {
+		return ErrNoTwoFactorPending
+	}
+	step, ok := tools.MatchTOTP(secret.String, code, time.Now())
+	if !ok {
+		return ErrWrongCode
+	}
+
+	if _, err := tx.ExecContext(ctx, "UPDATE users SET totp_enabled=true, totp_last_step=$1 WHERE id=$2;", step, userId); err != nil {
+		return err
+	}
+	if err := setRecoveryCodes(ctx, tx, userId, recoveryCodeHashes); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (db *postgresDB) TwoFactorEnabled(ctx context.Context, userId int) (bool, error) {
+	row := db.sql.QueryRowContext(ctx, "SELECT totp_enabled FROM users WHERE id=$1;", userId)
+	var enabled bool
+	if err := row.Scan(&enabled); err != nil {
+		return false, err
+	}
+	return enabled, nil
+}
+
+func (db *postgresDB) VerifySecondFactor(ctx context.Context, userId int, code string) error {
+	tx, err := db.sql.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	row := tx.QueryRowContext(ctx, "SELECT totp_secret, totp_enabled, totp_last_step FROM users WHERE id=$1 FOR UPDATE;", userId)
+	var secret sql.NullString
+	var enabled bool
+	var lastStep int64
+	if err := row.Scan(&secret, &enabled, &lastStep); err != nil {
+		return err
+	}
+	if !enabled {
+		return ErrTwoFactorNotEnabled
+	}
+
+	if tools.IsTOTPCode(code) {
+		step, ok := tools.MatchTOTP(secret.String, code, time.Now())
+		if !ok || step <= lastStep {
+			return ErrWrongCode
+		}
+		if _, err := tx.ExecContext(ctx, "UPDATE users SET totp_last_step=$1 WHERE id=$2;", step, userId); err != nil {
+			return err
+		}
+	} else {
+		res, err := tx.ExecContext(ctx, "UPDATE recovery_codes SET used_at=now() WHERE userid=$1 AND code_hash=$2 AND used_at IS NULL;",
+			userId, tools.HashToken(tools.NormalizeRecoveryCode(code)))
+		if err != nil {
+			return err
+		}
+		if used, err := res.RowsAffected(); err != nil {
+			return err
+		} else if used == 0 {
+			return ErrWrongCode
+		}
+	}
+
+	return tx.Commit()
+}
+
+func (db *postgresDB) DisableTwoFactor(ctx context.Context, userId int) error {
+	tx, err := db.sql.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, "UPDATE users SET totp_secret=NULL, totp_enabled=false WHERE id=$1;", userId); err != nil {
+		return err
+	}
+	if err := setRecoveryCodes(ctx, tx, userId, nil); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (db *postgresDB) ReplaceRecoveryCodes(ctx context.Context, userId int, recoveryCodeHashes []string) error {
+	tx, err := db.sql.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := setRecoveryCodes(ctx, tx, userId, recoveryCodeHashes); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func setRecoveryCodes(ctx context.Context, tx *sqlTx, userId int, hashes []string) error {
+	if _, err := tx.ExecContext(ctx, "DELETE FROM recovery_codes WHERE userid=$1;", userId); err != nil {
+		return err
+	}
+	for _, hash := range hashes {
+		if _, err := tx.ExecContext(ctx, "INSERT INTO recovery_codes(userid, code_hash) VALUES ($1, $2);", userId, hash); err != nil {
+			return err
+		}
+	}
+	return nil
+}
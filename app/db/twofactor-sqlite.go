@@ -0,0 +1,137 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/ann-96/todo-go-backend/app/tools"
+)
+
+func (db *sqliteDB) StartTOTPEnrollment(ctx context.Context, userId int, secret string) (string, error) {
+	row := db.sql.QueryRowContext(ctx, "UPDATE users SET totp_secret=$1 WHERE id=$2 AND totp_enabled=0 RETURNING login;", secret, userId)
+	var login string
+	if err := row.Scan(&login); err != nil {
+		if err == sql.ErrNoRows {
+			err = ErrTwoFactorEnabled
+		}
+		return "", err
+	}
+	return login, nil
+}
+
+func (db *sqliteDB) ConfirmTOTPEnrollment(ctx context.Context, userId int, code string, recoveryCodeHashes []string) error {
+	tx, err := db.sql.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	row := tx.QueryRowContext(ctx, "SELECT totp_secret, totp_enabled FROM users WHERE id=$1;", userId)
+	var secret sql.NullString
+	var enabled bool
+	if err := row.Scan(&secret, &enabled); err != nil {
+		return err
+	}
+	if enabled {
+		return ErrTwoFactorEnabled
+	}
+	if !secret.Valid {
+		return ErrNoTwoFactorPending
+	}
+	step, ok := tools.MatchTOTP(secret.String, code, time.Now())
+	if !ok {
+		return ErrWrongCode
+	}
+
+	if _, err := tx.ExecContext(ctx, "UPDATE users SET totp_enabled=1, totp_last_step=$1 WHERE id=$2;", step, userId); err != nil {
+		return err
+	}
+	if err := setRecoveryCodes(ctx, tx, userId, recoveryCodeHashes); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (db *sqliteDB) TwoFactorEnabled(ctx context.Context, userId int) (bool, error) {
+	row := db.sql.QueryRowContext(ctx, "SELECT totp_enabled FROM users WHERE id=$1;", userId)
+	var enabled bool
+	if err := row.Scan(&enabled); err != nil {
+		return false, err
+	}
+	return enabled, nil
+}
+
+func (db *sqliteDB) VerifySecondFactor(ctx context.Context, userId int, code string) error {
+	tx, err := db.sql.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	row := tx.QueryRowContext(ctx, "SELECT totp_secret, totp_enabled, totp_last_step FROM users WHERE id=$1;", userId)
+	var secret sql.NullString
+	var enabled bool
+	var lastStep int64
+	if err := row.Scan(&secret, &enabled, &lastStep); err != nil {
+		return err
+	}
+	if !enabled {
+		return ErrTwoFactorNotEnabled
+	}
+
+	if tools.IsTOTPCode(code) {
+		step, ok := tools.MatchTOTP(secret.String, code, time.Now())
+		if !ok || step <= lastStep {
+			return ErrWrongCode
+		}
+		if _, err := tx.ExecContext(ctx, "UPDATE users SET totp_last_step=$1 WHERE id=$2;", step, userId); err != nil {
+			return err
+		}
+	} else {
+		res, err := tx.ExecContext(ctx, "UPDATE recovery_codes SET used_at=$1 WHERE userid=$2 AND code_hash=$3 AND used_at IS NULL;",
+			sqliteNow(), userId, tools.HashToken(tools.NormalizeRecoveryCode(code)))
+		if err != nil {
+			return err
+		}
+		if used, err := res.RowsAffected(); err != nil {
+			return err
+		} else if used == 0 {
+			return ErrWrongCode
+		}
+	}
+
+	return tx.Commit()
+}
+
+func (db *sqliteDB) DisableTwoFactor(ctx context.Context, userId int) error {
+	tx, err := db.sql.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, "UPDATE users SET totp_secret=NULL, totp_enabled=0 WHERE id=$1;", userId); err != nil {
+		return err
+	}
+	if err := setRecoveryCodes(ctx, tx, userId, nil); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (db *sqliteDB) ReplaceRecoveryCodes(ctx context.Context, userId int, recoveryCodeHashes []string) error {
+	tx, err := db.sql.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := setRecoveryCodes(ctx, tx, userId, recoveryCodeHashes); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
@@ -0,0 +1,136 @@
+package db
+
+// memoryUndo is the log of the changes made by the unit of work of InTx, played backwards when
+// it fails. A user is copied the first time it changes and their todos the first time those
+// change, the entries of the maps shared by all users are kept one by one. The ids handed out
+// stay taken, like the values of the sequences of the SQL stores
+type memoryUndo struct {
+	steps []func()
+	// users and data tell which users and whose todos were copied already
+	users map[*memoryUser]bool
+	data  map[*memoryUser]bool
+}
+
+func newMemoryUndo() *memoryUndo {
+	return &memoryUndo{
+		users: make(map[*memoryUser]bool),
+		data:  make(map[*memoryUser]bool),
+	}
+}
+
+// rollback plays the log backwards
+func (undo *memoryUndo) rollback() {
+	for i := len(undo.steps) - 1; i >= 0; i-- {
+		undo.steps[i]()
+	}
+}
+
+// onRollback adds a step to the log, outside of InTx there is nothing to log
+func (db *memoryDB) onRollback(step func()) {
+	if db.undo != nil {
+		db.undo.steps = append(db.undo.steps, step)
+	}
+}
+
+// changeUser logs the user before a change of their record, the todos are logged by changeData
+func (db *memoryDB) changeUser(user *memoryUser) {
+	if db.undo == nil || db.undo.users[user] {
+		return
+	}
+	db.undo.users[user] = true
+
+	saved := *user
+	saved.recoveryCodes = make(map[string]bool, len(user.recoveryCodes))
+	for hash, used := range user.recoveryCodes {
+		saved.recoveryCodes[hash] = used
+	}
+	// the tokens themselves are logged by changeAccessToken
+	saved.accessTokens = make(map[int]*memoryAccessToken, len(user.accessTokens))
+	for id, token := range user.accessTokens {
+		saved.accessTokens[id] = token
+	}
+	db.onRollback(func() { *user = saved })
+}
+
+// changeData gives the user a copy of their todos to change, the original is put back on rollback
+func (db *memoryDB) changeData(user *memoryUser) {
+	if db.undo == nil || db.undo.data[user] {
+		return
+	}
+	db.undo.data[user] = true
+
+	saved := user.data
+	user.data = saved.clone()
+	db.onRollback(func() { user.data = saved })
+}
+
+// changeUserEntry logs the entries of the user in the users and logins maps
+func (db *memoryDB) changeUserEntry(id int, login string) {
+	if db.undo == nil {
+		return
+	}
+	user, ok := db.users[id]
+	loginUser, loginOk := db.logins[login]
+	db.onRollback(func() {
+		delete(db.users, id)
+		if ok {
+			db.users[id] = user
+		}
+		delete(db.logins, login)
+		if loginOk {
+			db.logins[login] = loginUser
+		}
+	})
+}
+
+// changeRefreshToken logs the token with the hash and its family before they change
+func (db *memoryDB) changeRefreshToken(hash string) {
+	if db.undo == nil {
+		return
+	}
+	token, ok := db.refreshTokens[hash]
+	if !ok {
+		db.onRollback(func() { delete(db.refreshTokens, hash) })
+		return
+	}
+	saved, family := *token, *token.family
+	db.onRollback(func() {
+		*token, *token.family = saved, family
+		db.refreshTokens[hash] = token
+	})
+}
+
+// changePasswordReset logs the password reset with the hash before it changes
+func (db *memoryDB) changePasswordReset(hash string) {
+	if db.undo == nil {
+		return
+	}
+	reset, ok := db.passwordResets[hash]
+	if !ok {
+		db.onRollback(func() { delete(db.passwordResets, hash) })
+		return
+	}
+	saved := *reset
+	db.onRollback(func() {
+		*reset = saved
+		db.passwordResets[hash] = reset
+	})
+}
+
+// changeAccessToken logs the access token with the hash before it changes, its entry in the
+// tokens of the user is logged by changeUser
+func (db *memoryDB) changeAccessToken(hash string) {
+	if db.undo == nil {
+		return
+	}
+	token, ok := db.accessTokens[hash]
+	if !ok {
+		db.onRollback(func() { delete(db.accessTokens, hash) })
+		return
+	}
+	saved := *token
+	db.onRollback(func() {
+		*token = saved
+		db.accessTokens[hash] = token
+	})
+}
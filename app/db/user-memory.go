@@ -0,0 +1,115 @@
+package db
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/ann-96/todo-go-backend/app/models"
+	"github.com/ann-96/todo-go-backend/app/tools"
+)
+
+func (db *memoryDB) Register(ctx context.Context, input *models.RegisterRequest) (int, error) {
+	// hashing takes a while, so it happens before taking the store
+	hash, err := tools.HashPassword(*input.Password)
+	if err != nil {
+		return 0, err
+	}
+
+	if err := db.lock(ctx); err != nil {
+		return 0, err
+	}
+	defer db.unlock()
+
+	if _, ok := db.logins[*input.Login]; ok {
+		return 0, ErrUserExists
+	}
+
+	db.lastUserId++
+	user := &memoryUser{
+		id:            db.lastUserId,
+		login:         *input.Login,
+		passwordHash:  hash,
+		createdAt:     memoryNow(),
+		recoveryCodes: make(map[string]bool),
+		accessTokens:  make(map[int]*memoryAccessToken),
+		data:          newMemoryData(),
+	}
+	db.changeUserEntry(user.id, user.login)
+	db.users[user.id] = user
+	db.logins[user.login] = user
+
+	return user.id, nil
+}
+
+func (db *memoryDB) Login(ctx context.Context, input *models.LoginRequest) (*int, error) {
+	if err := db.rlock(ctx); err != nil {
+		return nil, err
+	}
+	id, hash := 0, dummyPasswordHash
+	if user, ok := db.logins[*input.Login]; ok {
+		id, hash = user.id, user.passwordHash
+	}
+	db.runlock()
+
+	ok, rehash, err := tools.VerifyPassword(*input.Password, hash)
+	if err != nil {
+		return nil, err
+	}
+	if !ok || hash == dummyPasswordHash {
+		return nil, fmt.Errorf("user or password is invalid")
+	}
+
+	// legacy and outdated hashes are replaced while the password is at hand
+	if rehash {
+		newHash, err := tools.HashPassword(*input.Password)
+		if err != nil {
+			return nil, err
+		}
+		if err := db.lock(ctx); err != nil {
+			return nil, err
+		}
+		if user, ok := db.users[id]; ok && user.passwordHash == hash {
+			db.changeUser(user)
+			user.passwordHash = newHash
+		}
+		db.unlock()
+	}
+
+	return &id, nil
+}
+
+// checkPassword verifies the password of the user without holding the store, the returned
+// hash tells whether the password changed in the meantime
+func (db *memoryDB) checkPassword(ctx context.Context, userId int, password string) (string, error) {
+	if err := db.rlock(ctx); err != nil {
+		return "", err
+	}
+	user, ok := db.users[userId]
+	hash := ""
+	if ok {
+		hash = user.passwordHash
+	}
+	db.runlock()
+	if !ok {
+		return "", ErrWrongPassword
+	}
+
+	ok, _, err := tools.VerifyPassword(password, hash)
+	if err != nil {
+		return "", err
+	}
+	if !ok {
+		return "", ErrWrongPassword
+	}
+	return hash, nil
+}
+
+// checkedUser returns the user whose password was checked with checkPassword, a user that
+// is gone or changed their password since fails the check
+func (db *memoryDB) checkedUser(userId int, hash string) (*memoryUser, error) {
+	user, ok := db.users[userId]
+	if !ok || user.passwordHash != hash {
+		return nil, ErrWrongPassword
+	}
+	return user, nil
+}
@@ -0,0 +1,92 @@
+package app
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+
+	"github.com/ann-96/todo-go-backend/app/db"
+)
+
+const migrateUsage = "usage: migrate up [N] | down [N] | to VERSION | status | force VERSION"
+
+// Migrate runs a migrate subcommand on the store and prints the version it leaves the schema at:
+// up applies every migration or the next N, down rolls back the last one or the last N, to
+// migrates up or down to the version and force records the version after a failed migration.
+// The first sqlite migration holds the whole schema up to the postgres 18, rolling it back drops everything
+func (app *App) Migrate(args []string, out io.Writer) error {
+	if len(args) == 0 || len(args) > 2 {
+		return errors.New(migrateUsage)
+	}
+
+	var arg *int
+	if len(args) == 2 {
+		n, err := strconv.Atoi(args[1])
+		if err != nil {
+			return fmt.Errorf("invalid number %q, %s", args[1], migrateUsage)
+		}
+		arg = &n
+	}
+
+	store, err := openStore(&app.TodoController)
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+
+	switch {
+	case args[0] == "up" && arg == nil:
+		err = store.Migrate()
+	case args[0] == "up" && *arg > 0:
+		err = store.MigrateSteps(*arg)
+	case args[0] == "down" && arg == nil:
+		err = store.MigrateSteps(-1)
+	case args[0] == "down" && *arg > 0:
+		err = store.MigrateSteps(-*arg)
+	case args[0] == "to" && arg != nil && *arg >= 0:
+		err = store.MigrateTo(uint(*arg))
+	case args[0] == "force" && arg != nil && *arg >= -1:
+		err = store.ForceMigration(*arg)
+	case args[0] == "status" && arg == nil:
+	default:
+		return errors.New(migrateUsage)
+	}
+	if err != nil {
+		return err
+	}
+
+	status, err := store.MigrationStatus()
+	if err != nil {
+		return err
+	}
+	dirty := ""
+	if status.Dirty {
+		dirty = ", dirty"
+	}
+	fmt.Fprintf(out, "version %d of %d%s\n", status.Version, status.Latest, dirty)
+	return nil
+}
+
+// prepareSchema migrates the store on boot, or without auto migration makes sure that the
+// migrations the binary needs were run
+func prepareSchema(store db.Store, autoMigrate bool) error {
+	if autoMigrate {
+		return store.Migrate()
+	}
+
+	status, err := store.MigrationStatus()
+	if errors.Is(err, db.ErrNoMigrations) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if status.Dirty {
+		return fmt.Errorf("the migration to version %d failed halfway, fix the schema and run migrate force", status.Version)
+	}
+	if status.Version < status.Latest {
+		return fmt.Errorf("the schema is at version %d but version %d is needed, run migrate up", status.Version, status.Latest)
+	}
+	return nil
+}
@@ -0,0 +1,35 @@
+package models
+
+import "time"
+
+// the scopes of personal access tokens, sessions started with a password have every scope
+const (
+	ScopeTodosRead  = "todos:read"
+	ScopeTodosWrite = "todos:write"
+)
+
+type CreateAccessTokenRequest struct {
+	Name  *string `json:"name" validate:"required,gte=1,lte=100"`
+	Scope *string `json:"scope" validate:"required,oneof=todos:read todos:write"`
+	// ExpiresAt is optional, the token never expires without it
+	ExpiresAt *time.Time `json:"expiresAt"`
+}
+
+type AccessToken struct {
+	Id         int        `json:"id"`
+	Name       string     `json:"name"`
+	Scope      string     `json:"scope"`
+	ExpiresAt  *time.Time `json:"expiresAt,omitempty"`
+	LastUsedAt *time.Time `json:"lastUsedAt,omitempty"`
+	CreatedAt  time.Time  `json:"createdAt"`
+}
+
+// CreatedAccessToken is the only response carrying the token itself
+type CreatedAccessToken struct {
+	AccessToken
+	Token string `json:"token"`
+}
+
+type RevokeAccessTokenRequest struct {
+	Id *int `json:"id" validate:"required"`
+}
@@ -0,0 +1,41 @@
+package models
+
+import "time"
+
+type UserProfile struct {
+	Id          int    `json:"id"`
+	Login       string `json:"login"`
+	DisplayName string `json:"displayName"`
+	Email       string `json:"email"`
+	// TimeZone is an IANA time zone, the dates of the user are in the server time zone without it
+	TimeZone         string     `json:"timeZone"`
+	Locale           string     `json:"locale"`
+	TwoFactorEnabled bool       `json:"twoFactorEnabled"`
+	CreatedAt        time.Time  `json:"createdAt"`
+	LastLoginAt      *time.Time `json:"lastLoginAt,omitempty"`
+}
+
+// UpdateProfileRequest changes the fields that are set, an empty string clears a field
+type UpdateProfileRequest struct {
+	DisplayName *string `json:"displayName" validate:"omitempty,lte=100"`
+	Email       *string `json:"email" validate:"omitempty,lte=254"`
+	TimeZone    *string `json:"timeZone" validate:"omitempty,lte=64"`
+	Locale      *string `json:"locale" validate:"omitempty,lte=35"`
+}
+
+// UserExport is the archive of /users/me/export without its todos, they are streamed
+// after it in a "todos" array, the trashed ones included
+type UserExport struct {
+	ExportedAt   time.Time     `json:"exportedAt"`
+	Profile      UserProfile   `json:"profile"`
+	Lists        []List        `json:"lists"`
+	Tags         []Tag         `json:"tags"`
+	AccessTokens []AccessToken `json:"accessTokens"`
+}
+
+// DeleteAccountRequest confirms the deletion with the password, and with a code
+// when two-factor authentication is enabled
+type DeleteAccountRequest struct {
+	Password *string `json:"password" validate:"required,lte=50"`
+	Code     string  `json:"code" validate:"omitempty,lte=20"`
+}
@@ -0,0 +1,15 @@
+package models
+
+// PoolStats describe the connection pool of the store
+type PoolStats struct {
+	MaxOpenConnections int `json:"maxOpenConnections"`
+	OpenConnections    int `json:"openConnections"`
+	InUse              int `json:"inUse"`
+	Idle               int `json:"idle"`
+	// WaitCount is how many times a query waited for a connection, WaitDurationMs for how long in total
+	WaitCount         int64 `json:"waitCount"`
+	WaitDurationMs    int64 `json:"waitDurationMs"`
+	MaxIdleClosed     int64 `json:"maxIdleClosed"`
+	MaxIdleTimeClosed int64 `json:"maxIdleTimeClosed"`
+	MaxLifetimeClosed int64 `json:"maxLifetimeClosed"`
+}
@@ -0,0 +1,61 @@
+package models
+
+const (
+	BatchAdd    = "add"
+	BatchUpdate = "update"
+	BatchDelete = "delete"
+
+	BatchActionDelete     = "delete"
+	BatchActionComplete   = "complete"
+	BatchActionUncomplete = "uncomplete"
+
+	BatchModeAtomic     = "atomic"
+	BatchModeBestEffort = "bestEffort"
+)
+
+type BatchOperation struct {
+	Op string `json:"op" validate:"required,oneof=add update delete"`
+	// Todo is the todo to add or update
+	Todo *Todo `json:"todo"`
+	// Id is the todo to delete
+	Id *int `json:"id"`
+}
+
+// BatchAction applies to every todo matching the filter, e.g. deleting all completed todos
+type BatchAction struct {
+	Action string      `json:"action" validate:"required,oneof=delete complete uncomplete"`
+	Filter ListRequest `json:"filter"`
+}
+
+type BatchRequest struct {
+	// Mode is either "atomic" (default), where any failure rolls back the whole batch,
+	// or "bestEffort", where failed operations are skipped
+	Mode       string           `json:"mode" validate:"omitempty,oneof=atomic bestEffort"`
+	Operations []BatchOperation `json:"operations" validate:"lte=100"`
+	// Action runs after the operations
+	Action *BatchAction `json:"action"`
+}
+
+// Batch is a validated BatchRequest
+type Batch struct {
+	Operations []BatchOperation
+	// Indexes are the positions of the operations in the request
+	Indexes    []int
+	Action     string
+	Filter     *TodoFilter
+	BestEffort bool
+}
+
+type BatchOperationResult struct {
+	Index int    `json:"index"`
+	Ok    bool   `json:"ok"`
+	Todo  *Todo  `json:"todo,omitempty"`
+	Error string `json:"error,omitempty"`
+}
+
+type BatchResult struct {
+	Committed bool                   `json:"committed"`
+	Results   []BatchOperationResult `json:"results"`
+	// Affected counts the todos changed by the action
+	Affected int `json:"affected"`
+}
@@ -0,0 +1,87 @@
+package models
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math"
+	"strconv"
+	"time"
+)
+
+// Cursor points at the todo a keyset page starts after, or ends before when Before is set,
+// Value is the sort key of the todo
+type Cursor struct {
+	Id     int    `json:"id"`
+	Sort   string `json:"sort"`
+	Desc   bool   `json:"desc,omitempty"`
+	Value  string `json:"value"`
+	Before bool   `json:"before,omitempty"`
+}
+
+// CursorFor returns a cursor pointing at the todo in the given sort order
+func CursorFor(todo *Todo, sort string, desc bool, before bool) *Cursor {
+	res := &Cursor{Id: *todo.Id, Sort: sort, Desc: desc, Before: before}
+
+	switch sort {
+	case SortText:
+		res.Value = *todo.Text
+	case SortCreated:
+		res.Value = todo.CreatedAt.Format(time.RFC3339Nano)
+	case SortUpdated:
+		res.Value = todo.UpdatedAt.Format(time.RFC3339Nano)
+	case SortCompleted:
+		res.Value = strconv.FormatBool(*todo.Completed)
+	case SortPosition:
+		res.Value = strconv.Itoa(*todo.Position)
+	default:
+		res.Value = strconv.Itoa(*todo.Id)
+	}
+
+	return res
+}
+
+// Encode returns the opaque token handed out to clients
+func (c *Cursor) Encode() string {
+	res, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(res)
+}
+
+// DecodeCursor parses a token handed out by Encode, the value has to be a sort key of the
+// sort order of the cursor, so a tampered cursor never reaches the store
+func DecodeCursor(in string) (*Cursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(in)
+	if err != nil {
+		return nil, errInvalidCursor
+	}
+
+	res := &Cursor{}
+	if err := json.Unmarshal(raw, res); err != nil {
+		return nil, errInvalidCursor
+	}
+	if res.Id < 0 || res.Id > math.MaxInt32 || !validCursorValue(res.Sort, res.Value) {
+		return nil, errInvalidCursor
+	}
+	return res, nil
+}
+
+var errInvalidCursor = errors.New("invalid cursor")
+
+// validCursorValue tells whether the value is a sort key of the sort order, as CursorFor writes it
+func validCursorValue(sort string, value string) bool {
+	var err error
+	switch sort {
+	case SortText:
+	case SortCreated, SortUpdated:
+		_, err = time.Parse(time.RFC3339Nano, value)
+	case SortCompleted:
+		_, err = strconv.ParseBool(value)
+	case SortPosition:
+		_, err = strconv.ParseInt(value, 10, 64)
+	case SortId:
+		_, err = strconv.ParseInt(value, 10, 32)
+	default:
+		return false
+	}
+	return err == nil
+}
@@ -4,5 +4,40 @@ import "github.com/golang-jwt/jwt"
 
 type Claims struct {
 	UserID int `json:"UserID"`
+	// Purpose is empty for access tokens
+	Purpose string `json:"purpose,omitempty"`
 	jwt.StandardClaims
 }
+
+// TokenResponse is returned by the login and the refresh, ExpiresIn is the access token lifetime in seconds
+type TokenResponse struct {
+	AccessToken  string `json:"accessToken"`
+	RefreshToken string `json:"refreshToken"`
+	ExpiresIn    int    `json:"expiresIn"`
+}
+
+type RefreshRequest struct {
+	RefreshToken *string `json:"refreshToken" validate:"required"`
+}
+
+// LogoutRequest optionally carries the refresh token of the session to revoke it too
+type LogoutRequest struct {
+	RefreshToken string `json:"refreshToken"`
+}
+
+// JWKS is the JSON Web Key Set of the public keys verifying the tokens
+type JWKS struct {
+	Keys []JWK `json:"keys"`
+}
+
+// JWK is an RSA or an Ed25519 public key as described by RFC 7517 and RFC 8037
+type JWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+}
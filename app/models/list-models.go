@@ -0,0 +1,25 @@
+package models
+
+// ListInbox selects the todos that don't belong to any list
+const ListInbox = "inbox"
+
+type AddListRequest struct {
+	Name *string `json:"name" validate:"required,gte=1,lte=100"`
+}
+
+type List struct {
+	AddListRequest
+	Id *int `json:"id" validate:"required"`
+}
+
+type DeleteListRequest struct {
+	Id int `json:"id"`
+	// Cascade moves the todos of the list to the trash, otherwise they are moved to the inbox
+	Cascade bool `json:"cascade"`
+}
+
+type MoveTodoRequest struct {
+	Id *int `json:"id" validate:"required"`
+	// ListId is the target list, nil moves the todo to the inbox
+	ListId *int `json:"listId"`
+}
@@ -0,0 +1,15 @@
+package models
+
+const (
+	TagModeAny = "any"
+	TagModeAll = "all"
+)
+
+type AddTagRequest struct {
+	Name *string `json:"name" validate:"required,gte=1,lte=50"`
+}
+
+type Tag struct {
+	AddTagRequest
+	Id *int `json:"id" validate:"required"`
+}
@@ -1,22 +1,145 @@
 package models
 
+import "time"
+
+const (
+	DueOverdue = "overdue"
+	DueToday   = "today"
+
+	ViewTree = "tree"
+	ViewFlat = "flat"
+
+	SortId        = "id"
+	SortText      = "text"
+	SortCreated   = "created"
+	SortUpdated   = "updated"
+	SortCompleted = "completed"
+	SortPosition  = "position"
+)
+
 type AddTodoRequest struct {
-	Text      *string `json:"text" validate:"required,gte=3,lte=1000"`
-	Completed *bool   `json:"completed" validate:"required"`
+	Text      *string    `json:"text" validate:"required,gte=3,lte=1000"`
+	Completed *bool      `json:"completed" validate:"required"`
+	Due       *time.Time `json:"due,omitempty"`
+	// Tags are tag names, missing tags are created, nil keeps the tags of an updated todo
+	Tags []string `json:"tags" validate:"omitempty,lte=20,dive,gte=1,lte=50"`
+	// ListId is nil for the inbox, nil keeps the list of an updated todo
+	ListId *int `json:"listId"`
+	// ParentId makes the todo a subtask, it is only set when the todo is added
+	ParentId *int `json:"parentId"`
 }
 
 type Todo struct {
 	AddTodoRequest
 	Id *int `json:"id" validate:"required"`
+
+	// Position is the manual order of the todo, it is only changed by /todo/move
+	Position *int `json:"position,omitempty"`
+
+	CreatedAt *time.Time `json:"createdAt,omitempty"`
+	UpdatedAt *time.Time `json:"updatedAt,omitempty"`
+	// DeletedAt is only set for the todos in the trash
+	DeletedAt *time.Time `json:"deletedAt,omitempty"`
+
+	// CompleteChildren completes every descendant of a completed todo on update
+	CompleteChildren bool `json:"completeChildren,omitempty"`
+
+	// Children, Depth and Progress are only set by the tree and flat list views
+	Children []Todo    `json:"children,omitempty"`
+	Depth    *int      `json:"depth,omitempty"`
+	Progress *Progress `json:"progress,omitempty"`
+}
+
+// Progress counts the completed descendants of a todo
+type Progress struct {
+	Done  int `json:"done"`
+	Total int `json:"total"`
 }
 
 type TodoList struct {
-	List           []Todo `json:"list" validate:"required"`
-	Count          int    `json:"count" validate:"required"`
-	CompletedCount int    `json:"completedCount" validate:"required"`
+	List []Todo `json:"list" validate:"required"`
+	// Count, CompletedCount and OverdueCount count every todo matching the filter outside of
+	// the trash, not just the page, so without a filter they are the totals of the user
+	Count          int `json:"count" validate:"required"`
+	CompletedCount int `json:"completedCount" validate:"required"`
+	OverdueCount   int `json:"overdueCount" validate:"required"`
+
+	// NextCursor and PrevCursor are only set in the keyset mode
+	NextCursor string `json:"nextCursor,omitempty"`
+	PrevCursor string `json:"prevCursor,omitempty"`
 }
 
 type ListRequest struct {
+	// Start is the offset of the page, the keyset mode is used when it is omitted
 	Start string `json:"start" form:"start" query:"start"`
 	Count string `json:"count" form:"count" query:"count"`
+	// Cursor is a NextCursor or PrevCursor of the previous keyset page
+	Cursor string `json:"cursor" form:"cursor" query:"cursor"`
+
+	// Due is either "overdue" or "today"
+	Due string `json:"due" form:"due" query:"due" validate:"omitempty,oneof=overdue today"`
+	// DueFrom and DueTo are RFC 3339 timestamps or plain dates,
+	// a plain date in DueTo includes the whole day
+	DueFrom string `json:"dueFrom" form:"dueFrom" query:"dueFrom"`
+	DueTo   string `json:"dueTo" form:"dueTo" query:"dueTo"`
+
+	Tags []string `json:"tag" form:"tag" query:"tag" validate:"omitempty,dive,gte=1,lte=50"`
+	// TagMode is either "any" (default) or "all"
+	TagMode string `json:"tagMode" form:"tagMode" query:"tagMode" validate:"omitempty,oneof=any all"`
+	// ListId is either a list id or "inbox"
+	ListId string `json:"listId" form:"listId" query:"listId"`
+	// View is either "tree" to nest subtasks under their parents or "flat" to list them after
+	// their parents with a depth, both paginate over top level todos only
+	View string `json:"view" form:"view" query:"view" validate:"omitempty,oneof=tree flat"`
+
+	// Sort defaults to "position", the manual order
+	Sort      string `json:"sort" form:"sort" query:"sort" validate:"omitempty,oneof=position id text created updated completed"`
+	Order     string `json:"order" form:"order" query:"order" validate:"omitempty,oneof=asc desc"`
+	Completed string `json:"completed" form:"completed" query:"completed" validate:"omitempty,oneof=true false"`
+	// Query only keeps the todos containing it, ignoring the case
+	Query string `json:"q" form:"q" query:"q" validate:"omitempty,lte=100"`
+}
+
+// TodoFilter is a parsed ListRequest, DueFrom is inclusive and DueTo is exclusive
+type TodoFilter struct {
+	Overdue bool
+	DueFrom *time.Time
+	DueTo   *time.Time
+	Tags    []string
+	AllTags bool
+	ListId  *int
+	Inbox   bool
+	View    string
+
+	Completed *bool
+	Query     string
+
+	Sort string
+	Desc bool
+
+	Keyset bool
+	Cursor *Cursor
+}
+
+// ReorderTodoRequest places the todo right before or right after another todo
+type ReorderTodoRequest struct {
+	Id     *int `json:"id" validate:"required"`
+	Before *int `json:"before"`
+	After  *int `json:"after"`
+}
+
+type SearchRequest struct {
+	Query string `json:"q" form:"q" query:"q" validate:"required,lte=200"`
+	Count string `json:"count" form:"count" query:"count"`
+}
+
+type SearchHit struct {
+	Todo
+	Rank float64 `json:"rank"`
+	// Snippet is the HTML escaped text with the matches wrapped in <mark> tags
+	Snippet string `json:"snippet"`
+}
+
+type SearchResult struct {
+	List []SearchHit `json:"list" validate:"required"`
 }
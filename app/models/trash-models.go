@@ -0,0 +1,14 @@
+package models
+
+type TrashRequest struct {
+	Start string `json:"start" form:"start" query:"start"`
+	Count string `json:"count" form:"count" query:"count"`
+}
+
+type RestoreTodoRequest struct {
+	Id *int `json:"id" validate:"required"`
+}
+
+type EmptyTrashResult struct {
+	Deleted int `json:"deleted"`
+}
@@ -0,0 +1,36 @@
+package models
+
+// PurposeTwoFactor marks the intermediate token of a login waiting for its second factor
+const PurposeTwoFactor = "2fa"
+
+type TOTPEnrollment struct {
+	Secret string `json:"secret"`
+	// URI is the otpauth URI to show as a QR code
+	URI string `json:"uri"`
+}
+
+// TwoFactorCodeRequest carries either a TOTP code or a recovery code
+type TwoFactorCodeRequest struct {
+	Code *string `json:"code" validate:"required,lte=20"`
+}
+
+type DisableTwoFactorRequest struct {
+	Password *string `json:"password" validate:"required,lte=50"`
+	Code     *string `json:"code" validate:"required,lte=20"`
+}
+
+type RecoveryCodes struct {
+	RecoveryCodes []string `json:"recoveryCodes"`
+}
+
+// TwoFactorChallenge is returned by a login missing its second factor, the token
+// is exchanged along with the code at /users/login/2fa
+type TwoFactorChallenge struct {
+	Msg            string `json:"msg"`
+	TwoFactorToken string `json:"twoFactorToken"`
+}
+
+type LoginTwoFactorRequest struct {
+	TwoFactorToken *string `json:"twoFactorToken" validate:"required"`
+	Code           *string `json:"code" validate:"required,lte=20"`
+}
@@ -3,9 +3,33 @@ package models
 type LoginRequest struct {
 	Login    *string `json:"login" validate:"required,alphanum,gte=3,lte=50"`
 	Password *string `json:"password" validate:"required,lte=50"`
+	// Code is the TOTP or recovery code of a user with two-factor authentication
+	Code string `json:"code,omitempty" validate:"omitempty,lte=20"`
 }
 
 type RegisterRequest struct {
 	LoginRequest
 	Password2 *string `json:"password2" validate:"required"`
 }
+
+type ChangePasswordRequest struct {
+	OldPassword *string `json:"oldPassword" validate:"required,lte=50"`
+	Password    *string `json:"password" validate:"required,lte=50"`
+	Password2   *string `json:"password2" validate:"required"`
+}
+
+type ForgotPasswordRequest struct {
+	Login *string `json:"login" validate:"required,lte=50"`
+}
+
+type ResetPasswordRequest struct {
+	Token     *string `json:"token" validate:"required"`
+	Password  *string `json:"password" validate:"required,lte=50"`
+	Password2 *string `json:"password2" validate:"required"`
+}
+
+// UnlockRequest names the login and the IP to lift the blocks of, at least one is required
+type UnlockRequest struct {
+	Login string `json:"login" validate:"omitempty,lte=50"`
+	IP    string `json:"ip" validate:"omitempty,ip"`
+}
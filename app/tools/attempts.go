@@ -0,0 +1,36 @@
+package tools
+
+import "time"
+
+// AttemptPolicy tells how long a key is blocked after its consecutive failed attempts
+type AttemptPolicy struct {
+	// FreeAttempts are the failures allowed before the backoff starts
+	FreeAttempts int
+	// BaseDelay is the first backoff, it doubles with every further failure up to MaxDelay
+	BaseDelay time.Duration
+	MaxDelay  time.Duration
+	// LockoutAfter failures the key is locked for LockoutDuration, zero disables the lockout
+	LockoutAfter    int
+	LockoutDuration time.Duration
+	// Window is how long the failures are remembered after the last one
+	Window time.Duration
+}
+
+// BlockFor returns how long the key is blocked after its nth failure
+func (p AttemptPolicy) BlockFor(failures int) time.Duration {
+	if p.LockoutAfter > 0 && failures >= p.LockoutAfter {
+		return p.LockoutDuration
+	}
+	if failures <= p.FreeAttempts {
+		return 0
+	}
+
+	delay := p.BaseDelay
+	for i := p.FreeAttempts + 1; i < failures && delay < p.MaxDelay; i++ {
+		delay *= 2
+	}
+	if delay > p.MaxDelay {
+		delay = p.MaxDelay
+	}
+	return delay
+}
@@ -0,0 +1,192 @@
+package tools
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/ann-96/todo-go-backend/app/models"
+	"github.com/golang-jwt/jwt"
+)
+
+// Keyring holds the keys the JWTs are signed and verified with. Tokens are signed with the
+// signing key and carry its id as kid, they are verified with whichever key their kid names
+type Keyring struct {
+	signing *signingKey
+	keys    map[string]*signingKey
+}
+
+type signingKey struct {
+	id      string
+	method  jwt.SigningMethod
+	private crypto.PrivateKey
+	public  crypto.PublicKey
+	// retiresAt ends the verification with the key, zero keeps it
+	retiresAt time.Time
+}
+
+// NewHMACKeyring signs and verifies HS256 tokens with a shared secret, the tokens carry no kid
+// and no key is published, so only the holders of the secret can verify them
+func NewHMACKeyring(secret string) *Keyring {
+	key := &signingKey{method: jwt.SigningMethodHS256, private: []byte(secret), public: []byte(secret)}
+	return &Keyring{signing: key, keys: map[string]*signingKey{"": key}}
+}
+
+// publishedHMACSecret is the example secret of the repository, anyone can sign with it
+const publishedHMACSecret = "my-secret-key-my-secret-key-my-secret-key"
+
+// LoadKeyring reads the keys of the PEM files in dir, the kid of a key is its file name
+// without the extension. RSA keys sign RS256 tokens and Ed25519 keys sign EdDSA tokens.
+// A file holding a public key only verifies the tokens signed with the private key before.
+// Without dir the tokens are signed with the hmacSecret as NewHMACKeyring does. With dir the
+// hmacSecret signs nothing, it only verifies the HS256 tokens it signed before the switch
+// when hmacRetiresAt is set, and until then. The published example secret is refused.
+//
+// Switching from the hmacSecret to dir:
+//  1. add the key to dir, set it as the signing key, set hmacRetiresAt to the time of the
+//     restart plus the longest lifetime of the HS256 tokens and restart
+//  2. once hmacRetiresAt passed, the HS256 tokens are rejected and the secret can be dropped
+//
+// Rotating keys:
+//  1. add the new key to dir and restart, it is published at /.well-known/jwks.json
+//  2. once the verifiers have fetched it, make it the signing key and restart
+//  3. once the tokens of the old key expired, remove the old key and restart
+func LoadKeyring(dir string, signingId string, hmacSecret string, hmacRetiresAt time.Time) (*Keyring, error) {
+	if hmacSecret == publishedHMACSecret && (dir == "" || !hmacRetiresAt.IsZero()) {
+		return nil, errors.New("the example secret is public, set a secret of your own")
+	}
+	if dir == "" {
+		if hmacSecret == "" {
+			return nil, errors.New("either a secret or a keys dir is required")
+		}
+		return NewHMACKeyring(hmacSecret), nil
+	}
+
+	paths, err := filepath.Glob(filepath.Join(dir, "*.pem"))
+	if err != nil {
+		return nil, err
+	}
+	keyring := &Keyring{keys: map[string]*signingKey{}}
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		id := strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+		key, err := parseSigningKey(id, data)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		keyring.keys[id] = key
+	}
+
+	signing, ok := keyring.keys[signingId]
+	if !ok || signing.private == nil {
+		return nil, fmt.Errorf("no private key %q in %s", signingId, dir)
+	}
+	keyring.signing = signing
+
+	// the HS256 tokens carry no kid, so the secret takes the empty one
+	if _, ok := keyring.keys[""]; !ok && hmacSecret != "" && time.Now().Before(hmacRetiresAt) {
+		keyring.keys[""] = &signingKey{method: jwt.SigningMethodHS256, public: []byte(hmacSecret),
+			retiresAt: hmacRetiresAt}
+	}
+	return keyring, nil
+}
+
+// Sign returns the token of the claims signed with the signing key
+func (keyring *Keyring) Sign(claims jwt.Claims) (string, error) {
+	token := jwt.NewWithClaims(keyring.signing.method, claims)
+	if keyring.signing.id != "" {
+		token.Header["kid"] = keyring.signing.id
+	}
+	return token.SignedString(keyring.signing.private)
+}
+
+// Keyfunc finds the key of a token for jwt.Parse, the token must use the algorithm of its key
+func (keyring *Keyring) Keyfunc(token *jwt.Token) (interface{}, error) {
+	id, _ := token.Header["kid"].(string)
+	key, ok := keyring.keys[id]
+	if !ok {
+		return nil, fmt.Errorf("unknown key %q", id)
+	}
+	if token.Method.Alg() != key.method.Alg() {
+		return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+	}
+	if !key.retiresAt.IsZero() && time.Now().After(key.retiresAt) {
+		return nil, fmt.Errorf("the key %q is retired", id)
+	}
+	return key.public, nil
+}
+
+// JWKS returns the public keys in the JSON Web Key Set format, HMAC secrets are left out
+func (keyring *Keyring) JWKS() *models.JWKS {
+	res := &models.JWKS{Keys: []models.JWK{}}
+	for _, key := range keyring.keys {
+		jwk := models.JWK{Kid: key.id, Use: "sig", Alg: key.method.Alg()}
+		switch public := key.public.(type) {
+		case *rsa.PublicKey:
+			jwk.Kty = "RSA"
+			jwk.N = base64.RawURLEncoding.EncodeToString(public.N.Bytes())
+			jwk.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(public.E)).Bytes())
+		case ed25519.PublicKey:
+			jwk.Kty, jwk.Crv = "OKP", "Ed25519"
+			jwk.X = base64.RawURLEncoding.EncodeToString(public)
+		default:
+			continue
+		}
+		res.Keys = append(res.Keys, jwk)
+	}
+	sort.Slice(res.Keys, func(i, j int) bool { return res.Keys[i].Kid < res.Keys[j].Kid })
+	return res
+}
+
+// parseSigningKey accepts PKCS #8 and PKCS #1 private keys and PKIX public keys
+func parseSigningKey(id string, data []byte) (*signingKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("no PEM data")
+	}
+
+	var parsed interface{}
+	var err error
+	switch block.Type {
+	case "PRIVATE KEY":
+		parsed, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	case "RSA PRIVATE KEY":
+		parsed, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "PUBLIC KEY":
+		parsed, err = x509.ParsePKIXPublicKey(block.Bytes)
+	default:
+		return nil, fmt.Errorf("unsupported PEM block %q", block.Type)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	key := &signingKey{id: id}
+	switch parsed := parsed.(type) {
+	case *rsa.PrivateKey:
+		key.method, key.private, key.public = jwt.SigningMethodRS256, parsed, &parsed.PublicKey
+	case *rsa.PublicKey:
+		key.method, key.public = jwt.SigningMethodRS256, parsed
+	case ed25519.PrivateKey:
+		key.method, key.private, key.public = jwt.SigningMethodEdDSA, parsed, parsed.Public()
+	case ed25519.PublicKey:
+		key.method, key.public = jwt.SigningMethodEdDSA, parsed
+	default:
+		return nil, fmt.Errorf("unsupported key type %T, expected RSA or Ed25519", parsed)
+	}
+	return key, nil
+}
@@ -0,0 +1,57 @@
+package tools
+
+import (
+	"encoding/json"
+	"log"
+	"os"
+	"sync"
+	"time"
+)
+
+// Notifier delivers messages to the users, e.g. the password reset tokens
+type Notifier interface {
+	NotifyPasswordReset(login string, token string) error
+}
+
+// NewNotifier returns the notifier of the given kind, "file" appends the messages as JSON lines
+// to the file at path and anything else logs them, neither is meant for production
+func NewNotifier(kind string, path string) Notifier {
+	if kind == "file" {
+		return &FileNotifier{Path: path}
+	}
+	return &LogNotifier{}
+}
+
+type LogNotifier struct{}
+
+func (n *LogNotifier) NotifyPasswordReset(login string, token string) error {
+	log.Printf("Password reset token for %s: %s", login, token)
+	return nil
+}
+
+type FileNotifier struct {
+	Path string
+	mu   sync.Mutex
+}
+
+func (n *FileNotifier) NotifyPasswordReset(login string, token string) error {
+	return n.write(map[string]string{
+		"kind":  "passwordReset",
+		"login": login,
+		"token": token,
+		"time":  time.Now().Format(time.RFC3339),
+	})
+}
+
+func (n *FileNotifier) write(message interface{}) error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	f, err := os.OpenFile(n.Path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	return json.NewEncoder(f).Encode(message)
+}
@@ -0,0 +1,81 @@
+package tools
+
+import (
+	"crypto/md5"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+)
+
+// the argon2id parameters of new hashes, stored hashes with other parameters are upgraded on login
+const (
+	argon2Memory  = 64 * 1024
+	argon2Time    = 3
+	argon2Threads = 2
+	argon2SaltLen = 16
+	argon2KeyLen  = 32
+)
+
+var errInvalidHash = errors.New("invalid password hash")
+
+// HashPassword returns the argon2id hash of the password with a random salt
+// in the PHC string format, e.g. $argon2id$v=19$m=65536,t=3,p=2$<salt>$<hash>
+func HashPassword(password string) (string, error) {
+	salt := make([]byte, argon2SaltLen)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+	key := argon2.IDKey([]byte(password), salt, argon2Time, argon2Memory, argon2Threads, argon2KeyLen)
+
+	return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s", argon2.Version, argon2Memory, argon2Time, argon2Threads,
+		base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(key)), nil
+}
+
+// VerifyPassword checks the password against a hash made by HashPassword or a legacy salted MD5 hash,
+// rehash tells that the hash is outdated and should be replaced with a new one
+func VerifyPassword(password, hash string) (ok bool, rehash bool, err error) {
+	if !strings.HasPrefix(hash, "$") {
+		legacy := legacyMD5Hash(password)
+		return subtle.ConstantTimeCompare([]byte(legacy), []byte(hash)) == 1, true, nil
+	}
+
+	parts := strings.Split(hash, "$")
+	if len(parts) != 6 || parts[1] != "argon2id" {
+		return false, false, errInvalidHash
+	}
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return false, false, errInvalidHash
+	}
+	var memory, iterations uint32
+	var threads uint8
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &memory, &iterations, &threads); err != nil {
+		return false, false, errInvalidHash
+	}
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return false, false, errInvalidHash
+	}
+	key, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil {
+		return false, false, errInvalidHash
+	}
+
+	actual := argon2.IDKey([]byte(password), salt, iterations, memory, threads, uint32(len(key)))
+	ok = subtle.ConstantTimeCompare(actual, key) == 1
+	rehash = memory != argon2Memory || iterations != argon2Time || threads != argon2Threads ||
+		len(salt) != argon2SaltLen || len(key) != argon2KeyLen
+	return ok, rehash, nil
+}
+
+// legacyMD5Hash is how the passwords were hashed before argon2id
+func legacyMD5Hash(password string) string {
+	res := md5.Sum([]byte(fmt.Sprintf("salt_%s_salt", password)))
+	return hex.EncodeToString(res[:])
+}
@@ -0,0 +1,61 @@
+package tools_test
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"strings"
+	"testing"
+
+	"github.com/ann-96/todo-go-backend/app/tools"
+	"github.com/stretchr/testify/require"
+)
+
+func TestVerifyPassword(t *testing.T) {
+	password := "Str0ng-passw0rd"
+
+	hash, err := tools.HashPassword(password)
+	require.NoError(t, err)
+	require.True(t, strings.HasPrefix(hash, "$argon2id$v=19$m=65536,t=3,p=2$"), hash)
+	other, err := tools.HashPassword(password)
+	require.NoError(t, err)
+	require.NotEqual(t, hash, other, "the salt is random")
+
+	ok, rehash, err := tools.VerifyPassword(password, hash)
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.False(t, rehash)
+	ok, rehash, err = tools.VerifyPassword("wrong"+password, hash)
+	require.NoError(t, err)
+	require.False(t, ok)
+	require.False(t, rehash)
+
+	// a hash with weaker parameters verifies and asks to be replaced
+	weak := "$argon2id$v=19$m=16,t=1,p=1$c2FsdHNhbHQ$mLQ1JoIER+2lxMaSesjqeQ"
+	ok, rehash, err = tools.VerifyPassword("password", weak)
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.True(t, rehash)
+
+	// the legacy salted MD5 hashes always ask to be replaced
+	legacy := md5.Sum([]byte("salt_" + password + "_salt"))
+	legacyHash := hex.EncodeToString(legacy[:])
+	ok, rehash, err = tools.VerifyPassword(password, legacyHash)
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.True(t, rehash)
+	ok, _, err = tools.VerifyPassword("wrong"+password, legacyHash)
+	require.NoError(t, err)
+	require.False(t, ok)
+
+	for _, malformed := range []string{
+		"$bcrypt$v=19$m=65536,t=3,p=2$c2FsdA$a2V5",
+		"$argon2id$v=16$m=65536,t=3,p=2$c2FsdA$a2V5",
+		"$argon2id$v=19$m=lots,t=3,p=2$c2FsdA$a2V5",
+		"$argon2id$v=19$m=65536,t=3,p=2$not base64!$a2V5",
+		"$argon2id$v=19$m=65536,t=3,p=2$c2FsdA",
+	} {
+		ok, _, err := tools.VerifyPassword(password, malformed)
+		require.Error(t, err, malformed)
+		require.False(t, ok, malformed)
+	}
+}
@@ -0,0 +1,20 @@
+package tools
+
+import (
+	"strings"
+	"unicode"
+)
+
+const maxSearchTerms = 10
+
+// SearchTerms splits a search query into lower case words, everything but letters and digits
+// is dropped so the terms are safe to put into a tsquery
+func SearchTerms(query string) []string {
+	words := strings.FieldsFunc(strings.ToLower(query), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	if len(words) > maxSearchTerms {
+		words = words[:maxSearchTerms]
+	}
+	return words
+}
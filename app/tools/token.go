@@ -0,0 +1,42 @@
+package tools
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"strings"
+)
+
+const opaqueTokenLen = 32
+
+// AccessTokenPrefix tells personal access tokens from JWTs and makes them easy to spot in leaked text
+const AccessTokenPrefix = "tdp_"
+
+// NewOpaqueToken returns a random URL safe token, only its HashToken is meant to be stored
+func NewOpaqueToken() (string, error) {
+	token := make([]byte, opaqueTokenLen)
+	if _, err := rand.Read(token); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(token), nil
+}
+
+// HashToken returns the SHA-256 of an opaque token, a random token needs no salt
+func HashToken(token string) string {
+	res := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(res[:])
+}
+
+// NewAccessToken returns a personal access token, an opaque token with the AccessTokenPrefix
+func NewAccessToken() (string, error) {
+	token, err := NewOpaqueToken()
+	if err != nil {
+		return "", err
+	}
+	return AccessTokenPrefix + token, nil
+}
+
+func IsAccessToken(token string) bool {
+	return strings.HasPrefix(token, AccessTokenPrefix)
+}
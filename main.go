@@ -1,8 +1,16 @@
 package main
 
 import (
+	"fmt"
+	"os"
+	"time"
+
+	// the time zones of the users are loaded in images without a time zone database too
+	_ "time/tzdata"
+
 	"github.com/ann-96/todo-go-backend/app"
 	"github.com/ann-96/todo-go-backend/app/controllers"
+	"github.com/ann-96/todo-go-backend/app/tools"
 	"github.com/spf13/viper"
 )
 
@@ -13,25 +21,143 @@ func main() {
 	viper.SetDefault("TODO_HTTP_PORT", "8080")
 	viper.SetDefault("USER_HTTP_HOST", "localhost")
 	viper.SetDefault("USER_HTTP_PORT", "9080")
+	viper.SetDefault("STORAGE_DRIVER", "postgres")
+	viper.SetDefault("SQLITE_PATH", "todos.db")
 	viper.SetDefault("SQL_HOST", "localhost")
 	viper.SetDefault("SQL_PORT", "5432")
 	viper.SetDefault("SQL_USER", "postgres")
 	viper.SetDefault("SQL_PASS", "postgres")
 	viper.SetDefault("SQL_DBNAME", "postgres")
-	viper.SetDefault("JWT_KEY", "my-secret-key-my-secret-key-my-secret-key")
+	viper.SetDefault("SQL_DSN", "")
+	viper.SetDefault("SQL_SSLMODE", "")
+	viper.SetDefault("SQL_SSLROOTCERT", "")
+	viper.SetDefault("SQL_SSLCERT", "")
+	viper.SetDefault("SQL_SSLKEY", "")
+	viper.SetDefault("SQL_MAX_OPEN_CONNS", 20)
+	viper.SetDefault("SQL_MAX_IDLE_CONNS", 10)
+	viper.SetDefault("SQL_CONN_MAX_LIFETIME", "30m")
+	viper.SetDefault("SQL_CONN_MAX_IDLE_TIME", "5m")
+	viper.SetDefault("SQL_CONNECT_RETRIES", 5)
+	viper.SetDefault("SQL_CONNECT_BACKOFF", "1s")
+	viper.SetDefault("AUTO_MIGRATE", true)
+	viper.SetDefault("JWT_KEY", "")
+	viper.SetDefault("JWT_KEY_RETIRES_AT", "")
+	viper.SetDefault("JWT_KEYS_DIR", "")
+	viper.SetDefault("JWT_SIGNING_KEY", "")
+	viper.SetDefault("MAX_PAGE_SIZE", 100)
+	viper.SetDefault("QUERY_TIMEOUT", "10s")
+	viper.SetDefault("QUERY_TIMEOUTS", "/users/me/export=0")
+	viper.SetDefault("TRASH_RETENTION", "720h")
+	viper.SetDefault("TRASH_PURGE_INTERVAL", "1h")
+	viper.SetDefault("TOKEN_PRUNE_INTERVAL", "1h")
+	viper.SetDefault("ACCESS_TOKEN_TTL", "15m")
+	viper.SetDefault("REFRESH_TOKEN_TTL", "720h")
+	viper.SetDefault("PASSWORD_RESET_TTL", "1h")
+	viper.SetDefault("LOGIN_LOCKOUT_THRESHOLD", 10)
+	viper.SetDefault("LOGIN_LOCKOUT_DURATION", "15m")
+	viper.SetDefault("ADMIN_TOKEN", "")
+	viper.SetDefault("NOTIFIER", "log")
+	viper.SetDefault("NOTIFIER_FILE", "notifications.jsonl")
 
+	viper.BindEnv("STORAGE_DRIVER")
+	viper.BindEnv("SQLITE_PATH")
 	viper.BindEnv("SQL_HOST")
 	viper.BindEnv("SQL_PORT")
 	viper.BindEnv("SQL_USER")
 	viper.BindEnv("SQL_PASS")
 	viper.BindEnv("SQL_DBNAME")
+	viper.BindEnv("SQL_DSN")
+	viper.BindEnv("SQL_SSLMODE")
+	viper.BindEnv("SQL_SSLROOTCERT")
+	viper.BindEnv("SQL_SSLCERT")
+	viper.BindEnv("SQL_SSLKEY")
+	viper.BindEnv("SQL_MAX_OPEN_CONNS")
+	viper.BindEnv("SQL_MAX_IDLE_CONNS")
+	viper.BindEnv("SQL_CONN_MAX_LIFETIME")
+	viper.BindEnv("SQL_CONN_MAX_IDLE_TIME")
+	viper.BindEnv("SQL_CONNECT_RETRIES")
+	viper.BindEnv("SQL_CONNECT_BACKOFF")
+	viper.BindEnv("AUTO_MIGRATE")
 	viper.BindEnv("JWT_KEY")
+	viper.BindEnv("JWT_KEY_RETIRES_AT")
+	viper.BindEnv("JWT_KEYS_DIR")
+	viper.BindEnv("JWT_SIGNING_KEY")
+	viper.BindEnv("MAX_PAGE_SIZE")
+	viper.BindEnv("QUERY_TIMEOUT")
+	viper.BindEnv("QUERY_TIMEOUTS")
+	viper.BindEnv("TRASH_RETENTION")
+	viper.BindEnv("TRASH_PURGE_INTERVAL")
+	viper.BindEnv("TOKEN_PRUNE_INTERVAL")
+	viper.BindEnv("ACCESS_TOKEN_TTL")
+	viper.BindEnv("REFRESH_TOKEN_TTL")
+	viper.BindEnv("PASSWORD_RESET_TTL")
+	viper.BindEnv("LOGIN_LOCKOUT_THRESHOLD")
+	viper.BindEnv("LOGIN_LOCKOUT_DURATION")
+	viper.BindEnv("ADMIN_TOKEN")
+	viper.BindEnv("NOTIFIER")
+	viper.BindEnv("NOTIFIER_FILE")
+	commonSettings.StorageDriver = viper.GetString("STORAGE_DRIVER")
+	commonSettings.SqlitePath = viper.GetString("SQLITE_PATH")
 	commonSettings.SqlHost = viper.GetString("SQL_HOST")
 	commonSettings.SqlPort = viper.GetString("SQL_PORT")
 	commonSettings.SqlUser = viper.GetString("SQL_USER")
 	commonSettings.SqlPass = viper.GetString("SQL_PASS")
 	commonSettings.SqlName = viper.GetString("SQL_DBNAME")
+	commonSettings.SqlDSN = viper.GetString("SQL_DSN")
+	commonSettings.SqlSSLMode = viper.GetString("SQL_SSLMODE")
+	commonSettings.SqlSSLRootCert = viper.GetString("SQL_SSLROOTCERT")
+	commonSettings.SqlSSLCert = viper.GetString("SQL_SSLCERT")
+	commonSettings.SqlSSLKey = viper.GetString("SQL_SSLKEY")
+	commonSettings.SqlMaxOpenConns = viper.GetInt("SQL_MAX_OPEN_CONNS")
+	commonSettings.SqlMaxIdleConns = viper.GetInt("SQL_MAX_IDLE_CONNS")
+	commonSettings.SqlConnMaxLifetime = viper.GetDuration("SQL_CONN_MAX_LIFETIME")
+	commonSettings.SqlConnMaxIdleTime = viper.GetDuration("SQL_CONN_MAX_IDLE_TIME")
+	commonSettings.SqlConnectRetries = viper.GetInt("SQL_CONNECT_RETRIES")
+	commonSettings.SqlConnectBackoff = viper.GetDuration("SQL_CONNECT_BACKOFF")
+	commonSettings.AutoMigrate = viper.GetBool("AUTO_MIGRATE")
+
+	// migrate up, down, to, status or force runs the migrations instead of the services, it only
+	// needs the storage settings so a broken key or notifier setup doesn't hold it up
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		app.TodoController = commonSettings
+		if err := app.Migrate(os.Args[2:], os.Stdout); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+	}
+
 	commonSettings.JwtKey = viper.GetString("JWT_KEY")
+	commonSettings.MaxPageSize = viper.GetInt("MAX_PAGE_SIZE")
+	commonSettings.QueryTimeout = viper.GetDuration("QUERY_TIMEOUT")
+	queryTimeouts, err := controllers.ParseQueryTimeouts(viper.GetString("QUERY_TIMEOUTS"))
+	if err != nil {
+		panic(err)
+	}
+	commonSettings.QueryTimeouts = queryTimeouts
+	commonSettings.TrashRetention = viper.GetDuration("TRASH_RETENTION")
+	commonSettings.TrashPurgeInterval = viper.GetDuration("TRASH_PURGE_INTERVAL")
+	commonSettings.TokenPruneInterval = viper.GetDuration("TOKEN_PRUNE_INTERVAL")
+	commonSettings.AccessTokenTTL = viper.GetDuration("ACCESS_TOKEN_TTL")
+	// the tokens signed with the JWT_KEY before the switch to the JWT_KEYS_DIR stay valid
+	// until JWT_KEY_RETIRES_AT, an RFC 3339 timestamp
+	var jwtKeyRetiresAt time.Time
+	if retiresAt := viper.GetString("JWT_KEY_RETIRES_AT"); retiresAt != "" {
+		if jwtKeyRetiresAt, err = time.Parse(time.RFC3339, retiresAt); err != nil {
+			panic(fmt.Errorf("invalid JWT_KEY_RETIRES_AT: %w", err))
+		}
+	}
+	keys, err := tools.LoadKeyring(viper.GetString("JWT_KEYS_DIR"), viper.GetString("JWT_SIGNING_KEY"), commonSettings.JwtKey, jwtKeyRetiresAt)
+	if err != nil {
+		panic(err)
+	}
+	commonSettings.Keys = keys
+	commonSettings.RefreshTokenTTL = viper.GetDuration("REFRESH_TOKEN_TTL")
+	commonSettings.PasswordResetTTL = viper.GetDuration("PASSWORD_RESET_TTL")
+	commonSettings.LoginLockoutThreshold = viper.GetInt("LOGIN_LOCKOUT_THRESHOLD")
+	commonSettings.LoginLockoutDuration = viper.GetDuration("LOGIN_LOCKOUT_DURATION")
+	commonSettings.AdminToken = viper.GetString("ADMIN_TOKEN")
+	commonSettings.Notifier = tools.NewNotifier(viper.GetString("NOTIFIER"), viper.GetString("NOTIFIER_FILE"))
 
 	app.UserController = commonSettings
 	app.TodoController = commonSettings
@@ -0,0 +1,6 @@
+DELETE FROM todos WHERE deleted_at IS NOT NULL;
+
+DROP INDEX todos_deleted_at_idx;
+
+ALTER TABLE todos
+  DROP COLUMN deleted_at;
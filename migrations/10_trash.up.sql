@@ -0,0 +1,4 @@
+ALTER TABLE todos
+  ADD deleted_at TIMESTAMPTZ NULL;
+
+CREATE INDEX todos_deleted_at_idx ON todos (deleted_at) WHERE deleted_at IS NOT NULL;
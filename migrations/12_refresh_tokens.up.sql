@@ -0,0 +1,15 @@
+CREATE TABLE refresh_tokens (
+  id         SERIAL      PRIMARY KEY,
+  userid     INTEGER     NOT NULL,
+  family_id  TEXT        NOT NULL,
+  token_hash TEXT        UNIQUE NOT NULL,
+  expires_at TIMESTAMPTZ NOT NULL,
+  used_at    TIMESTAMPTZ NULL,
+  revoked_at TIMESTAMPTZ NULL,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+  CONSTRAINT refresh_tokens_users_fkey
+    FOREIGN KEY (userid) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE INDEX refresh_tokens_family_id_idx ON refresh_tokens (family_id);
+CREATE INDEX refresh_tokens_expires_at_idx ON refresh_tokens (expires_at);
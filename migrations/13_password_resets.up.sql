@@ -0,0 +1,12 @@
+CREATE TABLE password_resets (
+  id         SERIAL      PRIMARY KEY,
+  userid     INTEGER     NOT NULL,
+  token_hash TEXT        UNIQUE NOT NULL,
+  expires_at TIMESTAMPTZ NOT NULL,
+  used_at    TIMESTAMPTZ NULL,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+  CONSTRAINT password_resets_users_fkey
+    FOREIGN KEY (userid) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE INDEX password_resets_userid_idx ON password_resets (userid);
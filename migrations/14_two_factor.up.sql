@@ -0,0 +1,20 @@
+ALTER TABLE users
+  ADD totp_secret TEXT NULL;
+
+ALTER TABLE users
+  ADD totp_enabled BOOLEAN NOT NULL DEFAULT false;
+
+-- the last accepted TOTP period, a code can't be used twice
+ALTER TABLE users
+  ADD totp_last_step BIGINT NOT NULL DEFAULT 0;
+
+CREATE TABLE recovery_codes (
+  id        SERIAL      PRIMARY KEY,
+  userid    INTEGER     NOT NULL,
+  code_hash TEXT        NOT NULL,
+  used_at   TIMESTAMPTZ NULL,
+  CONSTRAINT recovery_codes_users_fkey
+    FOREIGN KEY (userid) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE INDEX recovery_codes_userid_idx ON recovery_codes (userid);
@@ -0,0 +1,14 @@
+CREATE TABLE access_tokens (
+  id           SERIAL      PRIMARY KEY,
+  userid       INTEGER     NOT NULL,
+  name         TEXT        NOT NULL,
+  token_hash   TEXT        UNIQUE NOT NULL,
+  scope        TEXT        NOT NULL,
+  expires_at   TIMESTAMPTZ NULL,
+  last_used_at TIMESTAMPTZ NULL,
+  created_at   TIMESTAMPTZ NOT NULL DEFAULT now(),
+  CONSTRAINT access_tokens_users_fkey
+    FOREIGN KEY (userid) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE INDEX access_tokens_userid_idx ON access_tokens (userid);
@@ -0,0 +1,9 @@
+-- the failed attempts of the keys limited by the AttemptLimiter, e.g. "ip:192.0.2.1" or "login:alice"
+CREATE TABLE login_attempts (
+  key             TEXT        PRIMARY KEY,
+  failures        INTEGER     NOT NULL,
+  last_failure_at TIMESTAMPTZ NOT NULL,
+  blocked_until   TIMESTAMPTZ NULL
+);
+
+CREATE INDEX login_attempts_last_failure_at_idx ON login_attempts (last_failure_at);
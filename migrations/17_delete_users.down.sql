@@ -0,0 +1,8 @@
+DROP TABLE revoked_users;
+
+ALTER TABLE todos
+  DROP CONSTRAINT todos_users_fkey;
+
+ALTER TABLE todos
+  ADD CONSTRAINT todos_users_fkey
+    FOREIGN KEY (userid) REFERENCES users(id);
@@ -0,0 +1,14 @@
+ALTER TABLE todos
+  DROP CONSTRAINT todos_users_fkey;
+
+ALTER TABLE todos
+  ADD CONSTRAINT todos_users_fkey
+    FOREIGN KEY (userid) REFERENCES users(id) ON DELETE CASCADE;
+
+-- the tokens of the deleted users are rejected until they expire
+CREATE TABLE revoked_users (
+  userid     INTEGER     PRIMARY KEY,
+  expires_at TIMESTAMPTZ NOT NULL
+);
+
+CREATE INDEX revoked_users_expires_at_idx ON revoked_users (expires_at);
@@ -0,0 +1,17 @@
+ALTER TABLE users
+  DROP COLUMN last_login_at;
+
+ALTER TABLE users
+  DROP COLUMN created_at;
+
+ALTER TABLE users
+  DROP COLUMN locale;
+
+ALTER TABLE users
+  DROP COLUMN time_zone;
+
+ALTER TABLE users
+  DROP COLUMN email;
+
+ALTER TABLE users
+  DROP COLUMN display_name;
@@ -0,0 +1,18 @@
+ALTER TABLE users
+  ADD display_name TEXT NULL;
+
+ALTER TABLE users
+  ADD email TEXT NULL;
+
+-- an IANA time zone like Europe/Paris, the dates of the users without one are in the server time zone
+ALTER TABLE users
+  ADD time_zone TEXT NULL;
+
+ALTER TABLE users
+  ADD locale TEXT NULL;
+
+ALTER TABLE users
+  ADD created_at TIMESTAMPTZ NOT NULL DEFAULT now();
+
+ALTER TABLE users
+  ADD last_login_at TIMESTAMPTZ NULL;
@@ -0,0 +1,4 @@
+DROP INDEX todos_userid_due_idx;
+
+ALTER TABLE todos
+  DROP COLUMN due;
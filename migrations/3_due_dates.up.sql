@@ -0,0 +1,4 @@
+ALTER TABLE todos
+  ADD due TIMESTAMPTZ NULL;
+
+CREATE INDEX todos_userid_due_idx ON todos (userid, due);
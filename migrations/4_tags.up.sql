@@ -0,0 +1,20 @@
+CREATE TABLE tags (
+  id     SERIAL  PRIMARY KEY,
+  userid INTEGER NOT NULL,
+  name   TEXT    NOT NULL,
+  CONSTRAINT tags_userid_name_key UNIQUE (userid, name),
+  CONSTRAINT tags_users_fkey
+    FOREIGN KEY (userid) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE TABLE todo_tags (
+  todoid INTEGER NOT NULL,
+  tagid  INTEGER NOT NULL,
+  PRIMARY KEY (todoid, tagid),
+  CONSTRAINT todo_tags_todos_fkey
+    FOREIGN KEY (todoid) REFERENCES todos(id) ON DELETE CASCADE,
+  CONSTRAINT todo_tags_tags_fkey
+    FOREIGN KEY (tagid) REFERENCES tags(id) ON DELETE CASCADE
+);
+
+CREATE INDEX todo_tags_tagid_idx ON todo_tags (tagid);
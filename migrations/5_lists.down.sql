@@ -0,0 +1,9 @@
+DROP INDEX todos_list_id_idx;
+
+ALTER TABLE todos 
+  DROP CONSTRAINT todos_lists_fkey;
+
+ALTER TABLE todos
+  DROP COLUMN list_id;
+
+DROP TABLE lists;
@@ -0,0 +1,18 @@
+CREATE TABLE lists (
+  id     SERIAL  PRIMARY KEY,
+  userid INTEGER NOT NULL,
+  name   TEXT    NOT NULL,
+  CONSTRAINT lists_users_fkey
+    FOREIGN KEY (userid) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE INDEX lists_userid_idx ON lists (userid);
+
+ALTER TABLE todos
+  ADD list_id INTEGER NULL;
+
+ALTER TABLE todos
+  ADD CONSTRAINT todos_lists_fkey
+    FOREIGN KEY (list_id) REFERENCES lists(id) ON DELETE SET NULL;
+
+CREATE INDEX todos_list_id_idx ON todos (list_id);
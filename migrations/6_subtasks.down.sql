@@ -0,0 +1,7 @@
+DROP INDEX todos_parent_id_idx;
+
+ALTER TABLE todos 
+  DROP CONSTRAINT todos_parent_fkey;
+
+ALTER TABLE todos
+  DROP COLUMN parent_id;
@@ -0,0 +1,8 @@
+ALTER TABLE todos
+  ADD parent_id INTEGER NULL;
+
+ALTER TABLE todos
+  ADD CONSTRAINT todos_parent_fkey
+    FOREIGN KEY (parent_id) REFERENCES todos(id) ON DELETE CASCADE;
+
+CREATE INDEX todos_parent_id_idx ON todos (parent_id);
@@ -0,0 +1,5 @@
+ALTER TABLE todos
+  DROP COLUMN updated_at;
+
+ALTER TABLE todos
+  DROP COLUMN created_at;
@@ -0,0 +1,5 @@
+ALTER TABLE todos
+  ADD created_at TIMESTAMPTZ NOT NULL DEFAULT now();
+
+ALTER TABLE todos
+  ADD updated_at TIMESTAMPTZ NOT NULL DEFAULT now();
@@ -0,0 +1,4 @@
+ALTER TABLE todos
+  ADD search TSVECTOR GENERATED ALWAYS AS (to_tsvector('simple', task)) STORED;
+
+CREATE INDEX todos_search_idx ON todos USING GIN (search);
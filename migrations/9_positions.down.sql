@@ -0,0 +1,4 @@
+DROP INDEX todos_userid_position_idx;
+
+ALTER TABLE todos
+  DROP COLUMN position;
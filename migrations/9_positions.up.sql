@@ -0,0 +1,10 @@
+ALTER TABLE todos
+  ADD position BIGINT;
+
+-- id is an integer, the product only fits once it is a bigint
+UPDATE todos SET position = id::bigint * 1024;
+
+ALTER TABLE todos
+  ALTER COLUMN position SET NOT NULL;
+
+CREATE INDEX todos_userid_position_idx ON todos (userid, position);
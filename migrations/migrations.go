@@ -0,0 +1,9 @@
+// Package migrations embeds the schema migrations into the binary
+package migrations
+
+import "embed"
+
+// FS holds the postgres migrations at its root and the sqlite ones in the sqlite directory
+//
+//go:embed *.sql sqlite/*.sql
+var FS embed.FS
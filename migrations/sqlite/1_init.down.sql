@@ -0,0 +1,16 @@
+DROP TABLE login_attempts;
+DROP TABLE access_tokens;
+DROP TABLE recovery_codes;
+DROP TABLE password_resets;
+DROP TABLE refresh_tokens;
+DROP TABLE revoked_users;
+DROP TABLE revoked_tokens;
+DROP TABLE todo_tags;
+DROP TABLE tags;
+DROP TRIGGER todos_fts_update;
+DROP TRIGGER todos_fts_delete;
+DROP TRIGGER todos_fts_insert;
+DROP TABLE todos_fts;
+DROP TABLE todos;
+DROP TABLE lists;
+DROP TABLE users;
@@ -0,0 +1,151 @@
+-- the schema of the postgres migrations up to 18_profiles, the times are unix microseconds
+CREATE TABLE users (
+  id             INTEGER PRIMARY KEY AUTOINCREMENT,
+  login          TEXT    UNIQUE NOT NULL,
+  passwordhash   TEXT    NOT NULL,
+  totp_secret    TEXT    NULL,
+  totp_enabled   INTEGER NOT NULL DEFAULT 0,
+  totp_last_step INTEGER NOT NULL DEFAULT 0,
+  display_name   TEXT    NULL,
+  email          TEXT    NULL,
+  time_zone      TEXT    NULL,
+  locale         TEXT    NULL,
+  created_at     INTEGER NOT NULL,
+  last_login_at  INTEGER NULL
+);
+
+CREATE TABLE lists (
+  id     INTEGER PRIMARY KEY AUTOINCREMENT,
+  userid INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+  name   TEXT    NOT NULL
+);
+
+CREATE INDEX lists_userid_idx ON lists (userid);
+
+CREATE TABLE todos (
+  id         INTEGER PRIMARY KEY AUTOINCREMENT,
+  userid     INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+  task       TEXT    NOT NULL,
+  completed  INTEGER NOT NULL,
+  due        INTEGER NULL,
+  list_id    INTEGER NULL REFERENCES lists(id) ON DELETE SET NULL,
+  parent_id  INTEGER NULL REFERENCES todos(id) ON DELETE CASCADE,
+  position   INTEGER NOT NULL,
+  created_at INTEGER NOT NULL,
+  updated_at INTEGER NOT NULL,
+  deleted_at INTEGER NULL
+);
+
+CREATE INDEX todos_userid_due_idx ON todos (userid, due);
+CREATE INDEX todos_list_id_idx ON todos (list_id);
+CREATE INDEX todos_parent_id_idx ON todos (parent_id);
+CREATE INDEX todos_userid_position_idx ON todos (userid, position);
+CREATE INDEX todos_deleted_at_idx ON todos (deleted_at) WHERE deleted_at IS NOT NULL;
+
+-- the search index of the task texts, kept in sync by the triggers
+CREATE VIRTUAL TABLE todos_fts USING fts5(
+  task,
+  content='todos',
+  content_rowid='id',
+  tokenize='unicode61 remove_diacritics 0'
+);
+
+CREATE TRIGGER todos_fts_insert AFTER INSERT ON todos BEGIN
+  INSERT INTO todos_fts(rowid, task) VALUES (new.id, new.task);
+END;
+
+CREATE TRIGGER todos_fts_delete AFTER DELETE ON todos BEGIN
+  INSERT INTO todos_fts(todos_fts, rowid, task) VALUES ('delete', old.id, old.task);
+END;
+
+CREATE TRIGGER todos_fts_update AFTER UPDATE OF task ON todos BEGIN
+  INSERT INTO todos_fts(todos_fts, rowid, task) VALUES ('delete', old.id, old.task);
+  INSERT INTO todos_fts(rowid, task) VALUES (new.id, new.task);
+END;
+
+CREATE TABLE tags (
+  id     INTEGER PRIMARY KEY AUTOINCREMENT,
+  userid INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+  name   TEXT    NOT NULL,
+  UNIQUE (userid, name)
+);
+
+CREATE TABLE todo_tags (
+  todoid INTEGER NOT NULL REFERENCES todos(id) ON DELETE CASCADE,
+  tagid  INTEGER NOT NULL REFERENCES tags(id) ON DELETE CASCADE,
+  PRIMARY KEY (todoid, tagid)
+);
+
+CREATE INDEX todo_tags_tagid_idx ON todo_tags (tagid);
+
+CREATE TABLE revoked_tokens (
+  jti        TEXT    PRIMARY KEY,
+  expires_at INTEGER NOT NULL
+);
+
+CREATE INDEX revoked_tokens_expires_at_idx ON revoked_tokens (expires_at);
+
+-- the tokens of the deleted users are rejected until they expire
+CREATE TABLE revoked_users (
+  userid     INTEGER PRIMARY KEY,
+  expires_at INTEGER NOT NULL
+);
+
+CREATE INDEX revoked_users_expires_at_idx ON revoked_users (expires_at);
+
+CREATE TABLE refresh_tokens (
+  id         INTEGER PRIMARY KEY AUTOINCREMENT,
+  userid     INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+  family_id  TEXT    NOT NULL,
+  token_hash TEXT    UNIQUE NOT NULL,
+  expires_at INTEGER NOT NULL,
+  used_at    INTEGER NULL,
+  revoked_at INTEGER NULL,
+  created_at INTEGER NOT NULL
+);
+
+CREATE INDEX refresh_tokens_family_id_idx ON refresh_tokens (family_id);
+CREATE INDEX refresh_tokens_expires_at_idx ON refresh_tokens (expires_at);
+
+CREATE TABLE password_resets (
+  id         INTEGER PRIMARY KEY AUTOINCREMENT,
+  userid     INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+  token_hash TEXT    UNIQUE NOT NULL,
+  expires_at INTEGER NOT NULL,
+  used_at    INTEGER NULL,
+  created_at INTEGER NOT NULL
+);
+
+CREATE INDEX password_resets_userid_idx ON password_resets (userid);
+
+CREATE TABLE recovery_codes (
+  id        INTEGER PRIMARY KEY AUTOINCREMENT,
+  userid    INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+  code_hash TEXT    NOT NULL,
+  used_at   INTEGER NULL
+);
+
+CREATE INDEX recovery_codes_userid_idx ON recovery_codes (userid);
+
+CREATE TABLE access_tokens (
+  id           INTEGER PRIMARY KEY AUTOINCREMENT,
+  userid       INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+  name         TEXT    NOT NULL,
+  token_hash   TEXT    UNIQUE NOT NULL,
+  scope        TEXT    NOT NULL,
+  expires_at   INTEGER NULL,
+  last_used_at INTEGER NULL,
+  created_at   INTEGER NOT NULL
+);
+
+CREATE INDEX access_tokens_userid_idx ON access_tokens (userid);
+
+-- the failed attempts of the keys limited by the AttemptLimiter, e.g. "ip:192.0.2.1" or "login:alice"
+CREATE TABLE login_attempts (
+  key             TEXT    PRIMARY KEY,
+  failures        INTEGER NOT NULL,
+  last_failure_at INTEGER NOT NULL,
+  blocked_until   INTEGER NULL
+);
+
+CREATE INDEX login_attempts_last_failure_at_idx ON login_attempts (last_failure_at);
@@ -0,0 +1,2 @@
+ALTER TABLE revoked_users
+  DROP COLUMN revoked_before;
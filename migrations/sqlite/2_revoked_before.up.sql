@@ -0,0 +1,6 @@
+-- the tokens of a user issued before revoked_before are rejected until they expire, a password
+-- change only drops the tokens issued before it while a deletion drops them all
+ALTER TABLE revoked_users
+  ADD revoked_before INTEGER NOT NULL DEFAULT 0;
+
+UPDATE revoked_users SET revoked_before = expires_at;
@@ -2,12 +2,42 @@ export TODO_HTTP_PORT=8080
 export TODO_HTTP_HOST=localhost
 export USER_HTTP_PORT=9080
 export USER_HTTP_HOST=localhost
+export STORAGE_DRIVER=postgres
+export SQLITE_PATH=todos.db
 export SQL_HOST=localhost
 export SQL_PORT=5432
 export SQL_USER=postgres
 export SQL_PASS=postgres
 export SQL_DBNAME=postgres
+export SQL_DSN=
+export SQL_SSLMODE=
+export SQL_SSLROOTCERT=
+export SQL_SSLCERT=
+export SQL_SSLKEY=
+export SQL_MAX_OPEN_CONNS=20
+export SQL_MAX_IDLE_CONNS=10
+export SQL_CONN_MAX_LIFETIME=30m
+export SQL_CONN_MAX_IDLE_TIME=5m
+export SQL_CONNECT_RETRIES=5
+export SQL_CONNECT_BACKOFF=1s
+export AUTO_MIGRATE=true
 export JWT_KEY=my-secret-key-my-secret-key-my-secret-key
+export JWT_KEYS_DIR=
+export JWT_SIGNING_KEY=
+export MAX_PAGE_SIZE=100
+export QUERY_TIMEOUT=10s
+export QUERY_TIMEOUTS=/users/me/export=0
+export TRASH_RETENTION=720h
+export TRASH_PURGE_INTERVAL=1h
+export TOKEN_PRUNE_INTERVAL=1h
+export ACCESS_TOKEN_TTL=15m
+export REFRESH_TOKEN_TTL=720h
+export PASSWORD_RESET_TTL=1h
+export LOGIN_LOCKOUT_THRESHOLD=10
+export LOGIN_LOCKOUT_DURATION=15m
+export ADMIN_TOKEN=
+export NOTIFIER=file
+export NOTIFIER_FILE=notifications.jsonl
 
 go build -o service-binary
 ./service-binary